@@ -15,12 +15,21 @@ import (
 
 // returns a new masterkey along with its base58encoded form
 func NewMaster(passw string) (private, public *Key, mnemonic string, err error) {
-	entropy, err := bip39.NewEntropy(256)
+	return NewMasterLanguage(passw, 24, English)
+}
+
+// NewMasterLanguage is NewMaster with a mnemonic of 12, 15, 18, 21 or 24
+// words of the language.
+func NewMasterLanguage(passw string, words int, lang Language) (private, public *Key, mnemonic string, err error) {
+	if words < 12 || words > 24 || words%3 != 0 {
+		return nil, nil, "", ErrMnemonicLength
+	}
+	entropy, err := bip39.NewEntropy(words * 32 / 3)
 	if err != nil {
 		log.Error(err)
 		return nil, nil, "", err
 	}
-	mnemonic, err = bip39.NewMnemonic(entropy)
+	mnemonic, err = NewMnemonicLanguage(entropy, lang)
 	if err != nil {
 		log.Error(err)
 		return nil, nil, "", err
@@ -29,21 +38,18 @@ func NewMaster(passw string) (private, public *Key, mnemonic string, err error)
 	return
 }
 
+// NewFromMnemonic validates the mnemonic, see ValidateMnemonic, so a typo
+// fails instead of opening another, empty, wallet. The mnemonic and passw are
+// NFKD normalized as BIP 39 requires, see LegacySeed for the wallets made
+// before with other seeds.
 func NewFromMnemonic(mnemonic, passw string) (private, public *Key, err error) {
-	// Generate a Bip32 HD wallet for the mnemonic and a user supplied password
-	seed := bip39.NewSeed(mnemonic, passw)
-	// Create master private key from seed
-	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
-	if err != nil {
-		return nil, nil, err
-	}
-	private = (*Key)(master)
-	neut, err := master.Neuter()
-	if err != nil {
+	if _, err = ValidateMnemonic(mnemonic); err != nil {
 		return nil, nil, err
 	}
-	public = (*Key)(neut)
-	return private, public, nil
+	// Generate a Bip32 HD wallet for the mnemonic and a user supplied password
+	seed := mnemonicSeed(mnemonic, passw)
+	// Create master private key from seed
+	return newFromSeed(seed)
 }
 
 // Encodes the extended key into base58. It's recommended to use this format
@@ -122,32 +128,7 @@ const (
 // The public key may be used securely in non trusted environments to generate
 // addresses for the given coin/account.
 func (k *Key) DeriveExtendedAccountKey(private bool, coinTyp CoinType, account uint32) (*Key, error) {
-	// m/49'
-	purpose, err := (*hdkeychain.ExtendedKey)(k).Child(44 + hdkeychain.HardenedKeyStart)
-	if err != nil {
-		return nil, err
-	}
-
-	// m/44'/0'
-	coinType, err := purpose.Child(uint32(coinTyp) + hdkeychain.HardenedKeyStart)
-	if err != nil {
-		return nil, err
-	}
-
-	// m/44'/0'/0'
-	acctX, err := coinType.Child(account + hdkeychain.HardenedKeyStart)
-	if err != nil {
-		return nil, err
-	}
-
-	if private {
-		return (*Key)(acctX), nil
-	}
-	acctXExternalPub, err := acctX.Neuter()
-	if err != nil {
-		return nil, err
-	}
-	return (*Key)(acctXExternalPub), nil
+	return k.DeriveAccountKey(private, P2PKH, coinTyp, account)
 }
 
 func (k *Key) DeriveExtendedAddr(coinTyp CoinType, internal bool, index uint32) (string, error) {
@@ -167,15 +148,7 @@ func (k *Key) DeriveExtendedKey(internal bool, index uint32) (*Key, error) {
 	} else {
 		kind = 0
 	}
-	acctXKindX, err := (*hdkeychain.ExtendedKey)(k).Child(kind)
-	if err != nil {
-		return nil, err
-	}
-	acctXKindXAddrX, err := (*hdkeychain.ExtendedKey)(acctXKindX).Child(index)
-	if err != nil {
-		return nil, err
-	}
-	return (*Key)(acctXKindXAddrX), nil
+	return k.Derive(Path{kind, index})
 }
 
 func (k *Key) PublicAddr(coinTyp CoinType, account uint32, internal bool, index uint32) (string, error) {
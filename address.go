@@ -0,0 +1,367 @@
+package cryptopay
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/ethereum/go-ethereum/crypto"
+	"strings"
+)
+
+// AddressType is the script an address pays to.
+type AddressType int
+
+const (
+	P2PKH AddressType = iota + 1
+	P2SH
+	P2WPKH
+	P2WSH
+	P2TR
+	// WitnessUnknown is a segwit version without a meaning yet.
+	WitnessUnknown
+	// ETHAccount is an ethereum account, a contract or not.
+	ETHAccount
+)
+
+func (t AddressType) String() string {
+	switch t {
+	case P2PKH:
+		return "p2pkh"
+	case P2SH:
+		return "p2sh"
+	case P2WPKH:
+		return "p2wpkh"
+	case P2WSH:
+		return "p2wsh"
+	case P2TR:
+		return "p2tr"
+	case WitnessUnknown:
+		return "witness_unknown"
+	case ETHAccount:
+		return "account"
+	}
+	return fmt.Sprintf("AddressType(%d)", int(t))
+}
+
+// ValidateAddress checks the checksum of addr and that it's an address of
+// coin on network, and returns what it pays to. BTC takes base58check and
+// bech32/bech32m (segwit v0 and later), BCH base58check and CashAddr, with or
+// without the prefix, ETH hex with the EIP-55 checksum if it's mixed case.
+func ValidateAddress(coinTyp CoinType, network Network, addr string) (AddressType, error) {
+	if network != MainNet && network != TestNet {
+		return 0, fmt.Errorf("Invalid network %s", network)
+	}
+	switch coinTyp {
+	case BTC:
+		hrp := "bc"
+		if network == TestNet {
+			hrp = "tb"
+		}
+		if strings.HasPrefix(strings.ToLower(addr), hrp+"1") {
+			return segwitAddress(hrp, addr)
+		}
+		return base58Address(network, addr)
+	case BCH:
+		prefix := "bitcoincash"
+		if network == TestNet {
+			prefix = "bchtest"
+		}
+		if t, err := base58Address(network, addr); err == nil {
+			return t, nil
+		}
+		return cashAddress(prefix, addr)
+	case ETH:
+		return ethAddress(addr)
+	}
+	return 0, errors.New("Invalid coin type")
+}
+
+func base58Address(network Network, addr string) (AddressType, error) {
+	b, version, err := base58.CheckDecode(addr)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid address %q: %v", addr, err)
+	}
+	if len(b) != 20 {
+		return 0, fmt.Errorf("Invalid address %q, the hash has %v bytes", addr, len(b))
+	}
+	p := network.Params()
+	switch version {
+	case p.PubKeyHashAddrID:
+		return P2PKH, nil
+	case p.ScriptHashAddrID:
+		return P2SH, nil
+	}
+	return 0, fmt.Errorf("Address %q is not on %s", addr, network)
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+const (
+	bech32Const  = 1
+	bech32mConst = 0x2bc830a3
+)
+
+// https://github.com/bitcoin/bips/blob/master/bip-0173.mediawiki
+// https://github.com/bitcoin/bips/blob/master/bip-0350.mediawiki
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		b := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := uint(0); i < 5; i++ {
+			if (b>>i)&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+// bech32Decode returns the human readable part, the 5 bit data without the
+// checksum and the checksum constant, which tells bech32 from bech32m.
+func bech32Decode(s string) (string, []byte, uint32, error) {
+	if len(s) > 90 {
+		return "", nil, 0, errors.New("bech32 string too long")
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, 0, errors.New("bech32 string of mixed case")
+	}
+	s = strings.ToLower(s)
+	pos := strings.LastIndex(s, "1")
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, 0, errors.New("Invalid bech32 separator")
+	}
+	hrp := s[:pos]
+	values := make([]byte, 0, 2*len(hrp)+1+len(s)-pos-1)
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, 0, errors.New("Invalid bech32 character")
+		}
+		values = append(values, hrp[i]>>5)
+	}
+	values = append(values, 0)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]&31)
+	}
+	var data []byte
+	for i := pos + 1; i < len(s); i++ {
+		d := strings.IndexByte(bech32Charset, s[i])
+		if d < 0 {
+			return "", nil, 0, fmt.Errorf("Invalid bech32 character %q", s[i])
+		}
+		data = append(data, byte(d))
+	}
+	c := bech32Polymod(append(values, data...))
+	if c != bech32Const && c != bech32mConst {
+		return "", nil, 0, errors.New("Invalid bech32 checksum")
+	}
+	return hrp, data[:len(data)-6], c, nil
+}
+
+// bech32Encode encodes the 5 bit data with the checksum constant c.
+func bech32Encode(hrp string, data []byte, c uint32) string {
+	var values []byte
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]>>5)
+	}
+	values = append(values, 0)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]&31)
+	}
+	values = append(values, data...)
+	mod := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ c
+	b := []byte(hrp + "1")
+	for _, d := range data {
+		b = append(b, bech32Charset[d])
+	}
+	for i := 0; i < 6; i++ {
+		b = append(b, bech32Charset[mod>>uint(5*(5-i))&31])
+	}
+	return string(b)
+}
+
+// segwitEncode returns the address of a witness program.
+func segwitEncode(network Network, version byte, program []byte) string {
+	hrp := "bc"
+	if network == TestNet {
+		hrp = "tb"
+	}
+	c := uint32(bech32mConst)
+	if version == 0 {
+		c = bech32Const
+	}
+	data, _ := convertBits(program, 8, 5, true)
+	return bech32Encode(hrp, append([]byte{version}, data...), c)
+}
+
+// convertBits regroups from bit values into to bit values. Without pad the
+// leftover bits must be zero padding.
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	var acc, bits uint
+	var out []byte
+	max := uint(1)<<to - 1
+	for _, v := range data {
+		acc = acc<<from | uint(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&max))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&max))
+		}
+		return out, nil
+	}
+	if bits >= from || acc<<(to-bits)&max != 0 {
+		return nil, errors.New("Invalid padding")
+	}
+	return out, nil
+}
+
+// witnessProgram decodes the segwit address addr of hrp.
+func witnessProgram(hrp, addr string) (version byte, program []byte, err error) {
+	h, data, c, err := bech32Decode(addr)
+	if err != nil {
+		return 0, nil, err
+	}
+	if h != hrp {
+		return 0, nil, fmt.Errorf("Address %q is not on %s", addr, hrp)
+	}
+	if len(data) < 1 || data[0] > 16 {
+		return 0, nil, errors.New("Invalid witness version")
+	}
+	version = data[0]
+	program, err = convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(program) < 2 || len(program) > 40 {
+		return 0, nil, fmt.Errorf("Invalid witness program of %v bytes", len(program))
+	}
+	// v0 uses bech32, the later versions bech32m.
+	if version == 0 && c != bech32Const || version > 0 && c != bech32mConst {
+		return 0, nil, errors.New("Invalid checksum for the witness version")
+	}
+	return version, program, nil
+}
+
+func segwitAddress(hrp, addr string) (AddressType, error) {
+	version, program, err := witnessProgram(hrp, addr)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case version == 0 && len(program) == 20:
+		return P2WPKH, nil
+	case version == 0 && len(program) == 32:
+		return P2WSH, nil
+	case version == 0:
+		return 0, fmt.Errorf("Invalid v0 witness program of %v bytes", len(program))
+	case version == 1 && len(program) == 32:
+		return P2TR, nil
+	}
+	return WitnessUnknown, nil
+}
+
+// https://github.com/bitcoincashorg/bitcoincash.org/blob/master/spec/cashaddr.md
+func cashPolymod(values []byte) uint64 {
+	c := uint64(1)
+	for _, d := range values {
+		c0 := byte(c >> 35)
+		c = (c&0x07ffffffff)<<5 ^ uint64(d)
+		if c0&0x01 != 0 {
+			c ^= 0x98f2bc8e61
+		}
+		if c0&0x02 != 0 {
+			c ^= 0x79b76d99e2
+		}
+		if c0&0x04 != 0 {
+			c ^= 0xf33e5fb3c4
+		}
+		if c0&0x08 != 0 {
+			c ^= 0xae2eabe2a8
+		}
+		if c0&0x10 != 0 {
+			c ^= 0x1e4f43e470
+		}
+	}
+	return c ^ 1
+}
+
+func cashAddress(prefix, addr string) (AddressType, error) {
+	if strings.ToLower(addr) != addr && strings.ToUpper(addr) != addr {
+		return 0, errors.New("CashAddr of mixed case")
+	}
+	s := strings.ToLower(addr)
+	if i := strings.Index(s, ":"); i >= 0 {
+		if s[:i] != prefix {
+			return 0, fmt.Errorf("Address %q is not on %s", addr, prefix)
+		}
+		s = s[i+1:]
+	}
+	if len(s) < 9 {
+		return 0, fmt.Errorf("Invalid address %q", addr)
+	}
+	var values []byte
+	for i := 0; i < len(prefix); i++ {
+		values = append(values, prefix[i]&31)
+	}
+	values = append(values, 0)
+	for i := 0; i < len(s); i++ {
+		d := strings.IndexByte(bech32Charset, s[i])
+		if d < 0 {
+			return 0, fmt.Errorf("Invalid CashAddr character %q", s[i])
+		}
+		values = append(values, byte(d))
+	}
+	if cashPolymod(values) != 0 {
+		return 0, errors.New("Invalid CashAddr checksum")
+	}
+	payload, err := convertBits(values[len(prefix)+1:len(values)-8], 5, 8, false)
+	if err != nil {
+		return 0, err
+	}
+	// the version byte has the type and the size of the hash.
+	sizes := [8]int{20, 24, 28, 32, 40, 48, 56, 64}
+	if len(payload) < 1 || payload[0]&0x80 != 0 || len(payload)-1 != sizes[payload[0]&7] {
+		return 0, fmt.Errorf("Invalid address %q", addr)
+	}
+	switch payload[0] >> 3 {
+	case 0:
+		return P2PKH, nil
+	case 1:
+		return P2SH, nil
+	}
+	return 0, fmt.Errorf("Unknown CashAddr type %v", payload[0]>>3)
+}
+
+// https://github.com/ethereum/EIPs/blob/master/EIPS/eip-55.md
+func ethAddress(addr string) (AddressType, error) {
+	if len(addr) != 42 || !strings.HasPrefix(addr, "0x") {
+		return 0, fmt.Errorf("Invalid address %q", addr)
+	}
+	h := addr[2:]
+	if _, err := hex.DecodeString(h); err != nil {
+		return 0, fmt.Errorf("Invalid address %q", addr)
+	}
+	lower := strings.ToLower(h)
+	if h == lower || h == strings.ToUpper(h) {
+		// no checksum
+		return ETHAccount, nil
+	}
+	sum := crypto.Keccak256([]byte(lower))
+	for i := 0; i < len(h); i++ {
+		if lower[i] < 'a' {
+			continue
+		}
+		upper := sum[i/2]>>(4*uint(1-i%2))&0xf >= 8
+		if upper != (h[i] != lower[i]) {
+			return 0, fmt.Errorf("Invalid checksum of %s", addr)
+		}
+	}
+	return ETHAccount, nil
+}
@@ -0,0 +1,64 @@
+package cryptopay
+
+import "testing"
+
+func TestValidateAddress(t *testing.T) {
+	tests := []struct {
+		coin    CoinType
+		network Network
+		addr    string
+		want    AddressType
+	}{
+		{BTC, MainNet, "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", P2PKH},
+		{BTC, MainNet, "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", P2SH},
+		{BTC, TestNet, "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", P2PKH},
+		// BIP173 and BIP350
+		{BTC, MainNet, "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", P2WPKH},
+		{BTC, TestNet, "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", P2WSH},
+		{BTC, MainNet, "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", P2TR},
+		{BTC, MainNet, "bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", WitnessUnknown},
+		{BTC, MainNet, "BC1SW50QGDZ25J", WitnessUnknown},
+		{BCH, MainNet, "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a", P2PKH},
+		{BCH, MainNet, "qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a", P2PKH},
+		{BCH, MainNet, "bitcoincash:ppm2qsznhks23z7629mms6s4cwef74vcwvn0h829pq", P2SH},
+		{BCH, MainNet, "1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu", P2PKH},
+		// EIP-55
+		{ETH, MainNet, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", ETHAccount},
+		{ETH, MainNet, "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359", ETHAccount},
+		{ETH, MainNet, "0xdbf03b407c01e7cd3cbea99509d93f8dddc8c6fb", ETHAccount},
+	}
+	for _, tt := range tests {
+		got, err := ValidateAddress(tt.coin, tt.network, tt.addr)
+		if err != nil || got != tt.want {
+			t.Errorf("%s %s: got %v, %v, want %v", tt.coin, tt.addr, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidateAddressInvalid(t *testing.T) {
+	tests := []struct {
+		coin    CoinType
+		network Network
+		addr    string
+	}{
+		{BTC, MainNet, "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN3"},
+		{BTC, MainNet, "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn"},
+		{BTC, MainNet, "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7"},
+		// BIP350: bech32 checksum with v1, bech32m with v0, mixed case
+		{BTC, MainNet, "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd"},
+		{BTC, MainNet, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh"},
+		{BTC, MainNet, "bc1qW508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+		{BTC, MainNet, "bc1zw508d6qejxtdg4y5r3zarvaryvqyzf3du"},
+		{BCH, MainNet, "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6b"},
+		{BCH, TestNet, "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a"},
+		{ETH, MainNet, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD"},
+		{ETH, MainNet, "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beae"},
+		{ETH, MainNet, "5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"},
+		{ETH, MainNet, "garbage"},
+	}
+	for _, tt := range tests {
+		if got, err := ValidateAddress(tt.coin, tt.network, tt.addr); err == nil {
+			t.Errorf("%s %s: got %v, want an error", tt.coin, tt.addr, got)
+		}
+	}
+}
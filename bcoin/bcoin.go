@@ -9,17 +9,17 @@ import (
 	"fmt"
 	log "github.com/golang/glog"
 	"github.com/winteraz/cryptopay"
-	"github.com/winteraz/cryptopay/blockchain"
+	"github.com/winteraz/cryptopay/broadcast"
+	"github.com/winteraz/cryptopay/transport"
 	"io/ioutil"
 	"net/http"
-	"net/url"
-	"strings"
 	"time"
 )
 
 type Client struct {
-	endpoint string
-	cl       *http.Client
+	endpoint    string
+	cl          *http.Client
+	broadcaster *broadcast.Broadcaster
 }
 
 func (c *Client) Do(req *http.Request) ([]byte, int, error) {
@@ -32,8 +32,14 @@ func (c *Client) Do(req *http.Request) ([]byte, int, error) {
 	return b, rsp.StatusCode, err
 }
 
+// New returns a client that broadcasts through the node and the public
+// endpoints from broadcast.Defaults. Requests go through transport.Client.
 func New(endpoint string, cl *http.Client) *Client {
-	return &Client{cl: cl, endpoint: endpoint}
+	cl = transport.Client(cl)
+	c := &Client{cl: cl, endpoint: endpoint}
+	c.SetBroadcastEndpoints(broadcast.DefaultInterval,
+		append([]broadcast.Endpoint{c.Node()}, broadcast.Defaults(cl)...)...)
+	return c
 }
 
 type Output struct {
@@ -42,16 +48,23 @@ type Output struct {
 	N        int    `json:"index"`
 	Script   string `json:"script"`
 	Satoshis uint64 `json:"value"`
-	//Confirmations int    `json:"confirmations"`
+	Height   int    `json:"height"` // -1 in the mempool
+	Coinbase bool   `json:"coinbase"`
 }
 
-func (o *Output) ToUnspent() cryptopay.Unspent {
+// ToUnspent counts the confirmations from the chain tip.
+func (o *Output) ToUnspent(tip uint64) cryptopay.Unspent {
+	var confirmations int
+	if o.Height >= 0 && uint64(o.Height) <= tip {
+		confirmations = int(tip-uint64(o.Height)) + 1
+	}
 	return cryptopay.Unspent{
 		Tx:            o.Hash,
 		N:             uint32(o.N),
 		Amount:        o.Satoshis,
-		Confirmations: 99,
+		Confirmations: confirmations,
 		Script:        o.Script,
+		Coinbase:      o.Coinbase,
 	}
 }
 
@@ -100,17 +113,86 @@ func (c *Client) Unspent(cx context.Context, addr ...string) (map[string][]crypt
 		log.Errorf("%v, %s", err, b)
 		return nil, err
 	}
+	tip, err := c.BlockHeight(cx)
+	if err != nil {
+		return nil, err
+	}
 	for _, vv := range v {
 		if vv.Address == "" {
 			log.Errorf("%s", b)
 			return nil, errors.New("Invalid address")
 		}
-		m[vv.Address] = append(m[vv.Address], vv.ToUnspent())
+		m[vv.Address] = append(m[vv.Address], vv.ToUnspent(tip))
 	}
 
 	return m, nil
 }
 
+// BlockHeight returns the height of the chain tip.
+func (c *Client) BlockHeight(cx context.Context) (uint64, error) {
+	URL := c.endpoint + "/"
+	req, err := http.NewRequest("GET", URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(cx, timeout)
+	defer cancel()
+	b, status, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+	if status != 200 {
+		err = fmt.Errorf("Invalid response: \n URL %s\n Status  %v, body %s",
+			URL, status, b)
+		log.Error(err)
+		return 0, err
+	}
+	var v struct {
+		Chain struct {
+			Height uint64 `json:"height"`
+		} `json:"chain"`
+	}
+	if err = json.Unmarshal(b, &v); err != nil {
+		log.Errorf("%v, %s", err, b)
+		return 0, err
+	}
+	return v.Chain.Height, nil
+}
+
+// RawTransaction returns the hex transaction txid.
+func (c *Client) RawTransaction(cx context.Context, txid string) (string, error) {
+	URL := fmt.Sprintf("%s/tx/%s", c.endpoint, txid)
+	req, err := http.NewRequest("GET", URL, nil)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(cx, timeout)
+	defer cancel()
+	b, status, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+	if status != 200 {
+		err = fmt.Errorf("Invalid response: \n URL %s\n Status  %v, body %s",
+			URL, status, b)
+		log.Error(err)
+		return "", err
+	}
+	var v struct {
+		Hex string `json:"hex"`
+	}
+	if err = json.Unmarshal(b, &v); err != nil {
+		log.Errorf("%v, %s", err, b)
+		return "", err
+	}
+	if v.Hex == "" {
+		return "", errors.New("Invalid transaction/empty")
+	}
+	return v.Hex, nil
+}
+
 func (c *Client) CountTransactions(cx context.Context, addr ...string) (map[string]uint64, error) {
 	return nil, errors.New("Not implemented")
 }
@@ -121,7 +203,7 @@ type Transactions struct {
 	NTX          int           `json:"n_tx"`
 	NUnread      int           `json:"n_unredeemed"`
 	Received     int           `json:"total_received"`
-	Sent         int           `json: "total_sent"`
+	Sent         int           `json:"total_sent"`
 	Balance      int           `json:"final_balance"`
 	Transactions []Transaction `json:"txs"`
 }
@@ -257,91 +339,41 @@ func (c *Client) hasTransactionsFromTX(cx context.Context, addr ...string) (map[
 	return m, nil
 }
 
+// Broadcast sends the transactions to the node and the configured broadcast
+// endpoints. A transaction succeeds if any endpoint accepted it.
 func (c *Client) Broadcast(cx context.Context, txa ...string) (map[string]error, error) {
-
-	type Rsp struct {
-		tx  string
-		err error
-	}
-	ch := make(chan Rsp, len(txa))
-	for k, v := range txa {
-		if k == 5 {
-			// not too fast..
-			time.Sleep(2 * time.Second)
-			k = 0
-		}
-		go func(cx context.Context, tx string) {
-
-				go func(tx string) {
-					if err := c.broadcastBlockchain(cx, tx); err != nil {
-						log.Error(err)
-					}
-				}(tx)
-				go func(tx string) {
-					if err := c.broadcastInsight(cx, tx); err != nil {
-						log.Error(err)
-					}
-				}(tx)
-				go func(tx string) {
-					if err := c.broadcastBTC(cx, tx); err != nil {
-						log.Error(err)
-					}
-				}(tx)
-		
-			r := Rsp{tx: tx}
-			r.err = c.BroadcastTX(cx, tx)
-			ch <- r
-		}(cx, v)
+	ra, err := c.BroadcastResults(cx, txa...)
+	if err != nil {
+		return nil, err
 	}
 	m := make(map[string]error)
-	for rsp := range ch {
-		m[rsp.tx] = rsp.err
-		if rsp.err != nil {
-			log.Error(rsp.err)
-		}
-		if len(m) == len(txa) {
-			break
-		}
+	for _, r := range ra {
+		m[r.Tx] = r.Err()
 	}
-	close(ch)
 	return m, nil
 }
 
-func (c *Client) BroadcastTX(cx context.Context, tx string) error {
-	URL := fmt.Sprintf("%s/broadcast", c.endpoint)
-	type Req struct {
-		RAWTX string `json:"tx"`
-	}
-	rb, err := json.Marshal(&Req{RAWTX: tx})
-	if err != nil {
-		return err
-	}
-	req, err := http.NewRequest("POST", URL, bytes.NewReader(rb))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	ctx, _ := context.WithTimeout(cx, timeout)
-	req = req.WithContext(ctx)
-	b, status, err := c.Do(req)
-	if err != nil {
-		return err
-	}
-	if status != 200 {
-		err = fmt.Errorf("Status %s, body %s", status, b)
-		return err
-	}
-	return nil
+// BroadcastResults is like Broadcast but returns the txid and the status of
+// every endpoint for each transaction.
+func (c *Client) BroadcastResults(cx context.Context, txa ...string) ([]broadcast.Result, error) {
+	return c.broadcaster.Broadcast(cx, txa...)
 }
 
-func (c *Client) broadcastBlockchain(cx context.Context, tx string) error {
-	return blockchain.New(c.cl).BroadcastTX(cx, tx)
+// SetBroadcastEndpoints replaces the endpoints used by Broadcast. Use Node to
+// keep the node itself in the list.
+func (c *Client) SetBroadcastEndpoints(interval time.Duration, endpoints ...broadcast.Endpoint) {
+	c.broadcaster = broadcast.New(cryptopay.BTC, interval, endpoints...)
 }
 
-func (c *Client) broadcastInsight(cx context.Context, tx string) error {
-	URL := "https://insight.bitpay.com/api/tx/send"
+// Node returns the broadcast endpoint of the node the client talks to.
+func (c *Client) Node() broadcast.Endpoint {
+	return broadcast.Endpoint{Name: c.endpoint, Send: c.BroadcastTX}
+}
+
+func (c *Client) BroadcastTX(cx context.Context, tx string) error {
+	URL := fmt.Sprintf("%s/broadcast", c.endpoint)
 	type Req struct {
-		RAWTX string `json:"rawtx"`
+		RAWTX string `json:"tx"`
 	}
 	rb, err := json.Marshal(&Req{RAWTX: tx})
 	if err != nil {
@@ -355,44 +387,11 @@ func (c *Client) broadcastInsight(cx context.Context, tx string) error {
 	ctx, _ := context.WithTimeout(cx, timeout)
 	req = req.WithContext(ctx)
 	b, status, err := c.Do(req)
-	if err != nil {
-		log.Error(err)
-		return err
-	}
-	if status != 200 {
-		return fmt.Errorf("Status %s, body %s", status, b)
-	}
-	return nil
-}
-
-func (c *Client) broadcastBTC(cx context.Context, tx string) error {
-	type RT struct {
-		Error string `json:"err_msg"`
-	}
-	uv := url.Values{}
-	uv.Set("rawhex", tx)
-	URL := "https://btc.com/api/v1/tools/tx-publish"
-	req, err := http.NewRequest("POST", URL, strings.NewReader(uv.Encode()))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	ctx, _ := context.WithTimeout(cx, timeout)
-	req = req.WithContext(ctx)
-	b, status, err := c.Do(req)
 	if err != nil {
 		return err
 	}
 	if status != 200 {
-		return fmt.Errorf("Status %s, body %s", status, b)
-	}
-	var r RT
-	if err = json.Unmarshal(b, &r); err != nil {
-		return err
-	}
-	if r.Error != "" {
-		err = fmt.Errorf("err %#v", r)
-		log.Error(err)
+		err = fmt.Errorf("Status %v, body %s", status, b)
 		return err
 	}
 	return nil
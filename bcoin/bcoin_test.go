@@ -0,0 +1,43 @@
+package bcoin
+
+import (
+	"context"
+	"github.com/winteraz/cryptopay/internal/contract"
+	"github.com/winteraz/cryptopay/internal/httpreplay"
+	"github.com/winteraz/cryptopay/wallet"
+	"net/http"
+	"testing"
+)
+
+const upstream = "http://localhost:8332"
+
+func TestContract(t *testing.T) {
+	contract.Run(t, "bcoin", upstream, contract.BTC, func(url string, cl *http.Client) wallet.Requester {
+		c := New(url, cl)
+		c.SetBroadcastEndpoints(0, c.Node())
+		return c
+	})
+}
+
+func TestConfirmations(t *testing.T) {
+	s := httpreplay.New(t, "bcoin_confirmations", upstream)
+	defer s.Close()
+	c := New(s.URL, s.Client())
+	cx := context.Background()
+	tip, err := c.BlockHeight(cx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := contract.BTC.Used
+	m, err := c.Unspent(cx, used)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a block mined at the tip has one confirmation, nothing has more than
+	// the chain has blocks.
+	for _, un := range m[used] {
+		if uint64(un.Confirmations) > tip+1 {
+			t.Errorf("got %+v, the tip is %v", un, tip)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package bcoin
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/bloom"
+	"github.com/gorilla/websocket"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	pingInterval = 20 * time.Second
+	readTimeout  = 2 * time.Minute
+)
+
+// Notifier implements watch.Notifier with the websocket of the node. It loads
+// a bloom filter of the addresses so the node only sends the transactions
+// paying to them, and watches the chain for blocks.
+type Notifier struct {
+	endpoint string
+	apiKey   string
+}
+
+// NewNotifier returns a notifier of the node at endpoint, the same endpoint
+// given to New. apiKey may be empty.
+func NewNotifier(endpoint, apiKey string) *Notifier {
+	return &Notifier{endpoint: endpoint, apiKey: apiKey}
+}
+
+func (n *Notifier) Subscribe(cx context.Context, addr []string, changed func(addr ...string)) error {
+	watched := make(map[string]bool)
+	filter := bloom.NewFilter(uint32(len(addr)), rand.Uint32(), 0.0001, wire.BloomUpdateAll)
+	for _, a := range addr {
+		decoded, err := btcutil.DecodeAddress(a, &chaincfg.MainNetParams)
+		if err != nil {
+			return err
+		}
+		filter.Add(decoded.ScriptAddress())
+		watched[a] = true
+	}
+	var raw bytes.Buffer
+	if err := filter.MsgFilterLoad().BtcEncode(&raw, wire.ProtocolVersion, wire.BaseEncoding); err != nil {
+		return err
+	}
+
+	URL := strings.Replace(n.endpoint, "http", "ws", 1) + "/socket.io/?transport=websocket"
+	conn, _, err := websocket.DefaultDialer.Dial(URL, nil)
+	if err != nil {
+		return err
+	}
+	s := &socket{conn: conn}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// unblocks the reads.
+		select {
+		case <-cx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+	go s.ping(done)
+
+	if n.apiKey != "" {
+		if err = s.call("auth", n.apiKey); err != nil {
+			return err
+		}
+	}
+	if err = s.call("watch chain"); err != nil {
+		return err
+	}
+	if err = s.call("set filter", hex.EncodeToString(raw.Bytes())); err != nil {
+		return err
+	}
+	for {
+		ev, err := s.read()
+		if cx.Err() != nil {
+			return cx.Err()
+		}
+		if err != nil {
+			return err
+		}
+		switch ev.name {
+		case "tx":
+			changed(paidTo(ev.data, watched)...)
+		case "block connect", "block disconnect", "chain reset":
+			changed()
+		}
+	}
+}
+
+// paidTo returns the watched addresses tx pays to, none when tx can't be
+// decoded or only spends from them.
+func paidTo(raw []byte, watched map[string]bool) []string {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil
+	}
+	var addr []string
+	for _, out := range tx.TxOut {
+		_, addrs, _, err := txscript.ExtractPkScriptAddrs(out.PkScript, &chaincfg.MainNetParams)
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if watched[a.EncodeAddress()] {
+				addr = append(addr, a.EncodeAddress())
+			}
+		}
+	}
+	return addr
+}
+
+// socket speaks the socket.io framing of the node (bsock) over a websocket.
+type socket struct {
+	conn *websocket.Conn
+	mu   sync.Mutex // a single writer
+	ack  int
+}
+
+type event struct {
+	name string
+	data []byte // the binary attachment or the first argument
+}
+
+func (s *socket) write(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn.WriteMessage(websocket.TextMessage, []byte(msg))
+}
+
+func (s *socket) ping(done chan struct{}) {
+	tick := time.NewTicker(pingInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-tick.C:
+			if err := s.write("2"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// call sends an event with an ack id, the answer is checked by read.
+func (s *socket) call(name string, args ...interface{}) error {
+	b, err := json.Marshal(append([]interface{}{name}, args...))
+	if err != nil {
+		return err
+	}
+	s.ack++
+	return s.write("42" + strconv.Itoa(s.ack) + string(b))
+}
+
+// read returns the next event, answering pings and checking the acks on the
+// way. A binary event is returned with its attachment.
+func (s *socket) read() (*event, error) {
+	var pending *event
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(readTimeout))
+		kind, b, err := s.conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		if kind == websocket.BinaryMessage {
+			if pending == nil {
+				continue
+			}
+			pending.data = bytes.TrimPrefix(b, []byte{4})
+			return pending, nil
+		}
+		msg := string(b)
+		switch {
+		case msg == "2":
+			if err = s.write("3"); err != nil {
+				return nil, err
+			}
+			continue
+		case strings.HasPrefix(msg, "1"):
+			return nil, errors.New("socket closed by the node")
+		case !strings.HasPrefix(msg, "4") || len(msg) < 2:
+			continue // open, pong, noop
+		}
+		typ, body := msg[1], strings.TrimLeft(msg[2:], "0123456789-")
+		var args []json.RawMessage
+		if body != "" {
+			if err = json.Unmarshal([]byte(body), &args); err != nil {
+				return nil, fmt.Errorf("socket: %v, %s", err, msg)
+			}
+		}
+		switch typ {
+		case '3': // ack, [error, result]
+			if len(args) > 0 && string(args[0]) != "null" {
+				return nil, fmt.Errorf("socket: %s", args[0])
+			}
+		case '4':
+			return nil, fmt.Errorf("socket: %s", body)
+		case '2', '5':
+			if len(args) == 0 {
+				continue
+			}
+			ev := new(event)
+			if err = json.Unmarshal(args[0], &ev.name); err != nil {
+				return nil, fmt.Errorf("socket: %v, %s", err, msg)
+			}
+			if typ == '5' {
+				pending = ev
+				continue
+			}
+			if len(args) > 1 {
+				var data string
+				if json.Unmarshal(args[1], &data) == nil {
+					ev.data, _ = hex.DecodeString(data)
+				}
+			}
+			return ev, nil
+		}
+	}
+}
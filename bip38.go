@@ -0,0 +1,281 @@
+package cryptopay
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/base58"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/text/unicode/norm"
+	"math/big"
+)
+
+// https://github.com/bitcoin/bips/blob/master/bip-0038.mediawiki
+
+var ErrBIP38Passphrase = errors.New("Wrong BIP38 passphrase")
+
+const (
+	bip38Version    = 0x01
+	bip38NoEC       = 0x42
+	bip38EC         = 0x43
+	bip38NoECFlag   = 0xc0
+	bip38Compressed = 0x20
+	bip38Lot        = 0x04
+)
+
+// the intermediate codes start with the magic, the last byte is 0x51 if
+// they have a lot and sequence number and 0x53 if they don't.
+var bip38Magic = []byte{0x2c, 0xe9, 0xb3, 0xe1, 0xff, 0x39, 0xe2}
+
+func sha256d(b ...[]byte) []byte {
+	h := sha256.New()
+	for _, v := range b {
+		h.Write(v)
+	}
+	first := h.Sum(nil)
+	sum := sha256.Sum256(first)
+	return sum[:]
+}
+
+// bip38AddressHash is the checksum of the P2PKH address of pub.
+func bip38AddressHash(pub []byte) []byte {
+	addr := base58.CheckEncode(btcutil.Hash160(pub), chaincfg.MainNetParams.PubKeyHashAddrID)
+	return sha256d([]byte(addr))[:4]
+}
+
+func serializePub(pub *btcec.PublicKey, compressed bool) []byte {
+	if compressed {
+		return pub.SerializeCompressed()
+	}
+	return pub.SerializeUncompressed()
+}
+
+// aesBlocks encrypts, or decrypts, the 16 byte blocks of b xor x with key,
+// or decrypts and then xors.
+func aesBlocks(key, b, x []byte, decrypt bool) ([]byte, error) {
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(b))
+	for i := 0; i < len(b); i += aes.BlockSize {
+		blk := out[i : i+aes.BlockSize]
+		if decrypt {
+			c.Decrypt(blk, b[i:i+aes.BlockSize])
+			for j := range blk {
+				blk[j] ^= x[i+j]
+			}
+			continue
+		}
+		for j := range blk {
+			blk[j] = b[i+j] ^ x[i+j]
+		}
+		c.Encrypt(blk, blk)
+	}
+	return out, nil
+}
+
+func bip38Passphrase(passphrase string) []byte {
+	return norm.NFC.Bytes([]byte(passphrase))
+}
+
+// EncryptBIP38 encrypts a WIF key with the passphrase, a 6P... string.
+func EncryptBIP38(wif, passphrase string) (string, error) {
+	w, err := btcutil.DecodeWIF(wif)
+	if err != nil {
+		return "", err
+	}
+	priv := pad32(w.PrivKey.D)
+	addrHash := bip38AddressHash(w.SerializePubKey())
+	derived, err := scrypt.Key(bip38Passphrase(passphrase), addrHash, 16384, 8, 8, 64)
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := aesBlocks(derived[32:], priv, derived[:32], false)
+	if err != nil {
+		return "", err
+	}
+	flag := byte(bip38NoECFlag)
+	if w.CompressPubKey {
+		flag |= bip38Compressed
+	}
+	payload := append([]byte{bip38NoEC, flag}, addrHash...)
+	return base58.CheckEncode(append(payload, encrypted...), bip38Version), nil
+}
+
+// DecryptBIP38 decrypts an encrypted key, EC multiplied or not, and returns
+// its WIF.
+func DecryptBIP38(encrypted, passphrase string) (string, error) {
+	b, version, err := base58.CheckDecode(encrypted)
+	if err != nil {
+		return "", err
+	}
+	if version != bip38Version || len(b) != 38 {
+		return "", errors.New("Invalid BIP38 key")
+	}
+	flag, addrHash := b[1], b[2:6]
+	compressed := flag&bip38Compressed != 0
+	var priv []byte
+	switch b[0] {
+	case bip38NoEC:
+		derived, err := scrypt.Key(bip38Passphrase(passphrase), addrHash, 16384, 8, 8, 64)
+		if err != nil {
+			return "", err
+		}
+		if priv, err = aesBlocks(derived[32:], b[6:], derived[:32], true); err != nil {
+			return "", err
+		}
+	case bip38EC:
+		if priv, err = decryptBIP38EC(b, passphrase); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("Unknown BIP38 type %x", b[0])
+	}
+	key, pub := btcec.PrivKeyFromBytes(btcec.S256(), priv)
+	if !bytes.Equal(bip38AddressHash(serializePub(pub, compressed)), addrHash) {
+		return "", ErrBIP38Passphrase
+	}
+	w, err := btcutil.NewWIF(key, &chaincfg.MainNetParams, compressed)
+	if err != nil {
+		return "", err
+	}
+	return w.String(), nil
+}
+
+// passFactor returns the passfactor of the owner entropy and if it has a
+// lot and sequence number.
+func passFactor(passphrase string, ownerEntropy []byte, lot bool) ([]byte, error) {
+	salt := ownerEntropy
+	if lot {
+		salt = ownerEntropy[:4]
+	}
+	f, err := scrypt.Key(bip38Passphrase(passphrase), salt, 16384, 8, 8, 32)
+	if err != nil {
+		return nil, err
+	}
+	if lot {
+		f = sha256d(f, ownerEntropy)
+	}
+	return f, nil
+}
+
+func passPoint(passFactor []byte) []byte {
+	_, pub := btcec.PrivKeyFromBytes(btcec.S256(), passFactor)
+	return pub.SerializeCompressed()
+}
+
+func decryptBIP38EC(b []byte, passphrase string) ([]byte, error) {
+	flag, addrHash, ownerEntropy := b[1], b[2:6], b[6:14]
+	pf, err := passFactor(passphrase, ownerEntropy, flag&bip38Lot != 0)
+	if err != nil {
+		return nil, err
+	}
+	derived, err := scrypt.Key(passPoint(pf), append(append([]byte{}, addrHash...), ownerEntropy...), 1024, 1, 1, 64)
+	if err != nil {
+		return nil, err
+	}
+	// encryptedpart2 holds the end of encryptedpart1 and of seedb.
+	part2, err := aesBlocks(derived[32:], b[22:38], derived[16:32], true)
+	if err != nil {
+		return nil, err
+	}
+	part1 := append(append([]byte{}, b[14:22]...), part2[:8]...)
+	seed, err := aesBlocks(derived[32:], part1, derived[:16], true)
+	if err != nil {
+		return nil, err
+	}
+	seed = append(seed, part2[8:]...)
+	n := new(big.Int).Mul(new(big.Int).SetBytes(pf), new(big.Int).SetBytes(sha256d(seed)))
+	return pad32(n.Mod(n, btcec.S256().N)), nil
+}
+
+// IntermediateCode returns the passphrase code of passphrase a third party
+// makes EC multiplied keys with, see EncryptIntermediate, without knowing
+// the passphrase or the keys. A lot and sequence number, lot < 1048576 and
+// sequence < 4096, go in the keys if lot isn't negative.
+func IntermediateCode(passphrase string, lot, sequence int) (string, error) {
+	hasLot := lot >= 0
+	ownerEntropy := make([]byte, 8)
+	salt := ownerEntropy
+	if hasLot {
+		if lot >= 1<<20 || sequence < 0 || sequence >= 4096 {
+			return "", errors.New("Invalid BIP38 lot or sequence")
+		}
+		salt = ownerEntropy[:4]
+		ls := uint32(lot)<<12 | uint32(sequence)
+		ownerEntropy[4], ownerEntropy[5], ownerEntropy[6], ownerEntropy[7] = byte(ls>>24), byte(ls>>16), byte(ls>>8), byte(ls)
+	}
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	pf, err := passFactor(passphrase, ownerEntropy, hasLot)
+	if err != nil {
+		return "", err
+	}
+	magic := append([]byte{}, bip38Magic[1:]...)
+	if hasLot {
+		magic = append(magic, 0x51)
+	} else {
+		magic = append(magic, 0x53)
+	}
+	payload := append(append(magic, ownerEntropy...), passPoint(pf)...)
+	return base58.CheckEncode(payload, bip38Magic[0]), nil
+}
+
+// EncryptIntermediate makes a new key encrypted with the passphrase of the
+// intermediate code, and returns it with its address.
+func EncryptIntermediate(code string, compressed bool) (encrypted, address string, err error) {
+	b, version, err := base58.CheckDecode(code)
+	if err != nil {
+		return "", "", err
+	}
+	if version != bip38Magic[0] || len(b) != 48 || !bytes.Equal(b[:6], bip38Magic[1:]) || b[6] != 0x51 && b[6] != 0x53 {
+		return "", "", errors.New("Invalid BIP38 intermediate code")
+	}
+	hasLot := b[6] == 0x51
+	ownerEntropy, pp := b[7:15], b[15:]
+	passPub, err := btcec.ParsePubKey(pp, btcec.S256())
+	if err != nil {
+		return "", "", err
+	}
+	seed := make([]byte, 24)
+	if _, err = rand.Read(seed); err != nil {
+		return "", "", err
+	}
+	curve := btcec.S256()
+	x, y := curve.ScalarMult(passPub.X, passPub.Y, sha256d(seed))
+	pub := serializePub(&btcec.PublicKey{Curve: curve, X: x, Y: y}, compressed)
+	address = base58.CheckEncode(btcutil.Hash160(pub), chaincfg.MainNetParams.PubKeyHashAddrID)
+	addrHash := sha256d([]byte(address))[:4]
+	derived, err := scrypt.Key(pp, append(append([]byte{}, addrHash...), ownerEntropy...), 1024, 1, 1, 64)
+	if err != nil {
+		return "", "", err
+	}
+	part1, err := aesBlocks(derived[32:], seed[:16], derived[:16], false)
+	if err != nil {
+		return "", "", err
+	}
+	part2, err := aesBlocks(derived[32:], append(append([]byte{}, part1[8:]...), seed[16:]...), derived[16:32], false)
+	if err != nil {
+		return "", "", err
+	}
+	var flag byte
+	if compressed {
+		flag |= bip38Compressed
+	}
+	if hasLot {
+		flag |= bip38Lot
+	}
+	payload := append([]byte{bip38EC, flag}, addrHash...)
+	payload = append(payload, ownerEntropy...)
+	payload = append(payload, part1[:8]...)
+	payload = append(payload, part2...)
+	return base58.CheckEncode(payload, bip38Version), address, nil
+}
@@ -0,0 +1,51 @@
+package cryptopay
+
+import "testing"
+
+// BIP 38 test vectors.
+func TestBIP38(t *testing.T) {
+	tests := []struct {
+		encrypted, passphrase, wif string
+		ec                         bool
+	}{
+		{"6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg", "TestingOneTwoThree", "5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR", false},
+		{"6PRNFFkZc2NZ6dJqFfhRoFNMR9Lnyj7dYGrzdgXXVMXcxoKTePPX1dWByq", "Satoshi", "5HtasZ6ofTHP6HCwTqTkLDuLQisYPah7aUnSKfC7h4hMUVw2gi5", false},
+		{"6PYNKZ1EAgYgmQfmNVamxyXVWHzK5s6DGhwP4J5o44cvXdoY7sRzhtpUeo", "TestingOneTwoThree", "L44B5gGEpqEDRS9vVPz7QT35jcBG2r3CZwSwQ4fCewXAhAhqGVpP", false},
+		{"6PfQu77ygVyJLZjfvMLyhLMQbYnu5uguoJJ4kMCLqWwPEdfpwANVS76gTX", "TestingOneTwoThree", "5K4caxezwjGCGfnoPTZ8tMcJBLB7Jvyjv4xxeacadhq8nLisLR2", true},
+		{"6PgNBNNzDkKdhkT6uJntUXwwzQV8Rr2tZcbkDcuC9DZRsS6AtHts4Ypo1j", "MOLON LABE", "5JLdxTtcTHcfYcmJsNVy1v2PMDx432JPoYcBTVVRHpPaxUrdtf8", true},
+	}
+	for _, tt := range tests {
+		wif, err := DecryptBIP38(tt.encrypted, tt.passphrase)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.encrypted, err)
+		}
+		if wif != tt.wif {
+			t.Errorf("%s: got %s, want %s", tt.encrypted, wif, tt.wif)
+		}
+		if _, err = DecryptBIP38(tt.encrypted, "wrong"); err != ErrBIP38Passphrase {
+			t.Errorf("%s: wrong passphrase gave %v", tt.encrypted, err)
+		}
+		if tt.ec {
+			continue
+		}
+		if got, err := EncryptBIP38(tt.wif, tt.passphrase); err != nil || got != tt.encrypted {
+			t.Errorf("%s: encrypted to %s, %v", tt.wif, got, err)
+		}
+	}
+}
+
+func TestBIP38Intermediate(t *testing.T) {
+	for _, lot := range []int{-1, 263183} {
+		code, err := IntermediateCode("TestingOneTwoThree", lot, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encrypted, _, err := EncryptIntermediate(code, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = DecryptBIP38(encrypted, "TestingOneTwoThree"); err != nil {
+			t.Fatalf("lot %v: %s: %v", lot, encrypted, err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package cryptopay
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+// https://github.com/bitcoin/bips/blob/master/bip-0085.mediawiki
+
+const bip85Purpose = 83696968
+
+// BIP85Entropy derives the 64 bytes of entropy of the path below
+// m/83696968' from the master key k. The path is hardened like the
+// applications of BIP 85.
+func (k *Key) BIP85Entropy(p Path) ([]byte, error) {
+	child, err := k.Derive(Path{Hardened(bip85Purpose)}.Child(p...))
+	if err != nil {
+		return nil, err
+	}
+	priv, err := (*hdkeychain.ExtendedKey)(child).ECPrivKey()
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(sha512.New, []byte("bip-entropy-from-k"))
+	h.Write(pad32(priv.D))
+	return h.Sum(nil), nil
+}
+
+// BIP85Mnemonic derives the child mnemonic index of 12, 18 or 24 words.
+func (k *Key) BIP85Mnemonic(lang Language, words int, index uint32) (string, error) {
+	if words != 12 && words != 18 && words != 24 {
+		return "", errors.New("BIP85 mnemonics have 12, 18 or 24 words")
+	}
+	entropy, err := k.BIP85Entropy(Path{Hardened(39), Hardened(uint32(lang)), Hardened(uint32(words)), Hardened(index)})
+	if err != nil {
+		return "", err
+	}
+	return NewMnemonicLanguage(entropy[:words*4/3], lang)
+}
+
+// BIP85WIF derives the compressed WIF key index.
+func (k *Key) BIP85WIF(index uint32) (string, error) {
+	entropy, err := k.BIP85Entropy(Path{Hardened(2), Hardened(index)})
+	if err != nil {
+		return "", err
+	}
+	priv, _ := btcec.PrivKeyFromBytes(btcec.S256(), entropy[:32])
+	w, err := btcutil.NewWIF(priv, &chaincfg.MainNetParams, true)
+	if err != nil {
+		return "", err
+	}
+	return w.String(), nil
+}
+
+// BIP85XPRV derives the master key index.
+func (k *Key) BIP85XPRV(index uint32) (*Key, error) {
+	entropy, err := k.BIP85Entropy(Path{Hardened(32), Hardened(index)})
+	if err != nil {
+		return nil, err
+	}
+	x := hdkeychain.NewExtendedKey(chaincfg.MainNetParams.HDPrivateKeyID[:], entropy[32:],
+		entropy[:32], make([]byte, 4), 0, 0, true)
+	if _, err = x.ECPrivKey(); err != nil {
+		return nil, err
+	}
+	return (*Key)(x), nil
+}
+
+// BIP85Hex derives index of 16 to 64 bytes, hex encoded.
+func (k *Key) BIP85Hex(bytes int, index uint32) (string, error) {
+	if bytes < 16 || bytes > 64 {
+		return "", errors.New("BIP85 hex entropy is 16 to 64 bytes")
+	}
+	entropy, err := k.BIP85Entropy(Path{Hardened(128169), Hardened(uint32(bytes)), Hardened(index)})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(entropy[:bytes]), nil
+}
@@ -0,0 +1,50 @@
+package cryptopay
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// BIP 85 test vectors.
+func TestBIP85(t *testing.T) {
+	master, err := ParseKey("xprv9s21ZrQH143K2LBWUUQRFXhucrQqBpKdRRxNVq2zBqsx8HVqFk2uYo8kmbaLLHRdqtQpUm98uKfu3vca1LqdGhUtyoFnCNkfmXRyPXLjbKb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		path, entropy string
+	}{
+		{"0'/0'", "efecfbccffea313214232d29e71563d941229afb4338c21f9517c41aaa0d16f00b83d2a09ef747e7a64e8e2bd5a14869e693da66ce94ac2da570ab7ee48618f7"},
+		{"0'/1'", "70c6e3e8ebee8dc4c0dbba66076819bb8c09672527c4277ca8729532ad711872218f826919f6b67218adde99018a6df9095ab2b58d803b5b93ec9802085a690e"},
+	} {
+		p, err := ParsePath(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := master.BIP85Entropy(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(b); got != tt.entropy {
+			t.Errorf("%s: got %s", tt.path, got)
+		}
+	}
+	for words, want := range map[int]string{
+		12: "girl mad pet galaxy egg matter matrix prison refuse sense ordinary nose",
+		18: "near account window bike charge season chef number sketch tomorrow excuse sniff circle vital hockey outdoor supply token",
+		24: "puppy ocean match cereal symbol another shed magic wrap hammer bulb intact gadget divorce twin tonight reason outdoor destroy simple truth cigar social volcano",
+	} {
+		if got, err := master.BIP85Mnemonic(English, words, 0); err != nil || got != want {
+			t.Errorf("%v words: got %q, %v", words, got, err)
+		}
+	}
+	if got, err := master.BIP85WIF(0); err != nil || got != "Kzyv4uF39d4Jrw2W7UryTHwZr1zQVNk4dAFyqE6BuMrMh1Za7uhp" {
+		t.Errorf("WIF: got %s, %v", got, err)
+	}
+	if got, err := master.BIP85XPRV(0); err != nil || got.Base58() != "xprv9s21ZrQH143K2srSbCSg4m4kLvPMzcWydgmKEnMmoZUurYuBuYG46c6P71UGXMzmriLzCCBvKQWBUv3vPB3m1SATMhp3uEjXHJ42jFg7myX" {
+		t.Errorf("XPRV: got %v, %v", got, err)
+	}
+	if got, err := master.BIP85Hex(64, 0); err != nil || got != "492db4698cf3b73a5a24998aa3e9d7fa96275d85724a91e71aa2d645442f878555d078fd1f1f67e368976f04137b1f7a0d19232136ca50c44614af72b5582a5c" {
+		t.Errorf("HEX: got %s, %v", got, err)
+	}
+}
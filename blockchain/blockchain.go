@@ -7,24 +7,38 @@ import (
 	"fmt"
 	log "github.com/golang/glog"
 	"github.com/winteraz/cryptopay"
+	"github.com/winteraz/cryptopay/transport"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 )
 
+// The blockchain.info API.
+const Endpoint = "https://blockchain.info"
+
 type Client struct {
-	cl *http.Client
+	endpoint string
+	cl       *http.Client
 }
 
+// New returns a blockchain.info client whose requests go through
+// transport.Client.
 func New(cl *http.Client) *Client {
-	return &Client{cl: cl}
+	return NewEndpoint(Endpoint, cl)
+}
+
+// NewEndpoint is like New for an API compatible endpoint.
+func NewEndpoint(endpoint string, cl *http.Client) *Client {
+	return &Client{endpoint: endpoint, cl: transport.Client(cl)}
 }
 
 type Output struct {
 	Age           int    `json:"tx_age"`
-	Hash          string `json:"tx_hash"`
-	Index         uint32 `json:"tx_index"`
+	Hash          string `json:"tx_hash"` // little endian
+	HashBigEndian string `json:"tx_hash_big_endian"`
+	Index         uint32 `json:"tx_index"` // blockchain.info internal id
 	N             int    `json:"tx_output_n"`
 	Script        string `json:"script"`
 	Value         uint64 `json:"value"`
@@ -33,8 +47,8 @@ type Output struct {
 
 func (o *Output) ToUnspent() cryptopay.Unspent {
 	return cryptopay.Unspent{
-		Tx:            o.Hash,
-		N:             o.Index,
+		Tx:            o.HashBigEndian,
+		N:             uint32(o.N),
 		Amount:        o.Value,
 		Confirmations: o.Confirmations,
 		Script:        o.Script,
@@ -48,9 +62,12 @@ type Unspent struct {
 // Implement wallet.Unspender. It supports bitcoin only
 // receives xpub
 func (c *Client) Unspent(cx context.Context, addr ...string) (map[string][]cryptopay.Unspent, error) {
+	if len(addr) == 0 {
+		return nil, errors.New("Invalid address list")
+	}
 	m := make(map[string][]cryptopay.Unspent)
 	for _, address := range addr {
-		URL := "https://blockchain.info/unspent?active=" + address
+		URL := c.endpoint + "/unspent?active=" + address
 		req, err := http.NewRequest("GET", URL, nil)
 		if err != nil {
 			return nil, err
@@ -88,6 +105,32 @@ func (c *Client) Unspent(cx context.Context, addr ...string) (map[string][]crypt
 	return m, nil
 }
 
+// BlockHeight returns the height of the chain tip.
+func (c *Client) BlockHeight(cx context.Context) (uint64, error) {
+	URL := c.endpoint + "/q/getblockcount"
+	req, err := http.NewRequest("GET", URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	rsp, err := c.cl.Do(req.WithContext(cx))
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+	b, err := ioutil.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if err != nil {
+		return 0, err
+	}
+	if rsp.StatusCode != 200 {
+		err = fmt.Errorf("Invalid response: \n URL %s\n Status  %v, body %s",
+			URL, rsp.StatusCode, b)
+		log.Error(err)
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+}
+
 func (c *Client) CountTransactions(cx context.Context, addr ...string) (map[string]uint64, error) {
 	return nil, errors.New("Not implemented")
 }
@@ -98,7 +141,7 @@ type Transactions struct {
 	NTX          int           `json:"n_tx"`
 	NUnread      int           `json:"n_unredeemed"`
 	Received     int           `json:"total_received"`
-	Sent         int           `json: "total_sent"`
+	Sent         int           `json:"total_sent"`
 	Balance      int           `json:"final_balance"`
 	Transactions []Transaction `json:"txs"`
 }
@@ -108,10 +151,12 @@ type Transaction struct {
 }
 
 func (c *Client) HasTransactions(cx context.Context, addr ...string) (map[string]bool, error) {
-
+	if len(addr) == 0 {
+		return nil, errors.New("Invalid address list")
+	}
 	m := make(map[string]bool)
 	for _, address := range addr {
-		URL := "https://blockchain.info/rawaddr/" + address
+		URL := c.endpoint + "/rawaddr/" + address
 		req, err := http.NewRequest("GET", URL, nil)
 		if err != nil {
 			return nil, err
@@ -148,8 +193,20 @@ func (c *Client) HasTransactions(cx context.Context, addr ...string) (map[string
 	return m, nil
 }
 
+// Broadcast implements wallet.Broadcaster.
+func (c *Client) Broadcast(cx context.Context, txa ...string) (map[string]error, error) {
+	if len(txa) == 0 {
+		return nil, errors.New("Invalid transaction list")
+	}
+	m := make(map[string]error)
+	for _, tx := range txa {
+		m[tx] = c.BroadcastTX(cx, tx)
+	}
+	return m, nil
+}
+
 func (c *Client) BroadcastTX(cx context.Context, tx string) error {
-	const URL = "https://blockchain.info/pushtx"
+	URL := c.endpoint + "/pushtx"
 	en := url.Values{}
 	en.Set("tx", tx)
 	req, err := http.NewRequest("POST", URL, strings.NewReader(en.Encode()))
@@ -162,9 +219,13 @@ func (c *Client) BroadcastTX(cx context.Context, tx string) error {
 	if err != nil {
 		return err
 	}
+	b, err := ioutil.ReadAll(rsp.Body)
 	rsp.Body.Close()
+	if err != nil {
+		return err
+	}
 	if rsp.StatusCode != 200 {
-		return errors.New(rsp.Status)
+		return fmt.Errorf("%s: %s", rsp.Status, b)
 	}
 	return nil
 
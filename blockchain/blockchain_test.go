@@ -0,0 +1,14 @@
+package blockchain
+
+import (
+	"github.com/winteraz/cryptopay/internal/contract"
+	"github.com/winteraz/cryptopay/wallet"
+	"net/http"
+	"testing"
+)
+
+func TestContract(t *testing.T) {
+	contract.Run(t, "blockchain", Endpoint, contract.BTC, func(url string, cl *http.Client) wallet.Requester {
+		return NewEndpoint(url, cl)
+	})
+}
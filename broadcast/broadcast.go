@@ -0,0 +1,159 @@
+// Package broadcast pushes raw transactions to a configurable list of
+// endpoints and reports the outcome of every endpoint separately.
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/golang/glog"
+	"github.com/winteraz/cryptopay"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The minimum time between two transactions sent to the same endpoint.
+const DefaultInterval = 500 * time.Millisecond
+
+// Endpoint pushes a raw hex encoded transaction to a single service.
+type Endpoint struct {
+	Name string
+	Send func(cx context.Context, rawTx string) error
+}
+
+// Status is the outcome of one transaction on one endpoint.
+type Status struct {
+	Endpoint string
+	Err      error
+}
+
+// Result is the outcome of one transaction on all endpoints.
+type Result struct {
+	Tx        string // raw transaction
+	TXID      string
+	Endpoints []Status
+}
+
+// Err returns nil if at least one endpoint accepted the transaction.
+func (r *Result) Err() error {
+	if len(r.Endpoints) == 0 {
+		return errors.New("no endpoint")
+	}
+	var sa []string
+	for _, s := range r.Endpoints {
+		if s.Err == nil {
+			return nil
+		}
+		sa = append(sa, fmt.Sprintf("%s: %v", s.Endpoint, s.Err))
+	}
+	return fmt.Errorf("tx %s rejected by all endpoints: %s", r.TXID, strings.Join(sa, "; "))
+}
+
+type Broadcaster struct {
+	coin      cryptopay.CoinType
+	endpoints []Endpoint
+	limiters  []*limiter
+}
+
+// New returns a broadcaster which sends each transaction to every endpoint,
+// waiting at least interval between two transactions on the same endpoint.
+func New(coin cryptopay.CoinType, interval time.Duration, endpoints ...Endpoint) *Broadcaster {
+	b := &Broadcaster{coin: coin, endpoints: endpoints}
+	for range endpoints {
+		b.limiters = append(b.limiters, &limiter{interval: interval})
+	}
+	return b
+}
+
+// Broadcast returns one result per transaction in the same order as txa.
+func (b *Broadcaster) Broadcast(cx context.Context, txa ...string) ([]Result, error) {
+	if len(txa) == 0 {
+		return nil, errors.New("Invalid transaction list")
+	}
+	if len(b.endpoints) == 0 {
+		return nil, errors.New("Invalid endpoint list/empty")
+	}
+	ra := make([]Result, len(txa))
+	for i, tx := range txa {
+		txid, err := cryptopay.TXID(b.coin, tx)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		ra[i] = Result{Tx: tx, TXID: txid, Endpoints: make([]Status, len(b.endpoints))}
+	}
+	var wg sync.WaitGroup
+	for k, e := range b.endpoints {
+		wg.Add(1)
+		// transactions are sent in order on every endpoint so that a child
+		// spending a parent's change doesn't arrive first.
+		go func(k int, e Endpoint) {
+			defer wg.Done()
+			for i := range ra {
+				s := Status{Endpoint: e.Name}
+				if s.Err = b.limiters[k].wait(cx); s.Err == nil {
+					s.Err = e.Send(cx, ra[i].Tx)
+				}
+				if IsKnown(s.Err) {
+					s.Err = nil
+				}
+				if s.Err != nil {
+					log.Errorf("endpoint %s, txid %s, err %v", e.Name, ra[i].TXID, s.Err)
+				}
+				ra[i].Endpoints[k] = s
+			}
+		}(k, e)
+	}
+	wg.Wait()
+	return ra, nil
+}
+
+// IsKnown reports whether err means the node already has the transaction
+// in its mempool or in a block, which is a success for a broadcast.
+func IsKnown(err error) bool {
+	if err == nil {
+		return false
+	}
+	s := strings.ToLower(err.Error())
+	for _, v := range []string{
+		"already in block chain",
+		"already in the mempool",
+		"txn-already-in-mempool",
+		"txn-already-known",
+		"already have transaction",
+		"already known",
+		"transaction already exists",
+	} {
+		if strings.Contains(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+type limiter struct {
+	interval time.Duration
+	mu       sync.Mutex
+	next     time.Time
+}
+
+// wait blocks until the next slot is free.
+func (l *limiter) wait(cx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+	t := time.NewTimer(at.Sub(now))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-cx.Done():
+		return cx.Err()
+	}
+}
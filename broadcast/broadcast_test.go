@@ -0,0 +1,135 @@
+package broadcast
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/winteraz/cryptopay"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rawTx returns a distinct hex bitcoin transaction for every n.
+func rawTx(t *testing.T, n int) string {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{byte(n)}, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, []byte{0x51}))
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(buf.Bytes())
+}
+
+// fake is an endpoint answering err and recording when it got what.
+type fake struct {
+	err  error
+	mu   sync.Mutex
+	sent []string
+	at   []time.Time
+}
+
+func (f *fake) endpoint(name string) Endpoint {
+	return Endpoint{Name: name, Send: func(cx context.Context, rawTx string) error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.sent = append(f.sent, rawTx)
+		f.at = append(f.at, time.Now())
+		return f.err
+	}}
+}
+
+func TestIsKnown(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("-27: transaction already in block chain"), true},
+		{errors.New("258: txn-already-in-mempool"), true},
+		{errors.New("Transaction already exists"), true},
+		{errors.New("already known"), true},
+		{errors.New("-26: bad-txns-inputs-missingorspent"), false},
+		{errors.New("nonce too low"), false},
+	} {
+		if got := IsKnown(tc.err); got != tc.want {
+			t.Errorf("%v: known %v", tc.err, got)
+		}
+	}
+}
+
+func TestResultErr(t *testing.T) {
+	rejected := errors.New("rejected")
+	for _, tc := range []struct {
+		endpoints []Status
+		ok        bool
+	}{
+		{nil, false},
+		{[]Status{{"a", rejected}, {"b", rejected}}, false},
+		{[]Status{{"a", rejected}, {"b", nil}}, true},
+		{[]Status{{"a", nil}}, true},
+	} {
+		r := &Result{TXID: "txid", Endpoints: tc.endpoints}
+		if err := r.Err(); (err == nil) != tc.ok {
+			t.Errorf("%+v: err %v", tc.endpoints, err)
+		}
+	}
+	r := &Result{TXID: "txid", Endpoints: []Status{{"a", rejected}, {"b", rejected}}}
+	if err := r.Err(); !strings.Contains(err.Error(), "a: rejected") || !strings.Contains(err.Error(), "b: rejected") {
+		t.Errorf("err %v doesn't name the endpoints", err)
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	cx := context.Background()
+	const interval = 20 * time.Millisecond
+	ok, bad, known := &fake{}, &fake{err: errors.New("-26: bad-txns")}, &fake{err: errors.New("txn-already-known")}
+	b := New(cryptopay.BTC, interval, ok.endpoint("ok"), bad.endpoint("bad"), known.endpoint("known"))
+	txa := []string{rawTx(t, 1), rawTx(t, 2), rawTx(t, 3)}
+	ra, err := b.Broadcast(cx, txa...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ra) != len(txa) {
+		t.Fatalf("%v results", len(ra))
+	}
+	for i, r := range ra {
+		if r.Tx != txa[i] || r.Err() != nil {
+			t.Errorf("%v: result %+v, err %v", i, r, r.Err())
+		}
+		// the known transaction is a success, the rejection is kept.
+		if r.Endpoints[0].Err != nil || r.Endpoints[1].Err == nil || r.Endpoints[2].Err != nil {
+			t.Errorf("%v: statuses %+v", i, r.Endpoints)
+		}
+	}
+	// in order and rate limited on every endpoint.
+	for _, f := range []*fake{ok, bad, known} {
+		for i := range f.sent {
+			if f.sent[i] != txa[i] {
+				t.Fatalf("sent %v out of order", i)
+			}
+			if i > 0 && f.at[i].Sub(f.at[i-1]) < interval-time.Millisecond {
+				t.Errorf("sent %v after %v", i, f.at[i].Sub(f.at[i-1]))
+			}
+		}
+	}
+
+	// a cancelled broadcast doesn't wait for the limiter.
+	cancelled, cancel := context.WithCancel(cx)
+	cancel()
+	b = New(cryptopay.BTC, time.Hour, ok.endpoint("ok"))
+	if ra, err = b.Broadcast(cancelled, txa[:2]...); err != nil {
+		t.Fatal(err)
+	}
+	if ra[1].Err() == nil {
+		t.Error("broadcast after the cancel")
+	}
+	if _, err = b.Broadcast(cx, "zz"); err == nil {
+		t.Error("broadcast an invalid transaction")
+	}
+}
@@ -0,0 +1,115 @@
+package broadcast
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/winteraz/cryptopay/blockchain"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	InsightURL = "https://insight.bitpay.com/api/tx/send"
+	BTCComURL  = "https://btc.com/api/v1/tools/tx-publish"
+)
+
+const timeout = 30 * time.Second
+
+// Blockchain pushes transactions through blockchain.info.
+func Blockchain(cl *http.Client) Endpoint {
+	return Endpoint{Name: "blockchain.info", Send: blockchain.New(cl).BroadcastTX}
+}
+
+// Insight pushes transactions through an insight-api tx/send URL
+// such as InsightURL.
+func Insight(URL string, cl *http.Client) Endpoint {
+	send := func(cx context.Context, tx string) error {
+		type Req struct {
+			RAWTX string `json:"rawtx"`
+		}
+		rb, err := json.Marshal(&Req{RAWTX: tx})
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest("POST", URL, bytes.NewReader(rb))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		b, status, err := do(cx, cl, req)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("Status %v, body %s", status, b)
+		}
+		return nil
+	}
+	return Endpoint{Name: hostname(URL), Send: send}
+}
+
+// BTCCom pushes transactions through the btc.com tx-publish URL BTCComURL.
+func BTCCom(URL string, cl *http.Client) Endpoint {
+	send := func(cx context.Context, tx string) error {
+		type RT struct {
+			Error string `json:"err_msg"`
+		}
+		uv := url.Values{}
+		uv.Set("rawhex", tx)
+		req, err := http.NewRequest("POST", URL, strings.NewReader(uv.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		b, status, err := do(cx, cl, req)
+		if err != nil {
+			return err
+		}
+		if status != 200 {
+			return fmt.Errorf("Status %v, body %s", status, b)
+		}
+		var r RT
+		if err = json.Unmarshal(b, &r); err != nil {
+			return err
+		}
+		if r.Error != "" {
+			return fmt.Errorf("err %#v", r)
+		}
+		return nil
+	}
+	return Endpoint{Name: hostname(URL), Send: send}
+}
+
+// Defaults returns the public BTC endpoints.
+func Defaults(cl *http.Client) []Endpoint {
+	return []Endpoint{
+		Blockchain(cl),
+		Insight(InsightURL, cl),
+		BTCCom(BTCComURL, cl),
+	}
+}
+
+func do(cx context.Context, cl *http.Client, req *http.Request) ([]byte, int, error) {
+	ctx, cancel := context.WithTimeout(cx, timeout)
+	defer cancel()
+	rsp, err := cl.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rsp.Body.Close()
+	b, err := ioutil.ReadAll(rsp.Body)
+	return b, rsp.StatusCode, err
+}
+
+func hostname(URL string) string {
+	u, err := url.Parse(URL)
+	if err != nil || u.Host == "" {
+		return URL
+	}
+	return u.Host
+}
@@ -9,17 +9,18 @@ import (
 	"fmt"
 	log "github.com/golang/glog"
 	"github.com/winteraz/cryptopay"
-	"github.com/winteraz/cryptopay/blockchain"
+	"github.com/winteraz/cryptopay/broadcast"
+	"github.com/winteraz/cryptopay/transport"
 	"io/ioutil"
 	"net/http"
-	"net/url"
 	"strings"
 	"time"
 )
 
 type Client struct {
-	endpoint string
-	cl       *http.Client
+	endpoint    string
+	cl          *http.Client
+	broadcaster *broadcast.Broadcaster
 }
 
 func (c *Client) Do(req *http.Request) ([]byte, int, error) {
@@ -32,8 +33,14 @@ func (c *Client) Do(req *http.Request) ([]byte, int, error) {
 	return b, rsp.StatusCode, err
 }
 
+// New returns a client that broadcasts through the node and the public
+// endpoints from broadcast.Defaults. Requests go through transport.Client.
 func New(endpoint string, cl *http.Client) *Client {
-	return &Client{cl: cl, endpoint: endpoint}
+	cl = transport.Client(cl)
+	c := &Client{cl: cl, endpoint: endpoint}
+	c.SetBroadcastEndpoints(broadcast.DefaultInterval,
+		append([]broadcast.Endpoint{c.Node()}, broadcast.Defaults(cl)...)...)
+	return c
 }
 
 type Output struct {
@@ -108,6 +115,38 @@ func (c *Client) Unspent(cx context.Context, addr ...string) (map[string][]crypt
 	return m, nil
 }
 
+// BlockHeight returns the height of the chain tip.
+func (c *Client) BlockHeight(cx context.Context) (uint64, error) {
+	URL := fmt.Sprintf("%s/insight-api/status?q=getInfo", c.endpoint)
+	req, err := http.NewRequest("GET", URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(cx, timeout)
+	defer cancel()
+	b, status, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+	if status != 200 {
+		err = fmt.Errorf("Invalid response: \n URL %s\n Status  %v, body %s",
+			URL, status, b)
+		log.Error(err)
+		return 0, err
+	}
+	var v struct {
+		Info struct {
+			Blocks uint64 `json:"blocks"`
+		} `json:"info"`
+	}
+	if err = json.Unmarshal(b, &v); err != nil {
+		log.Errorf("%v, %s", err, b)
+		return 0, err
+	}
+	return v.Info.Blocks, nil
+}
+
 func (c *Client) CountTransactions(cx context.Context, addr ...string) (map[string]uint64, error) {
 	return nil, errors.New("Not implemented")
 }
@@ -118,7 +157,7 @@ type Transactions struct {
 	NTX          int           `json:"n_tx"`
 	NUnread      int           `json:"n_unredeemed"`
 	Received     int           `json:"total_received"`
-	Sent         int           `json: "total_sent"`
+	Sent         int           `json:"total_sent"`
 	Balance      int           `json:"final_balance"`
 	Transactions []Transaction `json:"txs"`
 }
@@ -127,33 +166,59 @@ type Transaction struct {
 	TXID string `json:"txid"`
 }
 
+// Summary is the insight answer for /insight-api/addr/<addr>. The amounts
+// are in BTC, the Sat fields in satoshi.
 type Summary struct {
-	Address       string `json:"addrStr"`
-	TotalReceived int    `json:"totalReceived"`
+	Address          string  `json:"addrStr"`
+	Balance          float64 `json:"balance"`
+	BalanceSat       uint64  `json:"balanceSat"`
+	TotalReceived    float64 `json:"totalReceived"`
+	TotalReceivedSat uint64  `json:"totalReceivedSat"`
+	TxApperances     int     `json:"txApperances"`
 }
 
+// HasTransactions asks the summary of every address, insight has no batch
+// endpoint for it.
 func (c *Client) HasTransactions(cx context.Context, addr ...string) (map[string]bool, error) {
 	if len(addr) == 0 {
 		return nil, errors.New("Invalid address list")
 	}
-	var address string
-	if len(addr) > 1 {
-		address = strings.Join(addr, ",")
-	} else {
-		address = addr[0]
+	type Rsp struct {
+		address string
+		ok      bool
+		err     error
 	}
-	URL := fmt.Sprintf("%s/insight-api/addrs/%s/summary", c.endpoint, address)
+	ch := make(chan Rsp, len(addr))
+	for _, address := range addr {
+		go func(address string) {
+			s, err := c.summary(cx, address)
+			if err != nil {
+				ch <- Rsp{address: address, err: err}
+				return
+			}
+			ch <- Rsp{address: address, ok: s.TxApperances > 0 || s.TotalReceivedSat > 0}
+		}(address)
+	}
+	m := make(map[string]bool)
+	for range addr {
+		rsp := <-ch
+		if rsp.err != nil {
+			return nil, rsp.err
+		}
+		m[rsp.address] = rsp.ok
+	}
+	return m, nil
+}
 
+func (c *Client) summary(cx context.Context, address string) (*Summary, error) {
+	URL := fmt.Sprintf("%s/insight-api/addr/%s?noTxList=1", c.endpoint, address)
 	req, err := http.NewRequest("GET", URL, nil)
 	if err != nil {
 		return nil, err
 	}
-	ctx, _ := context.WithTimeout(cx, timeout)
-	req = req.WithContext(ctx)
-	var b []byte
-	var status int
-	//log.Infof("StartTX call %s", URL)
-	b, status, err = c.Do(req)
+	ctx, cancel := context.WithTimeout(cx, timeout)
+	defer cancel()
+	b, status, err := c.Do(req.WithContext(ctx))
 	if err != nil {
 		log.Error(err)
 		return nil, err
@@ -164,22 +229,15 @@ func (c *Client) HasTransactions(cx context.Context, addr ...string) (map[string
 		log.Error(err)
 		return nil, err
 	}
-	var sa []Summary
-	if err = json.Unmarshal(b, &sa); err != nil {
+	s := new(Summary)
+	if err = json.Unmarshal(b, s); err != nil {
 		log.Errorf("%v, %s", err, b)
 		return nil, err
 	}
-	if len(sa) != len(addr) {
-		return nil, fmt.Errorf("requested %v, received %v", len(addr), len(sa))
+	if s.Address != address {
+		return nil, fmt.Errorf("requested %s, received %q", address, s.Address)
 	}
-	m := make(map[string]bool)
-	for _, v := range sa {
-		if v.Address == "" {
-			return nil, errors.New("Invalid address")
-		}
-		m[v.Address] = (v.TotalReceived > 0)
-	}
-	return m, nil
+	return s, nil
 }
 
 // this is slow b.c requires multiple http roundtrips.
@@ -251,87 +309,39 @@ func (c *Client) hasTransactionsFromTX(cx context.Context, addr ...string) (map[
 	return m, nil
 }
 
+// Broadcast sends the transactions to the node and the configured broadcast
+// endpoints. A transaction succeeds if any endpoint accepted it.
 func (c *Client) Broadcast(cx context.Context, txa ...string) (map[string]error, error) {
-
-	type Rsp struct {
-		tx  string
-		err error
-	}
-	ch := make(chan Rsp, len(txa))
-	for k, v := range txa {
-		if k == 5 {
-			// not too fast..
-			time.Sleep(2 * time.Second)
-			k = 0
-		}
-		go func(cx context.Context, tx string) {
-			go func(tx string) {
-				if err := c.broadcastBlockchain(cx, tx); err != nil {
-					log.Error(err)
-				}
-			}(tx)
-			go func(tx string) {
-				if err := c.broadcastInsight(cx, tx); err != nil {
-					log.Error(err)
-				}
-			}(tx)
-			go func(tx string) {
-				if err := c.broadcastBTC(cx, tx); err != nil {
-					log.Error(err)
-				}
-			}(tx)
-			r := Rsp{tx: tx}
-			r.err = c.BroadcastTX(cx, tx)
-			ch <- r
-		}(cx, v)
+	ra, err := c.BroadcastResults(cx, txa...)
+	if err != nil {
+		return nil, err
 	}
 	m := make(map[string]error)
-	for rsp := range ch {
-		m[rsp.tx] = rsp.err
-		if rsp.err != nil {
-			log.Error(rsp.err)
-		}
-		if len(m) == len(txa) {
-			break
-		}
+	for _, r := range ra {
+		m[r.Tx] = r.Err()
 	}
-	close(ch)
 	return m, nil
 }
 
-func (c *Client) BroadcastTX(cx context.Context, tx string) error {
-	URL := fmt.Sprintf("%s/insight-api/tx/send", c.endpoint)
-	type Req struct {
-		RAWTX string `json:"rawtx"`
-	}
-	rb, err := json.Marshal(&Req{RAWTX: tx})
-	if err != nil {
-		return err
-	}
-	req, err := http.NewRequest("POST", URL, bytes.NewReader(rb))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	ctx, _ := context.WithTimeout(cx, timeout)
-	req = req.WithContext(ctx)
-	b, status, err := c.Do(req)
-	if err != nil {
-		return err
-	}
-	if status != 200 {
-		err = fmt.Errorf("Status %s, body %s", status, b)
-		return err
-	}
-	return nil
+// BroadcastResults is like Broadcast but returns the txid and the status of
+// every endpoint for each transaction.
+func (c *Client) BroadcastResults(cx context.Context, txa ...string) ([]broadcast.Result, error) {
+	return c.broadcaster.Broadcast(cx, txa...)
+}
+
+// SetBroadcastEndpoints replaces the endpoints used by Broadcast. Use Node to
+// keep the node itself in the list.
+func (c *Client) SetBroadcastEndpoints(interval time.Duration, endpoints ...broadcast.Endpoint) {
+	c.broadcaster = broadcast.New(cryptopay.BTC, interval, endpoints...)
 }
 
-func (c *Client) broadcastBlockchain(cx context.Context, tx string) error {
-	return blockchain.New(c.cl).BroadcastTX(cx, tx)
+// Node returns the broadcast endpoint of the node the client talks to.
+func (c *Client) Node() broadcast.Endpoint {
+	return broadcast.Endpoint{Name: c.endpoint, Send: c.BroadcastTX}
 }
 
-func (c *Client) broadcastInsight(cx context.Context, tx string) error {
-	URL := "https://insight.bitpay.com/api/tx/send"
+func (c *Client) BroadcastTX(cx context.Context, tx string) error {
+	URL := fmt.Sprintf("%s/insight-api/tx/send", c.endpoint)
 	type Req struct {
 		RAWTX string `json:"rawtx"`
 	}
@@ -348,43 +358,10 @@ func (c *Client) broadcastInsight(cx context.Context, tx string) error {
 	req = req.WithContext(ctx)
 	b, status, err := c.Do(req)
 	if err != nil {
-		log.Error(err)
 		return err
 	}
 	if status != 200 {
-		return fmt.Errorf("Status %s, body %s", status, b)
-	}
-	return nil
-}
-
-func (c *Client) broadcastBTC(cx context.Context, tx string) error {
-	type RT struct {
-		Error string `json:"err_msg"`
-	}
-	uv := url.Values{}
-	uv.Set("rawhex", tx)
-	URL := "https://btc.com/api/v1/tools/tx-publish"
-	req, err := http.NewRequest("POST", URL, strings.NewReader(uv.Encode()))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	ctx, _ := context.WithTimeout(cx, timeout)
-	req = req.WithContext(ctx)
-	b, status, err := c.Do(req)
-	if err != nil {
-		return err
-	}
-	if status != 200 {
-		return fmt.Errorf("Status %s, body %s", status, b)
-	}
-	var r RT
-	if err = json.Unmarshal(b, &r); err != nil {
-		return err
-	}
-	if r.Error != "" {
-		err = fmt.Errorf("err %#v", r)
-		log.Error(err)
+		err = fmt.Errorf("Status %v, body %s", status, b)
 		return err
 	}
 	return nil
@@ -0,0 +1,16 @@
+package btcrpc
+
+import (
+	"github.com/winteraz/cryptopay/internal/contract"
+	"github.com/winteraz/cryptopay/wallet"
+	"net/http"
+	"testing"
+)
+
+func TestContract(t *testing.T) {
+	contract.Run(t, "insight", "https://insight.bitpay.com", contract.BTC, func(url string, cl *http.Client) wallet.Requester {
+		c := New(url, cl)
+		c.SetBroadcastEndpoints(0, c.Node())
+		return c
+	})
+}
@@ -0,0 +1,149 @@
+package chaintest
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/winteraz/cryptopay"
+)
+
+func (c *Chain) fundBTC(addr string, amount uint64) (string, error) {
+	script, err := payToAddr(addr)
+	if err != nil {
+		return "", err
+	}
+	c.funded++
+	tx := wire.NewMsgTx(wire.TxVersion)
+	// a coinbase like input, the counter makes the hash unique.
+	var unique [4]byte
+	binary.LittleEndian.PutUint32(unique[:], c.funded)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), unique[:], nil))
+	tx.AddTxOut(wire.NewTxOut(int64(amount), script))
+	hash := tx.TxHash()
+	c.outputs[*wire.NewOutPoint(&hash, 0)] = &output{addr: addr, amount: amount, script: script}
+	c.history[addr]++
+	var buf bytes.Buffer
+	if err = tx.Serialize(&buf); err != nil {
+		return "", err
+	}
+	c.raw[hash.String()] = hex.EncodeToString(buf.Bytes())
+	return hash.String(), nil
+}
+
+// RawTransaction returns the hex transaction txid, BTC only.
+func (c *Chain) RawTransaction(cx context.Context, txid string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.failure("RawTransaction"); err != nil {
+		return "", err
+	}
+	raw, ok := c.raw[txid]
+	if !ok {
+		return "", fmt.Errorf("Unknown transaction %s", txid)
+	}
+	return raw, nil
+}
+
+func (c *Chain) unspentBTC(addr ...string) map[string][]cryptopay.Unspent {
+	want := make(map[string]bool)
+	for _, a := range addr {
+		want[a] = true
+	}
+	m := make(map[string][]cryptopay.Unspent)
+	for op, o := range c.outputs {
+		if !want[o.addr] {
+			continue
+		}
+		m[o.addr] = append(m[o.addr], cryptopay.Unspent{
+			Tx:            op.Hash.String(),
+			N:             op.Index,
+			Amount:        o.amount,
+			Confirmations: c.confirmations(o.height),
+			Script:        hex.EncodeToString(o.script),
+		})
+	}
+	return m
+}
+
+// broadcastBTC checks that every input spends an unspent output with a valid
+// signature and that the outputs don't exceed the inputs.
+func (c *Chain) broadcastBTC(raw string) error {
+	b, err := hex.DecodeString(raw)
+	if err != nil {
+		return err
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err = tx.Deserialize(bytes.NewReader(b)); err != nil {
+		return err
+	}
+	if len(tx.TxIn) == 0 || len(tx.TxOut) == 0 {
+		return fmt.Errorf("tx %s has no inputs or outputs", tx.TxHash())
+	}
+	var in uint64
+	seen := make(map[wire.OutPoint]bool)
+	for i, txIn := range tx.TxIn {
+		op := txIn.PreviousOutPoint
+		if seen[op] {
+			return fmt.Errorf("tx %s spends %s twice", tx.TxHash(), op)
+		}
+		seen[op] = true
+		prev, ok := c.outputs[op]
+		if !ok {
+			return fmt.Errorf("tx %s: missing inputs or double spend of %s", tx.TxHash(), op)
+		}
+		vm, err := txscript.NewEngine(prev.script, tx, i, txscript.StandardVerifyFlags,
+			nil, nil, int64(prev.amount))
+		if err != nil {
+			return err
+		}
+		if err = vm.Execute(); err != nil {
+			return fmt.Errorf("tx %s input %v: %v", tx.TxHash(), i, err)
+		}
+		in += prev.amount
+	}
+	var out uint64
+	for _, txOut := range tx.TxOut {
+		if txOut.Value < 0 {
+			return fmt.Errorf("tx %s has a negative output", tx.TxHash())
+		}
+		out += uint64(txOut.Value)
+	}
+	if out > in {
+		return fmt.Errorf("tx %s spends %v but has only %v", tx.TxHash(), out, in)
+	}
+	touched := make(map[string]bool)
+	for op := range seen {
+		touched[c.outputs[op].addr] = true
+		delete(c.outputs, op)
+	}
+	hash := tx.TxHash()
+	c.raw[hash.String()] = raw
+	for n, txOut := range tx.TxOut {
+		o := &output{amount: uint64(txOut.Value), script: txOut.PkScript}
+		_, addrs, _, err := txscript.ExtractPkScriptAddrs(txOut.PkScript, &chaincfg.MainNetParams)
+		if err == nil && len(addrs) == 1 {
+			o.addr = addrs[0].EncodeAddress()
+			touched[o.addr] = true
+		}
+		c.outputs[*wire.NewOutPoint(&hash, uint32(n))] = o
+	}
+	for addr := range touched {
+		c.history[addr]++
+	}
+	return nil
+}
+
+func payToAddr(addr string) ([]byte, error) {
+	a, err := btcutil.DecodeAddress(addr, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, err
+	}
+	return txscript.PayToAddrScript(a)
+}
@@ -0,0 +1,271 @@
+// Package chaintest is an in-memory blockchain implementing wallet.Requester
+// for tests. Addresses are funded with Fund, transactions wait in the mempool
+// until Mine is called and every broadcast transaction is validated (BTC
+// scripts and double spends, ETH signatures, nonces and balances) before it's
+// accepted. Fail injects errors into the next calls of a method and Reorg
+// removes blocks.
+package chaintest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/winteraz/cryptopay"
+	"sync"
+)
+
+type Chain struct {
+	coin cryptopay.CoinType
+
+	mu       sync.Mutex
+	height   uint64
+	history  map[string]uint64 // address -> number of transactions
+	failures map[string][]error
+
+	// BTC
+	outputs map[wire.OutPoint]*output
+	funded  uint32            // makes every funding transaction unique
+	raw     map[string]string // txid -> hex transaction
+	// ETH
+	accounts map[string]*account
+	mempool  []*types.Transaction
+	pending  []funding
+}
+
+type output struct {
+	addr   string
+	amount uint64
+	script []byte
+	height uint64 // 0 while in the mempool
+}
+
+type funding struct {
+	addr   string
+	amount uint64
+}
+
+type account struct {
+	balance uint64 // wei
+	nonce   uint64
+	height  uint64 // block of the last balance change
+}
+
+func New(coin cryptopay.CoinType) (*Chain, error) {
+	switch coin {
+	case cryptopay.BTC, cryptopay.ETH:
+	default:
+		return nil, errors.New("unsupported coin " + coin.String())
+	}
+	return &Chain{
+		coin:     coin,
+		height:   1,
+		history:  make(map[string]uint64),
+		failures: make(map[string][]error),
+		outputs:  make(map[wire.OutPoint]*output),
+		raw:      make(map[string]string),
+		accounts: make(map[string]*account),
+	}, nil
+}
+
+// Fail makes the next len(errs) calls of method return errs in order.
+// method is the name of a wallet.Requester method or BlockHeight.
+func (c *Chain) Fail(method string, errs ...error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures[method] = append(c.failures[method], errs...)
+}
+
+// failure pops the next injected error. c.mu must be held.
+func (c *Chain) failure(method string) error {
+	errs := c.failures[method]
+	if len(errs) == 0 {
+		return nil
+	}
+	c.failures[method] = errs[1:]
+	return errs[0]
+}
+
+// Fund sends amount to addr from nowhere. The funds are unconfirmed until
+// the next Mine. It returns the funding txid (BTC only).
+func (c *Chain) Fund(addr string, amount uint64) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.coin {
+	case cryptopay.BTC:
+		return c.fundBTC(addr, amount)
+	case cryptopay.ETH:
+		return "", c.fundETH(addr, amount)
+	}
+	return "", errors.New("unsupported coin")
+}
+
+// Mine adds n blocks confirming every transaction in the mempool.
+func (c *Chain) Mine(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := 0; i < n; i++ {
+		c.height++
+		for _, o := range c.outputs {
+			if o.height == 0 {
+				o.height = c.height
+			}
+		}
+		for _, f := range c.pending {
+			a := c.account(f.addr)
+			a.balance += f.amount
+			a.height = c.height
+		}
+		for _, tx := range c.mempool {
+			c.applyETH(tx)
+		}
+		c.pending, c.mempool = nil, nil
+	}
+}
+
+// Reorg removes the last n blocks (BTC only). Their transactions go back to
+// the mempool except the funding transactions in drop, which the new chain
+// doesn't have, like a double spent payment.
+func (c *Chain) Reorg(n int, drop ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.coin != cryptopay.BTC {
+		return errors.New("unsupported coin " + c.coin.String())
+	}
+	if uint64(n) >= c.height {
+		return fmt.Errorf("can't remove %v blocks of %v", n, c.height)
+	}
+	c.height -= uint64(n)
+	dropped := make(map[string]bool)
+	for _, tx := range drop {
+		dropped[tx] = true
+	}
+	for op, o := range c.outputs {
+		if o.height <= c.height {
+			continue
+		}
+		o.height = 0
+		if dropped[op.Hash.String()] {
+			delete(c.outputs, op)
+			delete(c.raw, op.Hash.String())
+		}
+	}
+	return nil
+}
+
+// Balance returns the confirmed and unconfirmed funds of addr.
+func (c *Chain) Balance(addr string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.coin == cryptopay.ETH {
+		if a, ok := c.accounts[addr]; ok {
+			return a.balance
+		}
+		return 0
+	}
+	var total uint64
+	for _, o := range c.outputs {
+		if o.addr == addr {
+			total += o.amount
+		}
+	}
+	return total
+}
+
+func (c *Chain) BlockHeight(cx context.Context) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.failure("BlockHeight"); err != nil {
+		return 0, err
+	}
+	return c.height, nil
+}
+
+func (c *Chain) HasTransactions(cx context.Context, addr ...string) (map[string]bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.failure("HasTransactions"); err != nil {
+		return nil, err
+	}
+	if len(addr) == 0 {
+		return nil, errors.New("Invalid address list")
+	}
+	m := make(map[string]bool)
+	for _, a := range addr {
+		m[a] = c.history[a] > 0
+	}
+	return m, nil
+}
+
+func (c *Chain) CountTransactions(cx context.Context, addr ...string) (map[string]uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.failure("CountTransactions"); err != nil {
+		return nil, err
+	}
+	if len(addr) == 0 {
+		return nil, errors.New("Invalid address list")
+	}
+	m := make(map[string]uint64)
+	for _, a := range addr {
+		if c.coin == cryptopay.ETH {
+			// the nonce, as eth_getTransactionCount on the latest block.
+			if acc, ok := c.accounts[a]; ok {
+				m[a] = acc.nonce
+				continue
+			}
+			m[a] = 0
+			continue
+		}
+		m[a] = c.history[a]
+	}
+	return m, nil
+}
+
+func (c *Chain) Unspent(cx context.Context, addr ...string) (map[string][]cryptopay.Unspent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.failure("Unspent"); err != nil {
+		return nil, err
+	}
+	if len(addr) == 0 {
+		return nil, errors.New("Invalid address list")
+	}
+	if c.coin == cryptopay.ETH {
+		return c.unspentETH(addr...), nil
+	}
+	return c.unspentBTC(addr...), nil
+}
+
+// Broadcast validates every transaction and adds the valid ones to the
+// mempool. Invalid transactions are reported in the map.
+func (c *Chain) Broadcast(cx context.Context, txa ...string) (map[string]error, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.failure("Broadcast"); err != nil {
+		return nil, err
+	}
+	if len(txa) == 0 {
+		return nil, errors.New("Invalid transaction list")
+	}
+	m := make(map[string]error)
+	for _, tx := range txa {
+		switch c.coin {
+		case cryptopay.BTC:
+			m[tx] = c.broadcastBTC(tx)
+		case cryptopay.ETH:
+			m[tx] = c.broadcastETH(tx)
+		default:
+			m[tx] = fmt.Errorf("unsupported coin %s", c.coin)
+		}
+	}
+	return m, nil
+}
+
+func (c *Chain) confirmations(height uint64) int {
+	if height == 0 {
+		return 0
+	}
+	return int(c.height - height + 1)
+}
@@ -0,0 +1,111 @@
+package chaintest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/winteraz/cryptopay"
+	"math/big"
+	"strings"
+)
+
+// The chain id of the signer used by cryptopay.MakeTransactionETH.
+var chainID = big.NewInt(1)
+
+// account returns the state of an EIP55 encoded address. c.mu must be held.
+func (c *Chain) account(addr string) *account {
+	a, ok := c.accounts[addr]
+	if !ok {
+		a = &account{}
+		c.accounts[addr] = a
+	}
+	return a
+}
+
+func (c *Chain) fundETH(addr string, amount uint64) error {
+	if !strings.HasPrefix(addr, "0x") || len(addr) != 42 {
+		return fmt.Errorf("invalid address %q", addr)
+	}
+	c.pending = append(c.pending, funding{addr: addr, amount: amount})
+	c.history[addr]++
+	return nil
+}
+
+func (c *Chain) unspentETH(addr ...string) map[string][]cryptopay.Unspent {
+	m := make(map[string][]cryptopay.Unspent)
+	for _, a := range addr {
+		acc, ok := c.accounts[a]
+		if !ok {
+			// like ethrpc every requested address has a balance.
+			m[a] = []cryptopay.Unspent{cryptopay.Unspent{}}
+			continue
+		}
+		m[a] = []cryptopay.Unspent{cryptopay.Unspent{
+			Amount:        acc.balance,
+			Confirmations: c.confirmations(acc.height),
+		}}
+	}
+	return m
+}
+
+// broadcastETH checks the signature, the nonce and that the sender can pay
+// for the value and the gas, counting the transactions already in the mempool.
+func (c *Chain) broadcastETH(raw string) error {
+	b, err := hex.DecodeString(strings.TrimPrefix(raw, "0x"))
+	if err != nil {
+		return err
+	}
+	tx := new(types.Transaction)
+	if err = tx.DecodeRLP(rlp.NewStream(bytes.NewReader(b), 0)); err != nil {
+		return err
+	}
+	from, err := types.Sender(types.NewEIP155Signer(chainID), tx)
+	if err != nil {
+		return err
+	}
+	if tx.To() == nil {
+		return fmt.Errorf("tx %s creates a contract", tx.Hash().Hex())
+	}
+	nonce, spent := c.accounts[from.Hex()].confirmedNonce(), new(big.Int)
+	for _, p := range c.mempool {
+		if s, _ := types.Sender(types.NewEIP155Signer(chainID), p); s == from {
+			nonce++
+			spent.Add(spent, p.Cost())
+		}
+	}
+	if tx.Nonce() != nonce {
+		return fmt.Errorf("tx %s: invalid nonce %v, expected %v", tx.Hash().Hex(), tx.Nonce(), nonce)
+	}
+	var balance uint64
+	if acc, ok := c.accounts[from.Hex()]; ok {
+		balance = acc.balance
+	}
+	if spent.Add(spent, tx.Cost()).Cmp(new(big.Int).SetUint64(balance)) > 0 {
+		return fmt.Errorf("tx %s: insufficient funds for gas * price + value", tx.Hash().Hex())
+	}
+	c.mempool = append(c.mempool, tx)
+	c.history[from.Hex()]++
+	c.history[tx.To().Hex()]++
+	return nil
+}
+
+// applyETH moves the funds of a validated transaction. c.mu must be held.
+func (c *Chain) applyETH(tx *types.Transaction) {
+	from, _ := types.Sender(types.NewEIP155Signer(chainID), tx)
+	sender := c.account(from.Hex())
+	sender.balance -= tx.Cost().Uint64()
+	sender.nonce++
+	sender.height = c.height
+	to := c.account(tx.To().Hex())
+	to.balance += tx.Value().Uint64()
+	to.height = c.height
+}
+
+func (a *account) confirmedNonce() uint64 {
+	if a == nil {
+		return 0
+	}
+	return a.nonce
+}
@@ -1,13 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	log "github.com/golang/glog"
 	"github.com/winteraz/cryptopay"
 	"github.com/winteraz/cryptopay/cmd/util"
+	"github.com/winteraz/cryptopay/qrcode"
+	"github.com/winteraz/cryptopay/signer"
+	"io/ioutil"
+	"net/http"
+	"os"
 	"strings"
+	"time"
 )
 
 func trimString(s ...*string) {
@@ -21,6 +30,9 @@ func trimString(s ...*string) {
 func main() {
 	pass := flag.String("pass", "", "password to harden the key generation")
 	mnemonicIn := flag.String("mnemonic", "", "if set it will generate the keys from the mnemonic")
+	keystoreDir := flag.String("keystore", defaultKeystore(), "the directory of the encrypted wallets")
+	walletName := flag.String("wallet", "", "use the mnemonic and passphrase of this keystore wallet instead of mnemonic and pass, the password is prompted")
+	saveName := flag.String("save", "", "save the mnemonic and pass in the keystore under this name, they are prompted if mnemonic is empty")
 	genAddr := flag.Bool("addr", false, "if set it will addresses(public and private")
 	depth := flag.Int("depth", 10, "depth of address generation")
 	accts := flag.Int("accts", 10, "number of accounts")
@@ -29,35 +41,206 @@ func main() {
 	broadcast := flag.Bool("broadcast", false, "broadcast the transactions (if move is used)")
 	move := flag.Bool("move", false, "move the wallet to a new address")
 	toAddr := flag.String("toAddr", "", "the address to send the wallet to")
+	sweep := flag.String("sweep", "", "move the funds of this WIF or hex ethereum key of coin to toAddr, an xpub")
+	sweep38 := flag.String("sweep38", "", "move the funds of this BIP38 key to toAddr, an xpub, the passphrase is prompted")
+	encrypt38 := flag.String("encrypt38", "", "encrypt this WIF key with BIP38 for paper wallets, the passphrase is prompted")
 
 	balance := flag.Bool("balance", false, "get the balance")
+	every := flag.Duration("every", 0, "with balance, print it again every this duration, with the payments reverted by reorgs meanwhile")
+	recoverFlag := flag.Bool("recover", false, "scan the BTC and ETH paths of every known wallet for the funds of the mnemonic, accts is the account gap and depth the address gap")
 	xpub := flag.String("xpub", "", "xpub to get the balance from")
 
-	remoteHost := flag.String("remoteHost", "", "the hostname of the RPC endpoint")
+	watchFlag := flag.Bool("watch", false, "print the payments to the external addresses as they happen")
+	confirmations := flag.Int("confirmations", 0, "confirmations funds need, 0 uses the default of the coin")
+
+	remoteHost := flag.String("remoteHost", "", "the hostname of the RPC endpoint, a comma separated list fails over between hosts")
+	quorum := flag.Int("quorum", 0, "number of remote hosts that must agree on balances and unspent outputs")
+
+	uri := flag.String("uri", "", "parse a bitcoin: or ethereum: payment URI of the coin and print it")
+
+	qrText := flag.String("qr", "", "print the QR code of an address, xpub or payment URI")
+	qrFile := flag.String("qrFile", "", "print the QR codes of a file, like a PSBT, split in BBQr parts")
+	qrPNG := flag.String("png", "", "write the QR code of qr or qrFile to this PNG file, an animated GIF if it's split")
+	qrGen := flag.Bool("qrcode", false, "print the QR codes of the generated xpubs and payment URIs too")
+	ascii := flag.Bool("ascii", false, "print the QR codes with ASCII instead of UTF-8 blocks")
+
+	slip39 := flag.String("slip39", "", "make a new master key split in SLIP-39 groups of shares, like 1/1,2/3,3/5 for three groups, pass is the passphrase")
+	groupThreshold := flag.Int("groupThreshold", 1, "the number of slip39 groups needed to recover the master key")
+	slip39File := flag.String("slip39File", "", "recover the master key of the SLIP-39 shares of this file, one per line, pass is the passphrase")
+
+	bip85 := flag.String("bip85", "", "print the BIP85 child of the mnemonic: mnemonic, wif, xprv or hex")
+	bip85Index := flag.Int("index", 0, "the index of the bip85 child")
+	length := flag.Int("length", 0, "the words of a new (12 to 24) or bip85 (12, 18 or 24) mnemonic or the bytes of bip85 hex (16 to 64), 0 uses 24 words or 64 bytes")
+	lang := flag.String("lang", "english", "the language of a new or bip85 mnemonic")
+	repair := flag.Bool("repair", false, "print the valid mnemonics one mistyped or missing word away from mnemonic")
+	legacySeed := flag.Bool("legacySeed", false, "derive the keys of the mnemonic and pass without normalizing them, like the wallets made before with a non-ASCII pass")
+
+	message := flag.String("message", "", "sign this message with the key of signPath, for eip712 the file of the typed data JSON")
+	signType := flag.String("signType", "p2wpkh", "the address signing message: p2pkh, p2sh, p2wpkh, p2tr, eth (personal_sign) or eip712")
+	signPath := flag.String("signPath", "m/84'/0'/0'/0/0", "the derivation path of the key signing message")
+	verify := flag.String("verify", "", "verify this signature of message by address instead of signing")
+	address := flag.String("address", "", "the address of the signature to verify")
+
+	cosigners := flag.String("cosigners", "", "the comma separated account keys, like [fingerprint/48'/0'/0'/2']Zpub..., of a bitcoin multisig wallet for balance, watch and move, which makes PSBTs signed by the mnemonic if it's set")
+	m := flag.Int("m", 2, "the signatures the multisig wallet needs")
+	multisigType := flag.String("multisigType", "p2wsh", "the multisig wallet script: p2sh, p2sh-p2wsh or p2wsh")
+	signPSBT := flag.String("signPSBT", "", "sign the inputs of the mnemonic in the PSBT of this file, printing it")
+	finalizePSBT := flag.String("finalizePSBT", "", "print the raw transaction of the signed PSBTs of this file, one per line, to broadcast")
+
+	serveSigner := flag.String("serveSigner", "", "serve the signer of the account 0 of coin of the mnemonic on this address, like localhost:8335")
+	signerURL := flag.String("signer", "", "the URL of the serveSigner signing the transactions of xpub for move")
+	signerToken := flag.String("signerToken", "", "the bearer token of the signer")
+	maxAmount := flag.Uint64("maxAmount", 0, "the most a transaction the signer signs spends, 0 is unlimited")
+	dailyLimit := flag.Uint64("dailyLimit", 0, "the most the transactions the signer signed in 24 hours spend, 0 is unlimited")
+	allow := flag.String("allow", "", "the comma separated addresses the signer pays, any if empty")
+
+	path := flag.String("path", "", "print the keys and addresses of this derivation path of the mnemonic, like m/84'/0'/0'/0/1")
 	flag.Parse()
 	defer log.Flush()
 	trimString(mnemonicIn, pass)
+	switch {
+	case *saveName != "":
+		if err := saveWallet(*keystoreDir, *saveName, *mnemonicIn, *pass); err != nil {
+			log.Error(err)
+		}
+		return
+	case *walletName != "":
+		var err error
+		*mnemonicIn, *pass, err = loadWallet(*keystoreDir, *walletName)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+	}
+	cryptopay.LegacySeed = *legacySeed
+	if *mnemonicIn != "" && !*legacySeed && cryptopay.SeedChanged(*mnemonicIn, *pass) {
+		fmt.Fprintln(os.Stderr, "The mnemonic or pass isn't normalized, use -legacySeed for a wallet made before with them.")
+	}
+	switch {
+	case *uri != "":
+		uriFN(*uri, cryptopay.CoinType(*coin))
+		return
+	case *qrText != "" || *qrFile != "":
+		qrFN(*qrText, *qrFile, *qrPNG, *ascii)
+		return
+	case *path != "":
+		pathFN(*mnemonicIn, *pass, *path)
+		return
+	case *signPSBT != "":
+		signPSBTFN(*mnemonicIn, *pass, *signPSBT)
+		return
+	case *finalizePSBT != "":
+		finalizePSBTFN(*finalizePSBT)
+		return
+	case *serveSigner != "":
+		policy := signer.Policy{MaxAmount: *maxAmount, DailyLimit: *dailyLimit, Token: *signerToken}
+		if *allow != "" {
+			policy.Allowed = strings.Split(*allow, ",")
+		}
+		serveSignerFN(*mnemonicIn, *pass, cryptopay.CoinType(*coin), *serveSigner, policy)
+		return
+	case *verify != "":
+		verifyFN(*address, *signType, *message, *verify)
+		return
+	case *message != "":
+		signFN(*mnemonicIn, *pass, *signPath, *signType, *message)
+		return
+	case *repair:
+		repairFN(*mnemonicIn)
+		return
+	case *bip85 != "":
+		bip85FN(*mnemonicIn, *pass, *bip85, *lang, *length, *bip85Index)
+		return
+	case *encrypt38 != "":
+		encrypt38FN(*encrypt38)
+		return
+	case *slip39 != "":
+		slip39FN(*slip39, *groupThreshold, *pass)
+		return
+	case *slip39File != "":
+		slip39FileFN(*slip39File, *pass)
+		return
+	}
 	if *remoteHost == "" {
 		log.Errorf("Invalid remoteHost %v", *remoteHost)
 		return
 	}
 	cx := context.Background()
+	var cosignerKeys []string
+	var msType cryptopay.MultisigType
+	if *cosigners != "" {
+		cosignerKeys = strings.Split(*cosigners, ",")
+		var err error
+		if msType, err = cryptopay.ParseMultisigType(*multisigType); err != nil {
+			log.Error(err)
+			return
+		}
+	}
 	switch {
+	case *move && (*cosigners != "" || *signerURL != ""):
+		req := &util.Request{
+			Mnemonic:       *mnemonicIn,
+			Passwd:         *pass,
+			ExtendedPublic: *xpub,
+			Coin:           cryptopay.CoinType(*coin),
+			Quorum:         *quorum,
+			Confirmations:  *confirmations,
+			Cosigners:      cosignerKeys,
+			M:              *m,
+			MultisigType:   msType,
+			SignerURL:      *signerURL,
+			SignerToken:    *signerToken,
+		}
+		movePublicFN(cx, req, *remoteHost, *toAddr, uint32(*depth), *broadcast)
 	case *balance:
 		req := &util.Request{
 			Passwd:   *pass,
 			Mnemonic:       *mnemonicIn,
 			ExtendedPublic: *xpub,
 			Coin:           cryptopay.CoinType(*coin),
+			Quorum:         *quorum,
+			Confirmations:  *confirmations,
+			Cosigners:      cosignerKeys,
+			M:              *m,
+			MultisigType:   msType,
 		}
-		balanceFN(cx, req, *remoteHost, uint32(*accts), uint32(*depth))
+		balanceFN(cx, req, *remoteHost, uint32(*accts), uint32(*depth), *every)
+	case *recoverFlag:
+		req := &util.Request{
+			Mnemonic:      *mnemonicIn,
+			Passwd:        *pass,
+			Quorum:        *quorum,
+			Confirmations: *confirmations,
+		}
+		recoverFN(cx, req, *remoteHost, uint32(*accts), uint32(*depth))
+	case *sweep != "":
+		req := &util.Request{Coin: cryptopay.CoinType(*coin), Quorum: *quorum}
+		sweepFN(cx, req, *remoteHost, *sweep, *toAddr, false, *broadcast)
+	case *sweep38 != "":
+		req := &util.Request{Coin: cryptopay.BTC, Quorum: *quorum}
+		sweepFN(cx, req, *remoteHost, *sweep38, *toAddr, true, *broadcast)
 	case *move:
 		req := &util.Request{
-			Mnemonic: *mnemonicIn,
-			Passwd:   *pass,
-			Coin:     cryptopay.CoinType(*coin),
+			Mnemonic:      *mnemonicIn,
+			Passwd:        *pass,
+			Coin:          cryptopay.CoinType(*coin),
+			Quorum:        *quorum,
+			Confirmations: *confirmations,
 		}
 		moveWallet(cx, req, *remoteHost, *toAddr, uint32(*accts), uint32(*depth), *broadcast)
+	case *watchFlag:
+		req := &util.Request{
+			Mnemonic:       *mnemonicIn,
+			Passwd:         *pass,
+			ExtendedPublic: *xpub,
+			Coin:           cryptopay.CoinType(*coin),
+			Quorum:         *quorum,
+			Confirmations:  *confirmations,
+			Cosigners:      cosignerKeys,
+			M:              *m,
+			MultisigType:   msType,
+		}
+		watchFN(cx, req, *remoteHost, uint32(*depth))
 	case *genAddr:
 		req := &util.Request{
 			Mnemonic: *mnemonicIn,
@@ -66,7 +249,23 @@ func main() {
 		}
 		generateAddr(cx, req, *remoteHost, uint32(*accts), uint32(*depth))
 	default:
-		generate(cx, mnemonicIn, pass)
+		generate(cx, mnemonicIn, pass, *length, *lang, *qrGen, *ascii)
+	}
+}
+
+func recoverFN(cx context.Context, req *util.Request, remoteHost string, accts, depth uint32) {
+	found, err := req.Recover(cx, remoteHost, accts, depth)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if len(found) == 0 {
+		fmt.Println("no address with history")
+		return
+	}
+	for _, f := range found {
+		fmt.Printf("%s %s %s %q confirmed %v, incoming %v, locked %v\n", f.Coin, f.Scheme, f.Path,
+			f.Address, f.Balance.Confirmed, f.Balance.Incoming, f.Balance.Locked)
 	}
 }
 
@@ -104,12 +303,19 @@ func generateAddr(cx context.Context, req *util.Request, remoteHost string, acct
 	log.Infof("Private addresses %q", sa)
 }
 
-func generate(cx context.Context, mnemonicIn, pass *string) {
+func generate(cx context.Context, mnemonicIn, pass *string, words int, lang string, qr, ascii bool) {
 	var priv *cryptopay.Key
 	var err error
 	var mnemonic string
 	if *mnemonicIn == "" {
-		priv, _, mnemonic, err = cryptopay.NewMaster(*pass)
+		var l cryptopay.Language
+		if l, err = cryptopay.ParseLanguage(lang); err != nil {
+			log.Fatal(err)
+		}
+		if words == 0 {
+			words = 24
+		}
+		priv, _, mnemonic, err = cryptopay.NewMasterLanguage(*pass, words, l)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -150,8 +356,479 @@ func generate(cx context.Context, mnemonicIn, pass *string) {
 		fmt.Printf("masterKey(bip-32/base58 formt)  %q\n", priv.Base58())
 		fmt.Printf("BIP32 Account Extended Public Key %q\n", extendedAccountPub.Base58())
 		fmt.Printf("first child External private %q\n", childPrivate)
-		fmt.Printf("first child External address %q\n\n", childPublic)
+		fmt.Printf("first child External address %q\n", childPublic)
+		uri := (&cryptopay.PaymentURI{Coin: coin, Address: childPublic}).String()
+		fmt.Printf("first child payment URI %s\n", uri)
+		if coin == cryptopay.BTC {
+			printAccounts(priv, account)
+		}
+		fmt.Println()
+		if !qr {
+			continue
+		}
+		for _, text := range []string{extendedAccountPub.Base58(), uri} {
+			fmt.Printf("%s\n", text)
+			if err := qrcode.Terminal(os.Stdout, text, ascii); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
+
+// movePublicFN prints the transactions moving the wallet of the remote
+// signer, or the PSBTs moving the multisig wallet for the other cosigners
+// to sign.
+func movePublicFN(cx context.Context, req *util.Request, remoteHost, toAddrPub string, addressGap uint32, broadcast bool) {
+	txa, err := req.MovePublic(cx, remoteHost, toAddrPub, addressGap)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for _, tx := range txa {
+		fmt.Println(tx)
+	}
+	if !broadcast || len(txa) == 0 || len(req.Cosigners) != 0 {
+		return
+	}
+	br, err := req.Broadcaster(cx, remoteHost)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	txErr, err := br.Broadcast(cx, txa...)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for tx, err := range txErr {
+		if err != nil {
+			log.Errorf("TX %s, err %v", tx, err)
+		}
+	}
+}
+
+// serveSignerFN signs the transactions of the account 0 of coin of the
+// mnemonic allowed by policy, for the wallets of its xpub.
+func serveSignerFN(mnemonic, pass string, coin cryptopay.CoinType, addr string, policy signer.Policy) {
+	master, _, err := cryptopay.NewFromMnemonic(mnemonic, pass)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	account, err := master.DeriveExtendedAccountKey(true, coin, 0)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	pub, err := master.DeriveExtendedAccountKey(false, coin, 0)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	fmt.Printf("%s signer of %s on %s\n", coin, pub.Base58(), addr)
+	if err = http.ListenAndServe(addr, signer.NewServer(account, coin, policy)); err != nil {
+		log.Error(err)
+	}
+}
+
+// signPSBTFN signs the PSBT of file with the master key of the mnemonic.
+func signPSBTFN(mnemonic, pass, file string) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	p, err := cryptopay.ParsePSBT(bytes.TrimSpace(b))
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	master, _, err := cryptopay.NewFromMnemonic(mnemonic, pass)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	n, err := master.SignPSBT(p)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	log.Infof("signed %v of %v inputs", n, len(p.Inputs))
+	fmt.Println(p.String())
+}
+
+// finalizePSBTFN combines the signatures of the PSBTs of file, one per
+// cosigner, and prints the transaction.
+func finalizePSBTFN(file string) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	var p *cryptopay.PSBT
+	for _, line := range strings.Fields(string(b)) {
+		other, err := cryptopay.ParsePSBT([]byte(line))
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		if p == nil {
+			p = other
+		} else if err = p.Combine(other); err != nil {
+			log.Error(err)
+			return
+		}
+	}
+	if p == nil {
+		log.Errorf("No PSBT in %s", file)
+		return
+	}
+	if err = p.Finalize(); err != nil {
+		log.Error(err)
+		return
+	}
+	tx, err := p.Extract()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	fmt.Println(hex.EncodeToString(tx))
+}
+
+// signFN signs the message to prove the ownership of the address of typ of
+// the key of path.
+func signFN(mnemonic, pass, path, typ, message string) {
+	p, err := cryptopay.ParsePath(path)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	master, _, err := cryptopay.NewFromMnemonic(mnemonic, pass)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	k, err := master.Derive(p)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	var addr, sig string
+	switch typ {
+	case "eth", "eip712":
+		if addr, err = k.PayAddress(cryptopay.ETH); err != nil {
+			break
+		}
+		if typ == "eth" {
+			sig, err = k.SignMessageETH([]byte(message))
+			break
+		}
+		var td *cryptopay.TypedData
+		if td, err = readTypedData(message); err == nil {
+			sig, err = k.SignTypedData(td)
+		}
+	default:
+		var t cryptopay.AddressType
+		if t, err = parseAddressType(typ); err != nil {
+			break
+		}
+		if addr, err = k.ScriptAddress(t, cryptopay.MainNet); err != nil {
+			break
+		}
+		sig, err = k.SignMessageBTC(t, cryptopay.MainNet, message)
+	}
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	fmt.Printf("address %s\nsignature %s\n", addr, sig)
+}
+
+// verifyFN checks the signature of message by address, typ tells the
+// ethereum formats apart.
+func verifyFN(address, typ, message, sig string) {
+	var err error
+	switch typ {
+	case "eth":
+		err = cryptopay.VerifyMessageETH(address, []byte(message), sig)
+	case "eip712":
+		var td *cryptopay.TypedData
+		if td, err = readTypedData(message); err == nil {
+			err = cryptopay.VerifyTypedData(address, td, sig)
+		}
+	default:
+		err = cryptopay.VerifyMessageBTC(address, message, sig)
+	}
+	if err != nil {
+		log.Error(err)
+		return
 	}
+	fmt.Printf("the signature is valid, %s signed the message\n", address)
+}
+
+func readTypedData(file string) (*cryptopay.TypedData, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return cryptopay.ParseTypedData(b)
+}
+
+func parseAddressType(s string) (cryptopay.AddressType, error) {
+	for _, t := range []cryptopay.AddressType{cryptopay.P2PKH, cryptopay.P2SH, cryptopay.P2WPKH, cryptopay.P2TR} {
+		if t.String() == s {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("Invalid address type %q", s)
+}
+
+// repairFN prints the candidates of a mnemonic with a typo or a missing word.
+func repairFN(mnemonic string) {
+	_, err := cryptopay.ValidateMnemonic(mnemonic)
+	if err == nil {
+		fmt.Println("the mnemonic is valid")
+		return
+	}
+	fmt.Println(err)
+	candidates, err := cryptopay.RepairMnemonic(mnemonic)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	fmt.Printf("%v candidates, the likeliest first\n", len(candidates))
+	for _, c := range candidates {
+		fmt.Println(c)
+	}
+}
+
+// bip85FN prints the child index of the app of the mnemonic.
+func bip85FN(mnemonic, pass, app, lang string, length, index int) {
+	if index < 0 {
+		log.Errorf("Invalid index %v", index)
+		return
+	}
+	master, _, err := cryptopay.NewFromMnemonic(mnemonic, pass)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	var out string
+	switch app {
+	case "mnemonic":
+		var l cryptopay.Language
+		if l, err = cryptopay.ParseLanguage(lang); err != nil {
+			log.Error(err)
+			return
+		}
+		if length == 0 {
+			length = 24
+		}
+		out, err = master.BIP85Mnemonic(l, length, uint32(index))
+	case "wif":
+		out, err = master.BIP85WIF(uint32(index))
+	case "xprv":
+		var k *cryptopay.Key
+		if k, err = master.BIP85XPRV(uint32(index)); err == nil {
+			out = k.Base58()
+		}
+	case "hex":
+		if length == 0 {
+			length = 64
+		}
+		out, err = master.BIP85Hex(length, uint32(index))
+	default:
+		err = fmt.Errorf("Unknown bip85 app %q", app)
+	}
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	fmt.Printf("bip85 %s %v: %s\n", app, index, out)
+}
+
+// pathFN prints the key at path and its addresses of every type, to find
+// the funds of wallets which used other paths.
+func pathFN(mnemonic, pass, path string) {
+	p, err := cryptopay.ParsePath(path)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	master, _, err := cryptopay.NewFromMnemonic(mnemonic, pass)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	k, err := master.Derive(p)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	fp, err := master.Fingerprint()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	pub, err := k.Public()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	fmt.Printf("path %s, master fingerprint %08x, parent fingerprint %08x, depth %v\n",
+		p, fp, k.ParentFingerprint(), k.Depth())
+	fmt.Printf("extended public %q\n", pub.Base58())
+	for _, typ := range []cryptopay.AddressType{cryptopay.P2PKH, cryptopay.P2SH, cryptopay.P2WPKH, cryptopay.P2TR} {
+		addr, err := k.ScriptAddress(typ, cryptopay.MainNet)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		fmt.Printf("BTC %s %q\n", typ, addr)
+	}
+	if addr, err := k.PayAddress(cryptopay.ETH); err == nil {
+		fmt.Printf("ETH %q\n", addr)
+	}
+}
+
+// printAccounts prints the segwit and taproot accounts as SLIP-132 keys and
+// output descriptors, for the wallets which import them.
+// slip39FN splits a new master key in the groups, like 1/1,2/3.
+func slip39FN(spec string, groupThreshold int, pass string) {
+	var groups []cryptopay.SLIP39Group
+	for _, g := range strings.Split(spec, ",") {
+		var sg cryptopay.SLIP39Group
+		if _, err := fmt.Sscanf(g, "%d/%d", &sg.Threshold, &sg.Count); err != nil {
+			log.Errorf("Invalid group %q, want threshold/count: %v", g, err)
+			return
+		}
+		groups = append(groups, sg)
+	}
+	priv, _, shares, err := cryptopay.NewMasterSLIP39(pass, 128, groupThreshold, groups)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	fmt.Printf("%v of %v groups recover the master key\n", groupThreshold, len(groups))
+	for i, group := range shares {
+		fmt.Printf("group %v, %v of %v shares\n", i+1, groups[i].Threshold, groups[i].Count)
+		for _, m := range group {
+			fmt.Printf("  %s\n", m)
+		}
+	}
+	fmt.Printf("masterKey(bip-32/base58 formt)  %q\n", priv.Base58())
+	printAccounts(priv, 0)
+}
+
+func slip39FileFN(file, pass string) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	var mnemonics []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			mnemonics = append(mnemonics, line)
+		}
+	}
+	priv, _, err := cryptopay.NewFromSLIP39(mnemonics, pass)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	fmt.Printf("masterKey(bip-32/base58 formt)  %q\n", priv.Base58())
+	printAccounts(priv, 0)
+}
+
+func printAccounts(priv *cryptopay.Key, account uint32) {
+	for _, typ := range []cryptopay.AddressType{cryptopay.P2PKH, cryptopay.P2SH, cryptopay.P2WPKH, cryptopay.P2TR} {
+		a, err := priv.AccountKey(typ, cryptopay.BTC, account)
+		if err != nil {
+			log.Fatal(err)
+		}
+		desc, err := a.Descriptor()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if slip132, err := a.Key.SLIP132(typ, false, a.Network); err == nil {
+			fmt.Printf("%s account %q\n", typ, slip132)
+		}
+		fmt.Printf("%s descriptor %q\n", typ, desc)
+	}
+}
+
+// qrFN prints the code of text, or of the file split in BBQr parts, or
+// writes it to a PNG/GIF file.
+func qrFN(text, file, out string, ascii bool) {
+	parts := []string{text}
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		typ := byte(qrcode.Binary)
+		if s := strings.TrimSpace(string(b)); strings.HasPrefix(s, "cHNidP8") {
+			// base64 PSBT
+			if b, err = base64.StdEncoding.DecodeString(s); err != nil {
+				log.Error(err)
+				return
+			}
+			typ = qrcode.PSBT
+		} else if bytes.HasPrefix(b, []byte("psbt\xff")) {
+			typ = qrcode.PSBT
+		}
+		if parts, err = qrcode.Split(b, typ, qrcode.MaxChars); err != nil {
+			log.Error(err)
+			return
+		}
+	}
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		defer f.Close()
+		if len(parts) == 1 {
+			err = qrcode.PNG(f, parts[0], 8)
+		} else {
+			err = qrcode.GIF(f, parts, 4, 500*time.Millisecond)
+		}
+		if err != nil {
+			log.Error(err)
+		}
+		return
+	}
+	if len(parts) == 1 {
+		if err := qrcode.Terminal(os.Stdout, parts[0], ascii); err != nil {
+			log.Error(err)
+		}
+		return
+	}
+	// loop over the parts until interrupted, the scanner picks them up in
+	// any order.
+	for {
+		for i, p := range parts {
+			fmt.Print("\033[H\033[2J")
+			fmt.Printf("part %v of %v\n", i+1, len(parts))
+			if err := qrcode.Terminal(os.Stdout, p, ascii); err != nil {
+				log.Error(err)
+				return
+			}
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+func uriFN(s string, coin cryptopay.CoinType) {
+	u, err := cryptopay.ParsePaymentURI(s, coin, cryptopay.MainNet)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	fmt.Printf("%+v\n", *u)
 }
 
 func moveWallet(cx context.Context, req *util.Request, remoteHost, toAddrPub string, accountsGap, addressGap uint32, broadcast bool) {
@@ -199,13 +876,94 @@ func moveWallet(cx context.Context, req *util.Request, remoteHost, toAddrPub str
 
 }
 
-func balanceFN(cx context.Context, req *util.Request, remoteHost string, accountsGap, addressGap uint32) {
+func encrypt38FN(wif string) {
+	passphrase, err := prompt("BIP38 passphrase: ")
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	encrypted, err := cryptopay.EncryptBIP38(wif, passphrase)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	fmt.Println(encrypted)
+}
+
+func sweepFN(cx context.Context, req *util.Request, remoteHost, key, toPub string, bip38, broadcast bool) {
+	var tx string
+	var err error
+	if bip38 {
+		var passphrase string
+		if passphrase, err = prompt("BIP38 passphrase: "); err != nil {
+			log.Error(err)
+			return
+		}
+		tx, err = req.SweepBIP38(cx, remoteHost, key, passphrase, toPub)
+	} else {
+		tx, err = req.Sweep(cx, remoteHost, key, toPub)
+	}
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if tx == "" {
+		fmt.Println("nothing to sweep")
+		return
+	}
+	fmt.Printf("%s: TX %s\n", req.Coin, tx)
+	if !broadcast {
+		return
+	}
+	br, err := req.Broadcaster(cx, remoteHost)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	txErr, err := br.Broadcast(cx, tx)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if err = txErr[tx]; err != nil {
+		log.Errorf("TX %s, err %v", tx, err)
+	}
+}
 
+func balanceFN(cx context.Context, req *util.Request, remoteHost string, accountsGap, addressGap uint32, every time.Duration) {
+	show := func(balance *util.Balance) {
+		fmt.Printf(" TotalBalance %+v\n\nAmountMap %+v\n\nAmountInternalMap %+v\n",
+			balance.Total, balance.External, balance.Internal)
+		for _, r := range balance.Reverted {
+			fmt.Printf("reorged %s: %s:%v amount %v confirmations %v\n",
+				r.Address, r.Tx, r.N, r.Amount, r.Confirmations)
+		}
+	}
+	if every > 0 {
+		if err := req.WatchBalance(cx, remoteHost, accountsGap, addressGap, every, show); err != nil {
+			log.Error(err)
+		}
+		return
+	}
 	balance, err := req.Balance(cx, remoteHost, accountsGap, addressGap)
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Printf(" TotalBalance %v\n\nAmountMap %q\n\nAmountInternalMap %q",
-		balance.Total, balance.External, balance.Internal)
+	show(balance)
+}
 
+func watchFN(cx context.Context, req *util.Request, remoteHost string, addressGap uint32) {
+	w, err := req.Watcher(cx, remoteHost, 0, addressGap)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		if err := w.Run(cx); err != nil {
+			log.Error(err)
+		}
+	}()
+	for e := range w.Events() {
+		fmt.Printf("%s %s: %s:%v amount %v confirmations %v\n",
+			e.Kind, e.Address, e.Tx, e.N, e.Amount, e.Confirmations)
+	}
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/winteraz/cryptopay"
+	"github.com/winteraz/cryptopay/keystore"
+	"golang.org/x/crypto/ssh/terminal"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func defaultKeystore() string {
+	home := os.Getenv("HOME")
+	if home == "" {
+		return "keystore"
+	}
+	return filepath.Join(home, ".cryptopay", "keystore")
+}
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// prompt reads a line from the terminal without echo.
+func prompt(msg string) (string, error) {
+	fmt.Fprint(os.Stderr, msg)
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		// piped in.
+		s, err := stdin.ReadString('\n')
+		return strings.TrimSpace(s), err
+	}
+	b, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return strings.TrimSpace(string(b)), err
+}
+
+// loadWallet prompts the password of the keystore wallet and returns its
+// mnemonic and passphrase.
+func loadWallet(dir, name string) (mnemonic, pass string, err error) {
+	s, err := keystore.Open(dir)
+	if err != nil {
+		return "", "", err
+	}
+	password, err := prompt(fmt.Sprintf("Password of %s: ", name))
+	if err != nil {
+		return "", "", err
+	}
+	e, err := s.Load(name, password)
+	if err != nil {
+		return "", "", err
+	}
+	if e.Mnemonic == "" {
+		return "", "", errors.New("The wallet has no mnemonic")
+	}
+	return e.Mnemonic, e.Passphrase, nil
+}
+
+// saveWallet saves the mnemonic and passphrase in the keystore, prompting
+// them if the mnemonic is empty, with a new password.
+func saveWallet(dir, name, mnemonic, pass string) error {
+	s, err := keystore.Open(dir)
+	if err != nil {
+		return err
+	}
+	if mnemonic == "" {
+		if mnemonic, err = prompt("Mnemonic: "); err != nil {
+			return err
+		}
+		if pass, err = prompt("Passphrase (may be empty): "); err != nil {
+			return err
+		}
+	}
+	// the mnemonic must make a key.
+	if _, _, err = cryptopay.NewFromMnemonic(mnemonic, pass); err != nil {
+		return err
+	}
+	password, err := prompt("New keystore password: ")
+	if err != nil {
+		return err
+	}
+	again, err := prompt("Repeat the password: ")
+	if err != nil {
+		return err
+	}
+	if password != again {
+		return errors.New("The passwords don't match")
+	}
+	if err = s.Save(name, &keystore.Entry{Mnemonic: mnemonic, Passphrase: pass}, password); err != nil {
+		return err
+	}
+	fmt.Printf("saved %s in %s\n", name, dir)
+	return nil
+}
@@ -3,17 +3,57 @@ package util
 import (
 	"context"
 	"errors"
+	"fmt"
 	log "github.com/golang/glog"
 	"github.com/winteraz/cryptopay"
 	"github.com/winteraz/cryptopay/bcoin"
 	"github.com/winteraz/cryptopay/ethrpc"
+	"github.com/winteraz/cryptopay/multi"
+	"github.com/winteraz/cryptopay/recovery"
+	"github.com/winteraz/cryptopay/signer"
 	"github.com/winteraz/cryptopay/wallet"
+	"github.com/winteraz/cryptopay/watch"
 	"net/http"
+	"strings"
+	"time"
 )
 
 const scheme = "http"
 
-func newUnspender(remoteHost string, coin cryptopay.CoinType) (wallet.Requester, error) {
+// How long an unused address or unspent outputs are cached.
+const cacheTTL = time.Minute
+
+// remoteHost may be a comma separated list of hosts in which case the
+// requester fails over between them, or requires quorum of them to agree.
+// The requester is cached.
+func newUnspender(remoteHost string, coin cryptopay.CoinType, quorum, confirmations int) (wallet.Requester, error) {
+	hosts := strings.Split(remoteHost, ",")
+	if quorum > len(hosts) {
+		return nil, fmt.Errorf("quorum %v is larger than the number of hosts %v", quorum, len(hosts))
+	}
+	if len(hosts) == 1 {
+		r, err := newHostUnspender(remoteHost, coin, confirmations)
+		if err != nil {
+			return nil, err
+		}
+		return wallet.NewCache(r, cacheTTL), nil
+	}
+	var ba []multi.Backend
+	for _, host := range hosts {
+		r, err := newHostUnspender(host, coin, confirmations)
+		if err != nil {
+			return nil, err
+		}
+		ba = append(ba, multi.Backend{Name: host, Requester: r})
+	}
+	r, err := multi.New(coin, quorum, ba...)
+	if err != nil {
+		return nil, err
+	}
+	return wallet.NewCache(r, cacheTTL), nil
+}
+
+func newHostUnspender(remoteHost string, coin cryptopay.CoinType, confirmations int) (wallet.Requester, error) {
 	switch coin {
 	case cryptopay.BTC:
 		// endpoint := scheme + "://" + remoteHost + ":3001" // insightAPI
@@ -24,7 +64,21 @@ func newUnspender(remoteHost string, coin cryptopay.CoinType) (wallet.Requester,
 			return nil, errors.New("Invalid remoteHost")
 		}
 		endpoint := scheme + "://" + remoteHost + ":8545"
-		return ethrpc.New(endpoint, http.DefaultClient), nil
+		c := ethrpc.New(endpoint, http.DefaultClient)
+		c.SetDepth(uint64(confirmations))
+		return c, nil
+	}
+	return nil, errors.New("Invalid coin")
+}
+
+// newNotifier returns the websocket notifier of a host, the bcoin node or the
+// ethereum node running next to the RPC endpoint.
+func newNotifier(remoteHost string, coin cryptopay.CoinType) (watch.Notifier, error) {
+	switch coin {
+	case cryptopay.BTC:
+		return bcoin.NewNotifier(scheme+"://"+remoteHost+":8332", ""), nil
+	case cryptopay.ETH:
+		return ethrpc.NewNotifier("ws://" + remoteHost + ":8546"), nil
 	}
 	return nil, errors.New("Invalid coin")
 }
@@ -35,34 +89,154 @@ type Request struct {
 	Passwd         string
 	ExtendedPublic string
 	Coin           cryptopay.CoinType
+	// Number of remote hosts that must agree on every answer.
+	Quorum int
+	// Confirmations funds need, 0 is the wallet.DefaultPolicy of the coin.
+	Confirmations int
+	// Cosigners are the account keys of a bitcoin M of N multisig wallet,
+	// the Mnemonic, if any, is the one of a cosigner signing its PSBTs.
+	Cosigners    []string
+	M            int
+	MultisigType cryptopay.MultisigType
+	// SignerURL is the signer.Server signing the transactions of the
+	// ExtendedPublic wallet.
+	SignerURL   string
+	SignerToken string
+}
+
+func (r *Request) confirmations() int {
+	return wallet.Policy{r.Coin: r.Confirmations}.Confirmations(r.Coin)
 }
 
 func (r *Request) Broadcaster(cx context.Context, remoteHost string) (wallet.Broadcaster, error) {
-	return newUnspender(remoteHost, r.Coin)
+	return newUnspender(remoteHost, r.Coin, r.Quorum, r.confirmations())
 }
 
 func (r *Request) WalletAccount(cx context.Context, remoteHost string, accountIndex uint32) (wallet.Wallet, error) {
 	if r.Mnemonic == "" {
 		return nil, errors.New("Invalid mnemonic")
 	}
-	unspender, err := newUnspender(remoteHost, r.Coin)
+	unspender, err := newUnspender(remoteHost, r.Coin, r.Quorum, r.confirmations())
+	if err != nil {
+		return nil, err
+	}
+	w, err := wallet.FromMnemonic(r.Mnemonic, r.Passwd, unspender, r.Coin, accountIndex)
 	if err != nil {
 		return nil, err
 	}
-	return wallet.FromMnemonic(r.Mnemonic, r.Passwd, unspender, r.Coin, accountIndex)
+	setConfirmations(w, r.confirmations())
+	return w, nil
 
 }
 
 func (r *Request) PublicWallet(cx context.Context, remoteHost string) (wallet.Wallet, error) {
 
-	unspender, err := newUnspender(remoteHost, r.Coin)
+	unspender, err := newUnspender(remoteHost, r.Coin, r.Quorum, r.confirmations())
 	if err != nil {
 		return nil, err
 	}
+	if len(r.Cosigners) != 0 {
+		return r.multisigWallet(unspender)
+	}
 	if r.ExtendedPublic == "" {
 		return nil, errors.New("no mnemonic or  ExtendedPublic")
 	}
-	return wallet.FromPublic(r.ExtendedPublic, r.Coin, unspender)
+	var w wallet.Wallet
+	if r.SignerURL != "" {
+		w, err = wallet.FromSigner(r.ExtendedPublic, r.Coin, signer.NewClient(r.SignerURL, r.SignerToken, nil), unspender)
+	} else {
+		w, err = wallet.FromPublic(r.ExtendedPublic, r.Coin, unspender)
+	}
+	if err != nil {
+		return nil, err
+	}
+	setConfirmations(w, r.confirmations())
+	return w, nil
+}
+
+// setConfirmations sets the confirmations of w if it has a policy.
+func setConfirmations(w wallet.Wallet, n int) {
+	if t, ok := w.(wallet.Tracker); ok {
+		t.SetConfirmations(n)
+	}
+}
+
+// reverted returns the reorged payments of w if it tracks them.
+func reverted(w wallet.Wallet) []wallet.Reverted {
+	if t, ok := w.(wallet.Tracker); ok {
+		return t.Reverted()
+	}
+	return nil
+}
+
+func (r *Request) multisigWallet(unspender wallet.Unspender) (wallet.Wallet, error) {
+	ms, err := cryptopay.NewMultisig(r.M, r.MultisigType, r.Cosigners...)
+	if err != nil {
+		return nil, err
+	}
+	var cosigner *cryptopay.Key
+	if r.Mnemonic != "" {
+		if cosigner, _, err = cryptopay.NewFromMnemonic(r.Mnemonic, r.Passwd); err != nil {
+			return nil, err
+		}
+	}
+	w, err := wallet.FromMultisig(ms, cosigner, unspender)
+	if err != nil {
+		return nil, err
+	}
+	setConfirmations(w, r.confirmations())
+	return w, nil
+}
+
+// Watcher returns a watcher of the first external addresses (up to
+// addressGap) of the account, subscribed to every remote host. It must be run.
+func (r *Request) Watcher(cx context.Context, remoteHost string, accountIndex, addressGap uint32) (*watch.Watcher, error) {
+	var w wallet.Wallet
+	var err error
+	if r.Mnemonic == "" || len(r.Cosigners) != 0 {
+		w, err = r.PublicWallet(cx, remoteHost)
+	} else {
+		w, err = r.WalletAccount(cx, remoteHost, accountIndex)
+	}
+	if err != nil {
+		return nil, err
+	}
+	addr, err := w.Addresses(cx, false, 0, addressGap)
+	if err != nil {
+		return nil, err
+	}
+	unspender, err := newUnspender(remoteHost, r.Coin, r.Quorum, r.confirmations())
+	if err != nil {
+		return nil, err
+	}
+	var na []watch.Notifier
+	for _, host := range strings.Split(remoteHost, ",") {
+		n, err := newNotifier(host, r.Coin)
+		if err != nil {
+			return nil, err
+		}
+		na = append(na, n)
+	}
+	wt, err := watch.New(r.Coin, unspender, r.confirmations(), na...)
+	if err != nil {
+		return nil, err
+	}
+	wt.Watch(addr...)
+	return wt, nil
+}
+
+// MovePublic moves the PublicWallet to fresh addresses of toAddrPub. It
+// returns the raw transactions signed by the SignerURL or, for multisig
+// wallets, the base64 PSBTs signed by the Mnemonic if it's set.
+func (r *Request) MovePublic(cx context.Context, remoteHost string, toAddrPub string, addressGap uint32) ([]string, error) {
+	if len(r.Cosigners) == 0 && r.SignerURL == "" {
+		return nil, errors.New("No cosigners or signer to move the wallet")
+	}
+	w, err := r.PublicWallet(cx, remoteHost)
+	if err != nil {
+		return nil, err
+	}
+	return w.Move(cx, toAddrPub, addressGap)
 }
 
 // returns  map[accountIndex][]transactionRaw
@@ -90,26 +264,118 @@ func (r *Request) MoveWallet(cx context.Context, remoteHost string, toAddrPub st
 	return txaa, nil
 }
 
+// Recover scans every recovery scheme of the coins, BTC and ETH if coins is
+// empty, for the addresses of the mnemonic with history.
+func (r *Request) Recover(cx context.Context, remoteHost string, accountsGap, addressGap uint32, coins ...cryptopay.CoinType) ([]recovery.Found, error) {
+	if r.Mnemonic == "" {
+		return nil, errors.New("Invalid mnemonic")
+	}
+	if len(coins) == 0 {
+		coins = []cryptopay.CoinType{cryptopay.BTC, cryptopay.ETH}
+	}
+	unspenders := make(map[cryptopay.CoinType]wallet.Unspender)
+	confirmations := make(wallet.Policy)
+	for _, coin := range coins {
+		unspender, err := newUnspender(remoteHost, coin, r.Quorum, r.confirmations())
+		if err != nil {
+			return nil, err
+		}
+		unspenders[coin] = unspender
+		confirmations[coin] = r.Confirmations
+	}
+	s := recovery.New(unspenders)
+	s.AccountGap = accountsGap
+	s.AddressGap = addressGap
+	s.Confirmations = confirmations
+	return s.ScanMnemonic(cx, r.Mnemonic, r.Passwd)
+}
+
+// Sweep returns the transaction moving the funds of a loose private key, a
+// WIF or a hex ethereum key, to a fresh address of the account toPub, empty
+// if it has no funds.
+func (r *Request) Sweep(cx context.Context, remoteHost, key, toPub string) (string, error) {
+	to, unspender, err := r.sweepTo(remoteHost, toPub)
+	if err != nil {
+		return "", err
+	}
+	return wallet.Sweep(cx, r.Coin, key, to, unspender, r.Confirmations)
+}
+
+// SweepBIP38 is Sweep of a BIP38 key.
+func (r *Request) SweepBIP38(cx context.Context, remoteHost, encrypted, passphrase, toPub string) (string, error) {
+	to, unspender, err := r.sweepTo(remoteHost, toPub)
+	if err != nil {
+		return "", err
+	}
+	return wallet.SweepBIP38(cx, encrypted, passphrase, to, unspender, r.Confirmations)
+}
+
+func (r *Request) sweepTo(remoteHost, toPub string) (wallet.Wallet, wallet.Unspender, error) {
+	unspender, err := newUnspender(remoteHost, r.Coin, r.Quorum, r.confirmations())
+	if err != nil {
+		return nil, nil, err
+	}
+	to, err := wallet.FromPublic(toPub, r.Coin, unspender)
+	if err != nil {
+		return nil, nil, err
+	}
+	return to, unspender, nil
+}
+
 type Balance struct {
-	Internal map[uint32]map[string]uint64
-	External map[uint32]map[string]uint64
-	Total    uint64
+	Internal map[uint32]map[string]wallet.Balance
+	External map[uint32]map[string]wallet.Balance
+	Total    wallet.Balance
+	// Reverted are the payments which left the balance in a reorg since the
+	// previous balance of WatchBalance.
+	Reverted []wallet.Reverted
 }
 
 // if Req doesn't have a private/key mnemonic the accountsGap is ignored(as we can't derivate account
 // keys)
 
 func (r *Request) Balance(cx context.Context, remoteHost string, accountsGap, addressGap uint32) (*Balance, error) {
-	if r.Mnemonic == "" {
+	return r.balance(cx, remoteHost, accountsGap, addressGap, make(map[uint32]wallet.Wallet))
+}
+
+// WatchBalance calls fn with the Balance every interval until cx is done.
+// The wallets are kept between the calls, so the reorgs show in Reverted.
+func (r *Request) WatchBalance(cx context.Context, remoteHost string, accountsGap, addressGap uint32, interval time.Duration, fn func(*Balance)) error {
+	if interval <= 0 {
+		return errors.New("Invalid interval")
+	}
+	wallets := make(map[uint32]wallet.Wallet)
+	for {
+		bal, err := r.balance(cx, remoteHost, accountsGap, addressGap, wallets)
+		if err != nil {
+			log.Error(err)
+		} else {
+			fn(bal)
+		}
+		select {
+		case <-cx.Done():
+			return cx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// balance of the accounts, reusing the wallets by account index.
+func (r *Request) balance(cx context.Context, remoteHost string, accountsGap, addressGap uint32, wallets map[uint32]wallet.Wallet) (*Balance, error) {
+	if r.Mnemonic == "" || len(r.Cosigners) != 0 {
 		// we use a dummy account b/c we don't know it
 		const account = uint32(99999)
-		w, err := r.PublicWallet(cx, remoteHost)
-		if err != nil {
-			return nil, err
+		w, ok := wallets[account]
+		if !ok {
+			var err error
+			if w, err = r.PublicWallet(cx, remoteHost); err != nil {
+				return nil, err
+			}
+			wallets[account] = w
 		}
 		bal := &Balance{
-			Internal: make(map[uint32]map[string]uint64),
-			External: make(map[uint32]map[string]uint64),
+			Internal: make(map[uint32]map[string]wallet.Balance),
+			External: make(map[uint32]map[string]wallet.Balance),
 		}
 		extAcct, interAcct, err := accountBalance(cx, w, addressGap)
 		if err != nil {
@@ -123,28 +389,32 @@ func (r *Request) Balance(cx context.Context, remoteHost string, accountsGap, ad
 			bal.Internal[account] = interAcct
 		}
 		for _, v := range extAcct {
-			bal.Total += v
+			bal.Total = bal.Total.Add(v)
 		}
 		for _, v := range interAcct {
-			bal.Total += v
+			bal.Total = bal.Total.Add(v)
 		}
-
+		bal.Reverted = reverted(w)
 		return bal, nil
 	}
-	return r.balanceAccounts(cx, remoteHost, accountsGap, addressGap)
+	return r.balanceAccounts(cx, remoteHost, accountsGap, addressGap, wallets)
 }
 
-func (r *Request) balanceAccounts(cx context.Context, remoteHost string, accountsGap, addressGap uint32) (*Balance, error) {
+func (r *Request) balanceAccounts(cx context.Context, remoteHost string, accountsGap, addressGap uint32, wallets map[uint32]wallet.Wallet) (*Balance, error) {
 	log.Infof("AccountsGap %v, AddressGap %v", accountsGap, addressGap)
 	bal := &Balance{
-		Internal: make(map[uint32]map[string]uint64),
-		External: make(map[uint32]map[string]uint64),
+		Internal: make(map[uint32]map[string]wallet.Balance),
+		External: make(map[uint32]map[string]wallet.Balance),
 	}
 	accountIndex := uint32(0)
 	for account := uint32(0); account <= accountsGap; account++ {
-		w, err := r.WalletAccount(cx, remoteHost, accountIndex)
-		if err != nil {
-			return nil, err
+		w, ok := wallets[accountIndex]
+		if !ok {
+			var err error
+			if w, err = r.WalletAccount(cx, remoteHost, accountIndex); err != nil {
+				return nil, err
+			}
+			wallets[accountIndex] = w
 		}
 		extAcct, interAcct, err := accountBalance(cx, w, addressGap)
 		if err != nil {
@@ -153,27 +423,28 @@ func (r *Request) balanceAccounts(cx context.Context, remoteHost string, account
 		}
 		if len(extAcct) != 0 {
 			bal.External[accountIndex] = extAcct
-			log.Infof("extAcct %q", extAcct)
+			log.Infof("extAcct %v", extAcct)
 			account = 0
 		}
 		if len(interAcct) != 0 {
 			bal.Internal[accountIndex] = interAcct
-			log.Infof("interAcct %q", interAcct)
+			log.Infof("interAcct %v", interAcct)
 			account = 0
 		}
 		for _, v := range extAcct {
-			bal.Total += v
+			bal.Total = bal.Total.Add(v)
 		}
 		for _, v := range interAcct {
-			bal.Total += v
+			bal.Total = bal.Total.Add(v)
 		}
+		bal.Reverted = append(bal.Reverted, reverted(w)...)
 		accountIndex++
 	}
 	return bal, nil
 
 }
 
-func accountBalance(cx context.Context, w wallet.Wallet, addressGap uint32) (ext, inter map[string]uint64, err error) {
+func accountBalance(cx context.Context, w wallet.Wallet, addressGap uint32) (ext, inter map[string]wallet.Balance, err error) {
 	kind := false
 	ext, err = w.Balance(cx, kind, addressGap)
 	if err != nil {
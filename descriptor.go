@@ -0,0 +1,178 @@
+package cryptopay
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ParseDescriptor parses the output descriptor of an account (BIP 380 to
+// 386): pkh(KEY), sh(wpkh(KEY)), wpkh(KEY) or tr(KEY). KEY is an xpub with an
+// optional key origin, [d34db33f/84'/0'/0']xpub..., and the receive and
+// change chains, /<0;1>/*, /0/* or /1/*, or nothing. The checksum is checked
+// if it's there.
+func ParseDescriptor(s string) (*AccountKey, error) {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, "#"); i >= 0 {
+		sum, err := descriptorChecksum(s[:i])
+		if err != nil {
+			return nil, err
+		}
+		if s[i+1:] != sum {
+			return nil, fmt.Errorf("Invalid descriptor checksum %q, want %q", s[i+1:], sum)
+		}
+		s = s[:i]
+	}
+	var typ AddressType
+	for _, f := range []struct {
+		prefix string
+		typ    AddressType
+	}{
+		{"sh(wpkh(", P2SH},
+		{"wpkh(", P2WPKH},
+		{"pkh(", P2PKH},
+		{"tr(", P2TR},
+	} {
+		end := strings.Repeat(")", strings.Count(f.prefix, "("))
+		if strings.HasPrefix(s, f.prefix) && strings.HasSuffix(s, end) {
+			typ = f.typ
+			s = s[len(f.prefix) : len(s)-len(end)]
+			break
+		}
+	}
+	if typ == 0 {
+		return nil, errors.New("Unsupported descriptor, want pkh, sh(wpkh), wpkh or tr")
+	}
+	if strings.ContainsAny(s, ",()") {
+		return nil, errors.New("Unsupported descriptor, only single key accounts")
+	}
+	var origin string
+	if strings.HasPrefix(s, "[") {
+		i := strings.Index(s, "]")
+		if i < 0 {
+			return nil, errors.New("Invalid key origin")
+		}
+		origin, s = s[1:i], s[i+1:]
+		if len(origin) < 8 {
+			return nil, fmt.Errorf("Invalid key origin %q", origin)
+		}
+	}
+	key := s
+	if i := strings.Index(s, "/"); i >= 0 {
+		key, s = s[:i], s[i:]
+		switch s {
+		case "/<0;1>/*", "/0/*", "/1/*":
+		default:
+			return nil, fmt.Errorf("Unsupported derivation %q, want the account key", s)
+		}
+	}
+	a, err := ParseAccountKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if a.Type != P2PKH {
+		return nil, errors.New("Descriptors take xpub or tpub keys")
+	}
+	a.Type, a.Origin = typ, origin
+	return a, nil
+}
+
+// Descriptor returns the output descriptor of the account, receive and
+// change addresses in one (BIP 389), with its checksum.
+func (a *AccountKey) Descriptor() (string, error) {
+	if a.Multisig {
+		return "", errors.New("Multisig accounts have more keys")
+	}
+	key, err := a.Key.SLIP132(P2PKH, false, a.Network)
+	if err != nil {
+		return "", err
+	}
+	if a.Origin != "" {
+		key = "[" + a.Origin + "]" + key
+	}
+	key += "/<0;1>/*"
+	var s string
+	switch a.Type {
+	case P2PKH:
+		s = "pkh(" + key + ")"
+	case P2SH:
+		s = "sh(wpkh(" + key + "))"
+	case P2WPKH:
+		s = "wpkh(" + key + ")"
+	case P2TR:
+		s = "tr(" + key + ")"
+	default:
+		return "", fmt.Errorf("No descriptor for %s", a.Type)
+	}
+	sum, err := descriptorChecksum(s)
+	if err != nil {
+		return "", err
+	}
+	return s + "#" + sum, nil
+}
+
+// AccountKey derives the public key of an account paying to typ from the
+// master key k, with its origin for descriptors.
+func (k *Key) AccountKey(typ AddressType, coinTyp CoinType, account uint32) (*AccountKey, error) {
+	pub, err := k.DeriveAccountKey(false, typ, coinTyp, account)
+	if err != nil {
+		return nil, err
+	}
+	fp, err := k.Fingerprint()
+	if err != nil {
+		return nil, err
+	}
+	purpose, _ := Purpose(typ)
+	return &AccountKey{
+		Key:     pub,
+		Type:    typ,
+		Network: MainNet,
+		Origin:  fmt.Sprintf("%08x", fp) + strings.TrimPrefix(AccountPath(purpose, coinTyp, account).String(), "m"),
+	}, nil
+}
+
+const descriptorCharset = "0123456789()[],'/*abcdefgh@:$%{}" +
+	"IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~" +
+	"ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+
+func descriptorPolymod(c uint64, v int) uint64 {
+	c0 := c >> 35
+	c = (c&0x7ffffffff)<<5 ^ uint64(v)
+	gen := [5]uint64{0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd}
+	for i := uint(0); i < 5; i++ {
+		if (c0>>i)&1 == 1 {
+			c ^= gen[i]
+		}
+	}
+	return c
+}
+
+// https://github.com/bitcoin/bips/blob/master/bip-0380.mediawiki#checksum
+func descriptorChecksum(s string) (string, error) {
+	c := uint64(1)
+	cls, clsCount := 0, 0
+	for i := 0; i < len(s); i++ {
+		pos := strings.IndexByte(descriptorCharset, s[i])
+		if pos < 0 {
+			return "", fmt.Errorf("Invalid descriptor character %q", s[i])
+		}
+		c = descriptorPolymod(c, pos&31)
+		cls = cls*3 + pos>>5
+		if clsCount++; clsCount == 3 {
+			c = descriptorPolymod(c, cls)
+			cls, clsCount = 0, 0
+		}
+	}
+	if clsCount > 0 {
+		c = descriptorPolymod(c, cls)
+	}
+	for i := 0; i < 8; i++ {
+		c = descriptorPolymod(c, 0)
+	}
+	c ^= 1
+	sum := make([]byte, 8)
+	for i := range sum {
+		sum[i] = bech32Charset[c>>uint(5*(7-i))&31]
+	}
+	return string(sum), nil
+}
@@ -0,0 +1,178 @@
+// Package electrum subscribes to address changes on an Electrum server.
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html
+package electrum
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	dialTimeout  = 30 * time.Second
+	pingInterval = time.Minute
+	readTimeout  = 3 * time.Minute
+)
+
+// Notifier implements watch.Notifier with scripthash and headers
+// subscriptions.
+type Notifier struct {
+	address string
+	config  *tls.Config
+}
+
+// NewNotifier returns a notifier of the server at address (host:port). The
+// connection is TLS unless config is nil.
+func NewNotifier(address string, config *tls.Config) *Notifier {
+	return &Notifier{address: address, config: config}
+}
+
+// ScriptHash returns the electrum script hash of a bitcoin address, the
+// reversed sha256 of its output script.
+func ScriptHash(addr string) (string, error) {
+	a, err := btcutil.DecodeAddress(addr, &chaincfg.MainNetParams)
+	if err != nil {
+		return "", err
+	}
+	script, err := txscript.PayToAddrScript(a)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(script)
+	for i, j := 0, len(h)-1; i < j; i, j = i+1, j-1 {
+		h[i], h[j] = h[j], h[i]
+	}
+	return hex.EncodeToString(h[:]), nil
+}
+
+type request struct {
+	Version string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type message struct {
+	ID     *int              `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (n *Notifier) Subscribe(cx context.Context, addr []string, changed func(addr ...string)) error {
+	byHash := make(map[string]string)
+	for _, a := range addr {
+		h, err := ScriptHash(a)
+		if err != nil {
+			return err
+		}
+		byHash[h] = a
+	}
+	d := &net.Dialer{Timeout: dialTimeout}
+	var conn net.Conn
+	var err error
+	if n.config != nil {
+		conn, err = tls.DialWithDialer(d, "tcp", n.address, n.config)
+	} else {
+		conn, err = d.Dial("tcp", n.address)
+	}
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-cx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	var mu sync.Mutex // a single writer
+	id := 0
+	send := func(method string, params ...interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		id++
+		b, err := json.Marshal(&request{Version: "2.0", ID: id, Method: method, Params: params})
+		if err != nil {
+			return err
+		}
+		conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+		_, err = conn.Write(append(b, '\n'))
+		return err
+	}
+	go func() {
+		tick := time.NewTicker(pingInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+				if send("server.ping") != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	if err = send("server.version", "cryptopay", "1.4"); err != nil {
+		return err
+	}
+	if err = send("blockchain.headers.subscribe"); err != nil {
+		return err
+	}
+	for h := range byHash {
+		if err = send("blockchain.scripthash.subscribe", h); err != nil {
+			return err
+		}
+	}
+	r := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		line, err := r.ReadBytes('\n')
+		if cx.Err() != nil {
+			return cx.Err()
+		}
+		if err != nil {
+			return err
+		}
+		var m message
+		if err = json.Unmarshal(line, &m); err != nil {
+			return fmt.Errorf("%v, %s", err, line)
+		}
+		if m.Error != nil {
+			return fmt.Errorf("electrum error %v: %s", m.Error.Code, m.Error.Message)
+		}
+		switch m.Method {
+		case "blockchain.headers.subscribe":
+			changed()
+		case "blockchain.scripthash.subscribe":
+			if len(m.Params) == 0 {
+				continue
+			}
+			var h string
+			if err = json.Unmarshal(m.Params[0], &h); err != nil {
+				return fmt.Errorf("%v, %s", err, line)
+			}
+			if a, ok := byHash[h]; ok {
+				changed(a)
+			}
+		}
+	}
+}
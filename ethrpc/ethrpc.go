@@ -7,6 +7,7 @@ import (
 	"fmt"
 	log "github.com/golang/glog"
 	"github.com/winteraz/cryptopay"
+	"github.com/winteraz/cryptopay/transport"
 	"io/ioutil"
 	"net/http"
 	"strconv"
@@ -26,14 +27,27 @@ curl -X POST --data '{"jsonrpc":"2.0","method":"eth_getTransactionCount","params
 
 */
 
+// The blocks after which Unspent considers a balance settled.
+const DefaultDepth = 12
+
 type Client struct {
 	endpoint string
 	client   *http.Client
+	depth    uint64
 }
 
+// New returns a client whose requests go through transport.Client.
 func New(endpoint string, client *http.Client) *Client {
+	return &Client{endpoint: endpoint, client: transport.Client(client), depth: DefaultDepth}
+}
 
-	return &Client{endpoint: endpoint, client: client}
+// SetDepth sets the confirmations after which Unspent reports a balance as
+// settled, it should be the confirmations the wallet requires.
+func (c *Client) SetDepth(blocks uint64) {
+	if blocks < 1 {
+		blocks = 1
+	}
+	c.depth = blocks
 }
 
 type Result struct {
@@ -100,6 +114,23 @@ func (c *Client) CountTransactionsByAddress(cx context.Context, address string)
 	return r, err
 }
 
+// https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_blocknumber
+func (c *Client) BlockHeight(cx context.Context) (uint64, error) {
+	const data = `{"jsonrpc":"2.0","method":"eth_blockNumber","params":[],"id":1}`
+	b, err := c.makeReq(data)
+	if err != nil {
+		return 0, err
+	}
+	var v Result
+	if err = json.Unmarshal(b, &v); err != nil {
+		return 0, fmt.Errorf("Err %v, B %s", err, b)
+	}
+	if v.Error.Code != 0 || v.Error.Message != "" {
+		return 0, fmt.Errorf("%#v", v)
+	}
+	return strconv.ParseUint(strings.TrimPrefix(v.Result, "0x"), 16, 64)
+}
+
 func (c *Client) HasTransactions(cx context.Context, addr ...string) (map[string]bool, error) {
 	// we use balance as there is nothing to be done with empty addresseses
 	if len(addr) == 0 {
@@ -132,6 +163,11 @@ type JSONRequest struct {
 
 // https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_getbalance
 func (c *Client) Balance(addr ...string) (map[string]uint64, error) {
+	return c.balanceAt("latest", addr...)
+}
+
+// balanceAt returns the balances at block, a hex number or a tag.
+func (c *Client) balanceAt(block string, addr ...string) (map[string]uint64, error) {
 	if len(addr) == 0 {
 		return nil, errors.New("Invalid address list")
 	}
@@ -142,7 +178,7 @@ func (c *Client) Balance(addr ...string) (map[string]uint64, error) {
 		jr := JSONRequest{
 			Version: "2.0",
 			Method:  "eth_getBalance",
-			Params:  []string{address, "latest"},
+			Params:  []string{address, block},
 			ID:      k + 1,
 		}
 		jra = append(jra, jr)
@@ -189,19 +225,42 @@ func (c *Client) Balance(addr ...string) (map[string]uint64, error) {
 
 // This is only to implement wallet.Unspender.
 // Todo: consider different interfaces based on coins.
+// Accounts have no outputs so the balance is split in the part the address
+// already had depth blocks ago, reported with depth confirmations, and the
+// newer part, whose depth is unknown, reported with none. Set the depth to
+// the confirmations the wallet requires.
 func (c *Client) Unspent(cx context.Context, addr ...string) (map[string][]cryptopay.Unspent, error) {
 	if len(addr) == 0 {
 		return nil, errors.New("Invalid address list")
 	}
-	var amountMap map[string]uint64
+	tip, err := c.BlockHeight(cx)
+	if err != nil {
+		return nil, err
+	}
 	amountMap, err := c.Balance(addr...)
 	if err != nil {
 		return nil, err
 	}
+	settled := make(map[string]uint64)
+	if tip+1 >= c.depth {
+		block := "0x" + strconv.FormatUint(tip+1-c.depth, 16)
+		if settled, err = c.balanceAt(block, addr...); err != nil {
+			return nil, err
+		}
+	}
 	m := make(map[string][]cryptopay.Unspent)
 	for address, amount := range amountMap {
+		old := settled[address]
+		if old > amount {
+			// spent since, what's left was there before.
+			old = amount
+		}
 		m[address] = []cryptopay.Unspent{
-			cryptopay.Unspent{Amount: amount, Confirmations: 9999}}
+			cryptopay.Unspent{Amount: old, Confirmations: int(c.depth)}}
+		if amount > old {
+			m[address] = append(m[address],
+				cryptopay.Unspent{Amount: amount - old})
+		}
 	}
 	return m, nil
 }
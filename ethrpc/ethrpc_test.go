@@ -0,0 +1,40 @@
+package ethrpc
+
+import (
+	"context"
+	"github.com/winteraz/cryptopay/internal/contract"
+	"github.com/winteraz/cryptopay/internal/httpreplay"
+	"github.com/winteraz/cryptopay/wallet"
+	"net/http"
+	"testing"
+)
+
+const upstream = "https://cloudflare-eth.com"
+
+func TestContract(t *testing.T) {
+	contract.Run(t, "ethrpc", upstream, contract.ETH, func(url string, cl *http.Client) wallet.Requester {
+		return New(url, cl)
+	})
+}
+
+func TestUnspentDepth(t *testing.T) {
+	s := httpreplay.New(t, "ethrpc_depth", upstream)
+	defer s.Close()
+	c := New(s.URL, s.Client())
+	used := contract.ETH.Used
+	m, err := c.Unspent(context.Background(), used)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the balance DefaultDepth blocks ago, then what arrived since.
+	una := m[used]
+	if len(una) == 0 || len(una) > 2 {
+		t.Fatalf("got %+v, want one or two entries", una)
+	}
+	if una[0].Confirmations != DefaultDepth {
+		t.Errorf("got %+v, want %v confirmations", una[0], DefaultDepth)
+	}
+	if len(una) == 2 && (una[1].Confirmations != 0 || una[1].Amount == 0) {
+		t.Errorf("got %+v, want a newer unconfirmed amount", una[1])
+	}
+}
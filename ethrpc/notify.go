@@ -0,0 +1,69 @@
+package ethrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"time"
+)
+
+const readTimeout = 5 * time.Minute
+
+// Notifier implements watch.Notifier with an eth_subscribe of newHeads. There
+// are no address subscriptions so every head means every balance must be
+// compared, which the watcher does.
+// https://github.com/ethereum/go-ethereum/wiki/RPC-PUB-SUB
+type Notifier struct {
+	endpoint string
+}
+
+// NewNotifier returns a notifier of the websocket endpoint of a node, usually
+// ws://host:8546.
+func NewNotifier(endpoint string) *Notifier {
+	return &Notifier{endpoint: endpoint}
+}
+
+func (n *Notifier) Subscribe(cx context.Context, addr []string, changed func(addr ...string)) error {
+	conn, _, err := websocket.DefaultDialer.Dial(n.endpoint, nil)
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-cx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+	const data = `{"jsonrpc":"2.0","id":1,"method":"eth_subscribe","params":["newHeads"]}`
+	if err = conn.WriteMessage(websocket.TextMessage, []byte(data)); err != nil {
+		return err
+	}
+	for {
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		_, b, err := conn.ReadMessage()
+		if cx.Err() != nil {
+			return cx.Err()
+		}
+		if err != nil {
+			return err
+		}
+		var v struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+			Error  Error  `json:"error"`
+		}
+		if err = json.Unmarshal(b, &v); err != nil {
+			return fmt.Errorf("Err %v, B %s", err, b)
+		}
+		if v.Error.Code != 0 || v.Error.Message != "" {
+			return fmt.Errorf("%#v", v.Error)
+		}
+		if v.Method == "eth_subscription" {
+			changed()
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Package contract checks that a backend honours the wallet.Requester
+// contract the wallet relies on. Each backend test calls Run with its
+// recording of the live API, the tests are skipped until it's recorded.
+package contract
+
+import (
+	"context"
+	"github.com/winteraz/cryptopay/internal/httpreplay"
+	"github.com/winteraz/cryptopay/wallet"
+	"net/http"
+	"testing"
+)
+
+// Fixture is what a backend recording is asked about. The recordings are
+// of the live chains so only what stays true is checked, not balances.
+type Fixture struct {
+	// Used has history and, for ethereum whose history is the balance,
+	// funds. Unused is a random hash nobody has the key of.
+	Used, Unused string
+	// Counts tells if the backend implements CountTransactions.
+	Counts bool
+	// MinHeight is a height the chain had long before the recording.
+	MinHeight uint64
+	// RawTX is a transaction the backend accepts when recording, empty
+	// skips Broadcast.
+	RawTX string
+}
+
+// BTC is the bitcoin fixture, Used is the first address of the "abandon ...
+// about" test mnemonic.
+var BTC = Fixture{
+	Used:      "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA",
+	Unused:    "16wJG1ixHNmpZ5f76L1oAyMMFsP14Z4RTJ",
+	MinHeight: 800000,
+}
+
+// ETH is the ethereum fixture, Used is the beacon chain deposit contract.
+var ETH = Fixture{
+	Used:      "0x00000000219ab540356cBB839Cbe05303d7705Fa",
+	Unused:    "0x5AceBa83167A46D1172F74F0940bd76c5C84FE8e",
+	Counts:    true,
+	MinHeight: 17000000,
+}
+
+// Run replays testdata/<name>.json, recorded from upstream, to the backend
+// made by connect and runs the checks of f against it.
+func Run(t *testing.T, name, upstream string, f Fixture, connect func(url string, cl *http.Client) wallet.Requester) {
+	s := httpreplay.New(t, name, upstream)
+	defer s.Close()
+	r := connect(s.URL, s.Client())
+	Unspent(t, r, f.Used, f.Unused)
+	HasTransactions(t, r, f.Used, f.Unused)
+	if f.Counts {
+		CountTransactions(t, r, f.Used)
+	}
+	if h, ok := r.(wallet.Heighter); ok {
+		BlockHeight(t, h, f.MinHeight)
+	}
+	if f.RawTX != "" {
+		Broadcast(t, r, f.RawTX)
+	}
+}
+
+// HasTransactions checks that used is reported as used and unused as unused,
+// and that an empty address list is an error.
+func HasTransactions(t *testing.T, u wallet.Unspender, used, unused string) {
+	cx := context.Background()
+	m, err := u.HasTransactions(cx, used, unused)
+	if err != nil {
+		t.Fatalf("HasTransactions: %v", err)
+	}
+	if !m[used] {
+		t.Errorf("HasTransactions: %s is used, got %v", used, m)
+	}
+	if m[unused] {
+		t.Errorf("HasTransactions: %s is unused, got %v", unused, m)
+	}
+	if _, err = u.HasTransactions(cx); err == nil {
+		t.Errorf("HasTransactions: no error for an empty address list")
+	}
+}
+
+// Unspent checks that only the requested addresses are returned, without
+// empty outputs, and that unused has none.
+func Unspent(t *testing.T, u wallet.Unspender, used, unused string) {
+	cx := context.Background()
+	m, err := u.Unspent(cx, used, unused)
+	if err != nil {
+		t.Fatalf("Unspent: %v", err)
+	}
+	for addr := range m {
+		if addr != used && addr != unused {
+			t.Errorf("Unspent: unexpected address %s", addr)
+		}
+	}
+	for _, un := range m[used] {
+		if un.Amount == 0 {
+			t.Errorf("Unspent: zero output %#v", un)
+		}
+	}
+	for _, un := range m[unused] {
+		if un.Amount != 0 {
+			t.Errorf("Unspent: %s is unused, got %#v", unused, un)
+		}
+	}
+	if _, err = u.Unspent(cx); err == nil {
+		t.Errorf("Unspent: no error for an empty address list")
+	}
+}
+
+// CountTransactions checks that addr has a count.
+func CountTransactions(t *testing.T, u wallet.Unspender, addr string) {
+	m, err := u.CountTransactions(context.Background(), addr)
+	if err != nil {
+		t.Fatalf("CountTransactions: %v", err)
+	}
+	if _, ok := m[addr]; !ok {
+		t.Errorf("CountTransactions: no count of %s in %v", addr, m)
+	}
+}
+
+// Broadcast checks that tx is accepted and reported by its raw form.
+func Broadcast(t *testing.T, b wallet.Broadcaster, tx string) {
+	m, err := b.Broadcast(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("Broadcast: %v", err)
+	}
+	err, ok := m[tx]
+	if !ok {
+		t.Fatalf("Broadcast: tx missing from %v", m)
+	}
+	if err != nil {
+		t.Errorf("Broadcast: %v", err)
+	}
+}
+
+// BlockHeight checks that the chain tip is at least min.
+func BlockHeight(t *testing.T, h wallet.Heighter, min uint64) {
+	got, err := h.BlockHeight(context.Background())
+	if err != nil {
+		t.Fatalf("BlockHeight: %v", err)
+	}
+	if got < min {
+		t.Errorf("BlockHeight: got %v, want at least %v", got, min)
+	}
+}
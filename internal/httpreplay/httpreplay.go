@@ -0,0 +1,184 @@
+// Package httpreplay serves recorded API responses from golden files to the
+// backend client tests.
+//
+// By default a Server answers from testdata/<name>.json and fails the test on
+// a request it has no recording for, the test is skipped when there's no
+// golden file yet. With CRYPTOPAY_RECORD=1 in the environment the requests
+// are forwarded to the real upstream instead and the answers are written back
+// to the golden file when the server is closed:
+//
+//	CRYPTOPAY_RECORD=1 go test ./bcoin
+package httpreplay
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+const recordEnv = "CRYPTOPAY_RECORD"
+
+// Interaction is one recorded request and its answer. Body and Response are
+// kept as JSON when they are JSON and as a JSON string otherwise.
+type Interaction struct {
+	Method   string          `json:"method"`
+	URL      string          `json:"url"` // path and query
+	Body     json.RawMessage `json:"body,omitempty"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response"`
+}
+
+type Server struct {
+	*httptest.Server
+	t        testing.TB
+	file     string
+	upstream string
+	record   bool
+
+	mu           sync.Mutex
+	interactions []Interaction
+}
+
+// New starts a server for the golden file testdata/<name>.json. upstream is
+// the real API used when recording.
+func New(t testing.TB, name, upstream string) *Server {
+	s := &Server{
+		t:        t,
+		file:     filepath.Join("testdata", name+".json"),
+		upstream: upstream,
+		record:   os.Getenv(recordEnv) != "",
+	}
+	if !s.record {
+		b, err := ioutil.ReadFile(s.file)
+		if err != nil {
+			t.Skipf("%v, record it with %s=1", err, recordEnv)
+		}
+		if err = json.Unmarshal(b, &s.interactions); err != nil {
+			t.Fatalf("%s: %v", s.file, err)
+		}
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Close stops the server and saves the recording.
+func (s *Server) Close() {
+	s.Server.Close()
+	if !s.record {
+		return
+	}
+	b, err := json.MarshalIndent(s.interactions, "", "  ")
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if err = os.MkdirAll(filepath.Dir(s.file), 0755); err != nil {
+		s.t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(s.file, append(b, '\n'), 0644); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var in Interaction
+	if s.record {
+		in, err = s.forward(r, body)
+		if err != nil {
+			s.t.Errorf("record %s %s: %v", r.Method, r.URL.RequestURI(), err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		s.mu.Lock()
+		s.interactions = append(s.interactions, in)
+		s.mu.Unlock()
+	} else {
+		var ok bool
+		in, ok = s.find(r.Method, r.URL.RequestURI(), body)
+		if !ok {
+			s.t.Errorf("no recording for %s %s %s", r.Method, r.URL.RequestURI(), body)
+			http.Error(w, "no recording", http.StatusNotFound)
+			return
+		}
+	}
+	w.WriteHeader(in.Status)
+	w.Write(decode(in.Response))
+}
+
+func (s *Server) find(method, uri string, body []byte) (Interaction, bool) {
+	want := canonical(body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, in := range s.interactions {
+		if in.Method == method && in.URL == uri && bytes.Equal(canonical(decode(in.Body)), want) {
+			return in, true
+		}
+	}
+	return Interaction{}, false
+}
+
+func (s *Server) forward(r *http.Request, body []byte) (Interaction, error) {
+	in := Interaction{Method: r.Method, URL: r.URL.RequestURI(), Body: encode(body)}
+	req, err := http.NewRequest(r.Method, s.upstream+in.URL, bytes.NewReader(body))
+	if err != nil {
+		return in, err
+	}
+	req.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return in, err
+	}
+	defer rsp.Body.Close()
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return in, err
+	}
+	in.Status = rsp.StatusCode
+	in.Response = encode(b)
+	return in, nil
+}
+
+// encode keeps JSON as is and turns anything else into a JSON string.
+func encode(b []byte) json.RawMessage {
+	if len(b) == 0 {
+		return nil
+	}
+	if json.Valid(b) {
+		return json.RawMessage(b)
+	}
+	e, _ := json.Marshal(string(b))
+	return json.RawMessage(e)
+}
+
+func decode(m json.RawMessage) []byte {
+	if len(m) > 0 && m[0] == '"' {
+		var str string
+		if err := json.Unmarshal(m, &str); err == nil {
+			return []byte(str)
+		}
+	}
+	return m
+}
+
+// canonical formats a JSON body so that key order and spacing don't matter.
+func canonical(b []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return b
+	}
+	c, err := json.Marshal(v)
+	if err != nil {
+		return b
+	}
+	return c
+}
@@ -0,0 +1,346 @@
+// Package invoice allocates a fresh external address of an account to every
+// payment request and follows what's paid to it.
+//
+// A Book derives the addresses from the account xpub with an index counter
+// kept in a Store, so no address is given twice even across restarts. Update
+// matches the unspent outputs of the open invoices and moves them through
+// Pending, PartiallyPaid, Paid, Overpaid or Expired.
+package invoice
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	log "github.com/golang/glog"
+	"github.com/winteraz/cryptopay"
+	"github.com/winteraz/cryptopay/wallet"
+	"reflect"
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	// Pending has no confirmed payment yet.
+	Pending State = iota
+	// PartiallyPaid received less than the amount.
+	PartiallyPaid
+	// Paid received the exact amount.
+	Paid
+	// Overpaid received more than the amount.
+	Overpaid
+	// Expired wasn't paid in full before the expiry.
+	Expired
+)
+
+func (s State) String() string {
+	switch s {
+	case Pending:
+		return "pending"
+	case PartiallyPaid:
+		return "partially paid"
+	case Paid:
+		return "paid"
+	case Overpaid:
+		return "overpaid"
+	case Expired:
+		return "expired"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Closed states don't change anymore.
+func (s State) Closed() bool {
+	return s == Paid || s == Overpaid || s == Expired
+}
+
+// Payment is an output paid to the address of an invoice. Tx is empty for
+// ethereum where the payments are the increases of the balance.
+type Payment struct {
+	Tx            string
+	N             uint32
+	Amount        uint64
+	Confirmations int
+	// Seen is when the payment was first matched. It was made between the
+	// check before, After, and Seen. Payments made after the expiry, as
+	// After is, don't count.
+	Seen  time.Time
+	After time.Time
+}
+
+type Invoice struct {
+	ID      string
+	Coin    cryptopay.CoinType
+	Address string
+	Index   uint32 // of the external address
+	Amount  uint64
+	Created time.Time
+	Expires time.Time
+	State   State
+	// Received is the confirmed amount paid before the expiry.
+	Received uint64
+	// Unconfirmed is the amount waiting for confirmations.
+	Unconfirmed uint64
+	Payments    []Payment
+	// Balance is the last confirmed balance of an ethereum address, the
+	// payments swept from it are more.
+	Balance uint64
+}
+
+// Store keeps the invoices and the index counter of a Book.
+type Store interface {
+	// NextIndex reserves the next external address index.
+	NextIndex() (uint32, error)
+	Put(inv *Invoice) error
+	Get(id string) (*Invoice, error)
+	// Open returns the invoices which aren't closed.
+	Open() ([]*Invoice, error)
+}
+
+var ErrNotFound = errors.New("Invoice not found")
+
+// Book creates the invoices of an account, see New.
+type Book struct {
+	// Confirmations a payment needs to count as received.
+	Confirmations int
+
+	account   *cryptopay.AccountKey
+	coin      cryptopay.CoinType
+	unspender wallet.Unspender
+	store     Store
+	now       func() time.Time
+	mu        sync.Mutex
+	// checked is the time of the last Update, zero before the first one.
+	checked time.Time
+}
+
+// New returns a Book deriving the addresses of coin from the account
+// extended public key (m/44'/coin'/account'), or the ypub, zpub or
+// descriptor of a bitcoin account.
+func New(xpub string, coin cryptopay.CoinType, unspender wallet.Unspender, store Store) (*Book, error) {
+	if store == nil {
+		return nil, errors.New("Invalid store")
+	}
+	a, err := cryptopay.ParseAccountKey(xpub)
+	if err != nil {
+		return nil, err
+	}
+	if a.Multisig {
+		return nil, errors.New("Multisig keys need the other cosigners")
+	}
+	return &Book{
+		Confirmations: wallet.DefaultPolicy.Confirmations(coin),
+		account:       a,
+		coin:          coin,
+		unspender:     unspender,
+		store:         store,
+		now:           time.Now,
+	}, nil
+}
+
+// Create a pending invoice of amount, in satoshi or wei, which expires after
+// expiry. An expiry of 0 never expires.
+func (b *Book) Create(amount uint64, expiry time.Duration) (*Invoice, error) {
+	if amount == 0 {
+		return nil, errors.New("Invalid amount")
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	index, err := b.store.NextIndex()
+	if err != nil {
+		return nil, err
+	}
+	addr, err := b.address(index)
+	if err != nil {
+		return nil, err
+	}
+	now := b.now()
+	inv := &Invoice{
+		ID:      id,
+		Coin:    b.coin,
+		Address: addr,
+		Index:   index,
+		Amount:  amount,
+		Created: now,
+	}
+	if expiry > 0 {
+		inv.Expires = now.Add(expiry)
+	}
+	if err = b.store.Put(inv); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// address derives the external address of index.
+func (b *Book) address(index uint32) (string, error) {
+	const kind = false // external
+	if b.coin != cryptopay.BTC {
+		return b.account.Key.DeriveExtendedAddr(b.coin, kind, index)
+	}
+	k, err := b.account.Key.DeriveExtendedKey(kind, index)
+	if err != nil {
+		return "", err
+	}
+	return k.ScriptAddress(b.account.Type, b.account.Network)
+}
+
+func (b *Book) Get(id string) (*Invoice, error) {
+	return b.store.Get(id)
+}
+
+// Update matches the unspent outputs of the open invoices and returns the
+// invoices which changed.
+func (b *Book) Update(cx context.Context) ([]*Invoice, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	open, err := b.store.Open()
+	if err != nil {
+		return nil, err
+	}
+	if len(open) == 0 {
+		return nil, nil
+	}
+	var addrs []string
+	for _, inv := range open {
+		addrs = append(addrs, inv.Address)
+	}
+	unspent, err := b.unspender.Unspent(cx, addrs...)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	now := b.now()
+	var changed []*Invoice
+	for _, inv := range open {
+		if !b.match(inv, unspent[inv.Address], b.checked, now) {
+			continue
+		}
+		if err = b.store.Put(inv); err != nil {
+			return changed, err
+		}
+		changed = append(changed, inv)
+	}
+	b.checked = now
+	return changed, nil
+}
+
+// match updates the payments and the state of inv, checked before at
+// prev, zero if it's unknown, it reports if anything changed. A new payment
+// was made after prev, the polls don't delay it past the expiry.
+func (b *Book) match(inv *Invoice, una []cryptopay.Unspent, prev, now time.Time) bool {
+	before := *inv
+	before.Payments = append([]Payment(nil), inv.Payments...)
+	if prev.Before(inv.Created) {
+		prev = inv.Created
+	}
+	known := make(map[string]Payment)
+	for _, p := range inv.Payments {
+		known[paymentKey(p.Tx, p.N)] = p
+	}
+	var payments []Payment
+	if inv.Coin == cryptopay.ETH {
+		payments = b.matchETH(inv, una, prev, now)
+	} else {
+		// outputs swept from the address stay paid.
+		cur := make(map[string]bool)
+		for _, un := range una {
+			key := paymentKey(un.Tx, un.N)
+			cur[key] = true
+			p, ok := known[key]
+			if !ok {
+				p = Payment{Seen: now, After: prev}
+			}
+			payments = append(payments, Payment{Tx: un.Tx, N: un.N, Amount: un.Amount,
+				Confirmations: un.Confirmations, Seen: p.Seen, After: p.After})
+		}
+		for _, p := range inv.Payments {
+			if !cur[paymentKey(p.Tx, p.N)] && p.Confirmations >= b.Confirmations {
+				payments = append(payments, p)
+			}
+		}
+	}
+	inv.Payments = payments
+	inv.Received, inv.Unconfirmed = 0, 0
+	for _, p := range payments {
+		if !inv.Expires.IsZero() && p.After.After(inv.Expires) {
+			continue
+		}
+		if p.Confirmations >= b.Confirmations {
+			inv.Received += p.Amount
+		} else {
+			inv.Unconfirmed += p.Amount
+		}
+	}
+	inv.State = state(inv, now)
+	return !reflect.DeepEqual(*inv, before)
+}
+
+// matchETH returns the payments of the ethereum invoice inv: the increases
+// of its confirmed balance, which stay paid once swept, and the unconfirmed
+// increase. The unspent entries add up to the balance, like the confirmed
+// balance and the recent change of ethrpc.
+func (b *Book) matchETH(inv *Invoice, una []cryptopay.Unspent, prev, now time.Time) []Payment {
+	var payments []Payment
+	seen, after := now, prev
+	for _, p := range inv.Payments {
+		if p.Confirmations >= b.Confirmations {
+			payments = append(payments, p)
+		} else {
+			seen, after = p.Seen, p.After
+		}
+	}
+	var total, confirmed uint64
+	known := false // the confirmed balance
+	for _, un := range una {
+		total += un.Amount
+		if un.Confirmations >= b.Confirmations {
+			confirmed += un.Amount
+			known = true
+		}
+	}
+	// zero balances and spends from the address aren't payments.
+	if known {
+		if confirmed > inv.Balance {
+			payments = append(payments, Payment{Amount: confirmed - inv.Balance,
+				Confirmations: b.Confirmations, Seen: seen, After: after})
+		}
+		inv.Balance = confirmed
+	}
+	if total > inv.Balance {
+		payments = append(payments, Payment{Amount: total - inv.Balance, Seen: seen, After: after})
+	}
+	return payments
+}
+
+func state(inv *Invoice, now time.Time) State {
+	switch {
+	case inv.Received > inv.Amount:
+		return Overpaid
+	case inv.Received == inv.Amount:
+		return Paid
+	case !inv.Expires.IsZero() && now.After(inv.Expires) && inv.Unconfirmed == 0:
+		// unconfirmed payments seen in time may still complete it.
+		return Expired
+	case inv.Received > 0:
+		return PartiallyPaid
+	}
+	return Pending
+}
+
+func paymentKey(tx string, n uint32) string {
+	return fmt.Sprintf("%s:%d", tx, n)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
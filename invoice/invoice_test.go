@@ -0,0 +1,189 @@
+package invoice
+
+import (
+	"context"
+	"github.com/winteraz/cryptopay"
+	"github.com/winteraz/cryptopay/chaintest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func testBook(t *testing.T, chain *chaintest.Chain, store Store) *Book {
+	private, _, err := cryptopay.NewFromMnemonic(testMnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := private.DeriveExtendedAccountKey(false, cryptopay.BTC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New(pub.Base58(), cryptopay.BTC, chain, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func update(t *testing.T, b *Book, id string, want State) *Invoice {
+	if _, err := b.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	inv, err := b.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.State != want {
+		t.Fatalf("invoice %+v is %v, want %v", inv, inv.State, want)
+	}
+	return inv
+}
+
+func TestStates(t *testing.T) {
+	chain, err := chaintest.New(cryptopay.BTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := testBook(t, chain, NewMemStore(0))
+	inv, err := b.Create(100000, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := b.Create(50000, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Address == other.Address || other.Index != inv.Index+1 {
+		t.Fatalf("invoices share the address %v", inv.Address)
+	}
+
+	if _, err = chain.Fund(inv.Address, 40000); err != nil {
+		t.Fatal(err)
+	}
+	if got := update(t, b, inv.ID, Pending); got.Unconfirmed != 40000 {
+		t.Fatalf("unconfirmed %v, want 40000", got.Unconfirmed)
+	}
+	chain.Mine(1)
+	update(t, b, inv.ID, PartiallyPaid)
+	if _, err = chain.Fund(inv.Address, 70000); err != nil {
+		t.Fatal(err)
+	}
+	chain.Mine(1)
+	if got := update(t, b, inv.ID, Overpaid); got.Received != 110000 {
+		t.Fatalf("received %v, want 110000", got.Received)
+	}
+
+	// paid before the expiry and first seen after it, the poll was late.
+	last, err := b.Create(30000, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	update(t, b, last.ID, Pending)
+	if _, err = chain.Fund(last.Address, 30000); err != nil {
+		t.Fatal(err)
+	}
+	chain.Mine(1)
+	b.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	update(t, b, last.ID, Paid)
+
+	// paid after the expiry.
+	update(t, b, other.ID, Expired)
+	if _, err = chain.Fund(other.Address, 50000); err != nil {
+		t.Fatal(err)
+	}
+	chain.Mine(1)
+	if got := update(t, b, other.ID, Expired); got.Received != 0 {
+		t.Fatalf("received %v after the expiry", got.Received)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "invoice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "invoices.json")
+	chain, err := chaintest.New(cryptopay.BTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := OpenFile(file, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv, err := testBook(t, chain, s).Create(1000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Index != 5 {
+		t.Fatalf("index %v, want 5", inv.Index)
+	}
+
+	if s, err = OpenFile(file, 0); err != nil {
+		t.Fatal(err)
+	}
+	b := testBook(t, chain, s)
+	if _, err = chain.Fund(inv.Address, 1000); err != nil {
+		t.Fatal(err)
+	}
+	chain.Mine(1)
+	update(t, b, inv.ID, Paid)
+	next, err := b.Create(1000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Index != 6 {
+		t.Fatalf("index %v after reopening, want 6", next.Index)
+	}
+}
+
+func TestETH(t *testing.T) {
+	b := &Book{Confirmations: 2}
+	now := time.Now()
+	inv := &Invoice{Coin: cryptopay.ETH, Amount: 100000, Created: now, Expires: now.Add(time.Hour)}
+	for i, step := range []struct {
+		una      []cryptopay.Unspent
+		state    State
+		received uint64
+	}{
+		// every address has a balance, even empty.
+		{[]cryptopay.Unspent{{}}, Pending, 0},
+		{[]cryptopay.Unspent{{Amount: 40000}}, Pending, 0},
+		{[]cryptopay.Unspent{{Amount: 40000, Confirmations: 2}}, PartiallyPaid, 40000},
+		// swept by Move.
+		{[]cryptopay.Unspent{{Confirmations: 1}}, PartiallyPaid, 40000},
+		{[]cryptopay.Unspent{{Confirmations: 2}}, PartiallyPaid, 40000},
+		// like ethrpc, the balance of 12 blocks ago and the recent change.
+		{[]cryptopay.Unspent{{Confirmations: 12}, {Amount: 60000}}, PartiallyPaid, 40000},
+		{[]cryptopay.Unspent{{Amount: 60000, Confirmations: 12}}, Paid, 100000},
+	} {
+		b.match(inv, step.una, now, now)
+		if inv.State != step.state || inv.Received != step.received {
+			t.Fatalf("%d: invoice %+v, want %v %v", i, inv, step.state, step.received)
+		}
+	}
+	if inv.Unconfirmed != 0 || len(inv.Payments) != 2 {
+		t.Fatalf("payments %+v", inv.Payments)
+	}
+
+	// paid after the expiry, the empty balance seen before doesn't count.
+	later := now.Add(2 * time.Hour)
+	other := &Invoice{Coin: cryptopay.ETH, Amount: 50000, Created: now, Expires: now.Add(time.Hour)}
+	b.match(other, []cryptopay.Unspent{{Confirmations: 5}}, now, now)
+	b.match(other, []cryptopay.Unspent{{Amount: 50000, Confirmations: 2}}, later, later)
+	if other.State != Expired || other.Received != 0 {
+		t.Fatalf("invoice %+v paid after the expiry", other)
+	}
+	// first seen after the expiry but checked last before it.
+	other = &Invoice{Coin: cryptopay.ETH, Amount: 50000, Created: now, Expires: now.Add(time.Hour)}
+	b.match(other, []cryptopay.Unspent{{Confirmations: 5}}, now, now)
+	b.match(other, []cryptopay.Unspent{{Amount: 50000, Confirmations: 2}}, now, later)
+	if other.State != Paid || other.Received != 50000 {
+		t.Fatalf("invoice %+v paid before the expiry", other)
+	}
+}
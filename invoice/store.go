@@ -0,0 +1,140 @@
+package invoice
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// MemStore keeps the invoices in memory, the index restarts with the
+// process so it's only good for tests or a wallet with a single session.
+type MemStore struct {
+	mu       sync.Mutex
+	Next     uint32 // the index of the next invoice
+	Invoices map[string]*Invoice
+}
+
+func NewMemStore(next uint32) *MemStore {
+	return &MemStore{Next: next, Invoices: make(map[string]*Invoice)}
+}
+
+func (s *MemStore) NextIndex() (uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.Next
+	s.Next++
+	return n, nil
+}
+
+func (s *MemStore) Put(inv *Invoice) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *inv
+	c.Payments = append([]Payment(nil), inv.Payments...)
+	s.Invoices[inv.ID] = &c
+	return nil
+}
+
+func (s *MemStore) Get(id string) (*Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.Invoices[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *inv
+	c.Payments = append([]Payment(nil), inv.Payments...)
+	return &c, nil
+}
+
+func (s *MemStore) Open() ([]*Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*Invoice
+	for _, inv := range s.Invoices {
+		if inv.State.Closed() {
+			continue
+		}
+		c := *inv
+		c.Payments = append([]Payment(nil), inv.Payments...)
+		out = append(out, &c)
+	}
+	return out, nil
+}
+
+// FileStore is a MemStore saved as json to a file after every change.
+type FileStore struct {
+	mem  *MemStore
+	file string
+}
+
+// OpenFile loads the store from file, or starts at index next if the file
+// doesn't exist. Start after the addresses the wallet already gave away.
+func OpenFile(file string, next uint32) (*FileStore, error) {
+	s := &FileStore{mem: NewMemStore(next), file: file}
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, s.mem); err != nil {
+		return nil, err
+	}
+	if s.mem.Invoices == nil {
+		s.mem.Invoices = make(map[string]*Invoice)
+	}
+	return s, nil
+}
+
+func (s *FileStore) NextIndex() (uint32, error) {
+	n, err := s.mem.NextIndex()
+	if err != nil {
+		return 0, err
+	}
+	// the index is saved before the address is used.
+	return n, s.save()
+}
+
+func (s *FileStore) Put(inv *Invoice) error {
+	if err := s.mem.Put(inv); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func (s *FileStore) Get(id string) (*Invoice, error) {
+	return s.mem.Get(id)
+}
+
+func (s *FileStore) Open() ([]*Invoice, error) {
+	return s.mem.Open()
+}
+
+// save writes a temporary file and renames it so a crash never leaves half
+// a store.
+func (s *FileStore) save() error {
+	s.mem.mu.Lock()
+	b, err := json.MarshalIndent(s.mem, "", "  ")
+	s.mem.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.file), filepath.Base(s.file))
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.file)
+}
@@ -0,0 +1,304 @@
+// Package keystore keeps mnemonics and extended keys encrypted with a
+// password in a directory, one json file per wallet name.
+//
+// The password is stretched with scrypt, or argon2id, and the secret is
+// sealed with AES-256-GCM. The name and the KDF parameters are authenticated
+// with it, so a file can't be renamed or weakened without failing to load.
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/winteraz/cryptopay"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const version = 1
+
+// KDF names.
+const (
+	Scrypt   = "scrypt"
+	Argon2id = "argon2id"
+)
+
+var (
+	ErrNotFound      = errors.New("Keystore entry not found")
+	ErrExists        = errors.New("Keystore entry already exists")
+	ErrWrongPassword = errors.New("Wrong keystore password")
+)
+
+// Entry is the secret of a wallet, a mnemonic and its passphrase or an
+// extended key.
+type Entry struct {
+	Mnemonic   string `json:"mnemonic,omitempty"`
+	Passphrase string `json:"passphrase,omitempty"`
+	// Key is a base58 extended key, private or public.
+	Key string `json:"key,omitempty"`
+}
+
+// KeyEntry returns the entry of an extended key.
+func KeyEntry(k *cryptopay.Key) *Entry {
+	return &Entry{Key: k.Base58()}
+}
+
+// Master returns the master key of the mnemonic, or the extended key.
+func (e *Entry) Master() (*cryptopay.Key, error) {
+	if e.Mnemonic != "" {
+		k, _, err := cryptopay.NewFromMnemonic(e.Mnemonic, e.Passphrase)
+		return k, err
+	}
+	if e.Key != "" {
+		return cryptopay.ParseKey(e.Key)
+	}
+	return nil, errors.New("Empty keystore entry")
+}
+
+// Params are the cost of the KDF. The zero values are the defaults.
+type Params struct {
+	KDF string `json:"kdf"`
+	// scrypt
+	N int `json:"n,omitempty"`
+	R int `json:"r,omitempty"`
+	P int `json:"p,omitempty"`
+	// argon2id, memory in KiB.
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"`
+	Threads uint8  `json:"threads,omitempty"`
+	Salt    string `json:"salt"`
+}
+
+// DefaultParams cost about a second, like geth's standard scrypt keys.
+var DefaultParams = Params{KDF: Scrypt, N: 1 << 18, R: 8, P: 1}
+
+// LightParams are for tests and weak devices.
+var LightParams = Params{KDF: Scrypt, N: 1 << 12, R: 8, P: 1}
+
+func (p Params) key(password string) ([]byte, error) {
+	salt, err := hex.DecodeString(p.Salt)
+	if err != nil || len(salt) < 16 {
+		return nil, errors.New("Invalid keystore salt")
+	}
+	switch p.KDF {
+	case Scrypt:
+		return scrypt.Key([]byte(password), salt, p.N, p.R, p.P, 32)
+	case Argon2id:
+		if p.Time == 0 || p.Memory == 0 || p.Threads == 0 {
+			return nil, errors.New("Invalid argon2id parameters")
+		}
+		return argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, 32), nil
+	}
+	return nil, fmt.Errorf("Unknown KDF %q", p.KDF)
+}
+
+// file is the json of an entry.
+type file struct {
+	Version    int    `json:"version"`
+	Name       string `json:"name"`
+	Params     Params `json:"kdfparams"`
+	Cipher     string `json:"cipher"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// additional returns the data authenticated with the secret.
+func (f *file) additional() []byte {
+	p := f.Params
+	return []byte(fmt.Sprintf("%d/%s/%s/%d/%d/%d/%d/%d/%d/%s",
+		f.Version, f.Name, p.KDF, p.N, p.R, p.P, p.Time, p.Memory, p.Threads, p.Salt))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt seals the entry with the password.
+func Encrypt(name string, e *Entry, password string, p Params) ([]byte, error) {
+	if password == "" {
+		return nil, errors.New("Invalid password/empty")
+	}
+	if p.KDF == "" {
+		p = DefaultParams
+	}
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	p.Salt = hex.EncodeToString(salt)
+	key, err := p.key(password)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	plain, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	f := &file{Version: version, Name: name, Params: p, Cipher: "aes-256-gcm", Nonce: hex.EncodeToString(nonce)}
+	f.Ciphertext = hex.EncodeToString(gcm.Seal(nil, nonce, plain, f.additional()))
+	return json.MarshalIndent(f, "", "  ")
+}
+
+// Decrypt opens an entry sealed by Encrypt.
+func Decrypt(b []byte, password string) (name string, e *Entry, err error) {
+	f := new(file)
+	if err = json.Unmarshal(b, f); err != nil {
+		return "", nil, err
+	}
+	if f.Version != version || f.Cipher != "aes-256-gcm" {
+		return "", nil, fmt.Errorf("Unsupported keystore version %v, cipher %q", f.Version, f.Cipher)
+	}
+	key, err := f.Params.key(password)
+	if err != nil {
+		return "", nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", nil, err
+	}
+	nonce, err := hex.DecodeString(f.Nonce)
+	if err != nil || len(nonce) != gcm.NonceSize() {
+		return "", nil, errors.New("Invalid keystore nonce")
+	}
+	sealed, err := hex.DecodeString(f.Ciphertext)
+	if err != nil {
+		return "", nil, err
+	}
+	plain, err := gcm.Open(nil, nonce, sealed, f.additional())
+	if err != nil {
+		return "", nil, ErrWrongPassword
+	}
+	e = new(Entry)
+	if err = json.Unmarshal(plain, e); err != nil {
+		return "", nil, err
+	}
+	return f.Name, e, nil
+}
+
+// Store is a directory of entries.
+type Store struct {
+	dir string
+	// Params of the new entries, DefaultParams if they are zero.
+	Params Params
+}
+
+// Open opens the keystore in dir, creating it if it doesn't exist.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) file(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("Invalid keystore name %q", name)
+	}
+	return filepath.Join(s.dir, name+".json"), nil
+}
+
+// Save encrypts the entry under name. It doesn't overwrite entries, see
+// Delete.
+func (s *Store) Save(name string, e *Entry, password string) error {
+	file, err := s.file(name)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(file); err == nil {
+		return ErrExists
+	}
+	b, err := Encrypt(name, e, password, s.Params)
+	if err != nil {
+		return err
+	}
+	// a temporary file renamed so a crash never leaves half an entry.
+	tmp, err := ioutil.TempFile(s.dir, "."+name)
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// Load decrypts the entry saved under name.
+func (s *Store) Load(name, password string) (*Entry, error) {
+	file, err := s.file(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	saved, e, err := Decrypt(b, password)
+	if err != nil {
+		return nil, err
+	}
+	if saved != name {
+		return nil, fmt.Errorf("Keystore file %s holds %q", file, saved)
+	}
+	return e, nil
+}
+
+// Delete removes the entry of name.
+func (s *Store) Delete(name string) error {
+	file, err := s.file(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(file)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// List returns the names of the entries.
+func (s *Store) List() ([]string, error) {
+	fa, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range fa {
+		n := f.Name()
+		if f.IsDir() || strings.HasPrefix(n, ".") || !strings.HasSuffix(n, ".json") {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(n, ".json"))
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,86 @@
+package keystore
+
+import (
+	"bytes"
+	"github.com/winteraz/cryptopay"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Params = LightParams
+	e := &Entry{Mnemonic: testMnemonic, Passphrase: "TREZOR"}
+	if err = s.Save("main", e, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Save("main", e, "secret"); err != ErrExists {
+		t.Fatalf("overwrote the entry, %v", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "main.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("abandon")) {
+		t.Fatal("the mnemonic is in clear")
+	}
+	if _, err = s.Load("main", "wrong"); err != ErrWrongPassword {
+		t.Fatalf("got %v, want ErrWrongPassword", err)
+	}
+	got, err := s.Load("main", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *e {
+		t.Fatalf("got %+v, want %+v", got, e)
+	}
+	master, err := got.Master()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _, err := cryptopay.NewFromMnemonic(testMnemonic, "TREZOR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if master.Base58() != want.Base58() {
+		t.Fatal("wrong master key")
+	}
+
+	// renamed files don't load.
+	if err = os.Rename(filepath.Join(dir, "main.json"), filepath.Join(dir, "other.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Load("other", "secret"); err == nil {
+		t.Fatalf("loaded a renamed entry, %v", err)
+	}
+
+	s.Params = Params{KDF: Argon2id, Time: 1, Memory: 1 << 10, Threads: 1}
+	if err = s.Save("key", KeyEntry(want), "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = s.Load("key", "secret"); err != nil || got.Key != want.Base58() {
+		t.Fatalf("got %+v, %v", got, err)
+	}
+	names, err := s.List()
+	if err != nil || len(names) != 2 || names[0] != "key" || names[1] != "other" {
+		t.Fatalf("got %q, %v", names, err)
+	}
+	if err = s.Delete("key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Load("key", "secret"); err != ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,108 @@
+package cryptopay
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/tyler-smith/go-bip39/wordlists"
+	"math/big"
+	"strings"
+)
+
+// Language of a BIP 39 wordlist, numbered like the BIP 85 language codes.
+type Language int
+
+const (
+	English Language = iota
+	Japanese
+	Korean
+	Spanish
+	ChineseSimplified
+	ChineseTraditional
+	French
+	Italian
+	Czech
+	Portuguese
+)
+
+var languageNames = []string{"english", "japanese", "korean", "spanish",
+	"chinese_simplified", "chinese_traditional", "french", "italian", "czech", "portuguese"}
+
+func (l Language) String() string {
+	if l < 0 || int(l) >= len(languageNames) {
+		return fmt.Sprintf("Language(%d)", int(l))
+	}
+	return languageNames[l]
+}
+
+// ParseLanguage parses the names of String.
+func ParseLanguage(s string) (Language, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i, name := range languageNames {
+		if s == name {
+			return Language(i), nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown language %q", s)
+}
+
+// Wordlist returns the 2048 words of the language. They come from
+// tyler-smith/go-bip39, the upstream of the bartekn/go-bip39 fork used for the
+// entropy, which only has the English one.
+func (l Language) Wordlist() ([]string, error) {
+	switch l {
+	case English:
+		return wordlists.English, nil
+	case Japanese:
+		return wordlists.Japanese, nil
+	case Korean:
+		return wordlists.Korean, nil
+	case Spanish:
+		return wordlists.Spanish, nil
+	case ChineseSimplified:
+		return wordlists.ChineseSimplified, nil
+	case ChineseTraditional:
+		return wordlists.ChineseTraditional, nil
+	case French:
+		return wordlists.French, nil
+	case Italian:
+		return wordlists.Italian, nil
+	case Czech:
+		return wordlists.Czech, nil
+	case Portuguese:
+		// go-bip39 doesn't have it, bip-0039/portuguese.txt is to be
+		// vendored like slip39_words.go.
+	}
+	return nil, fmt.Errorf("No %s wordlist", l)
+}
+
+// separator of the words, japanese mnemonics use the ideographic space.
+func (l Language) separator() string {
+	if l == Japanese {
+		return "　"
+	}
+	return " "
+}
+
+// NewMnemonicLanguage encodes 128 to 256 bits of entropy in a BIP 39
+// mnemonic of the language.
+func NewMnemonicLanguage(entropy []byte, lang Language) (string, error) {
+	if len(entropy) < 16 || len(entropy) > 32 || len(entropy)%4 != 0 {
+		return "", fmt.Errorf("Invalid entropy of %v bits", len(entropy)*8)
+	}
+	list, err := lang.Wordlist()
+	if err != nil {
+		return "", err
+	}
+	// the checksum is the first bits of the hash, one per 32 bits.
+	sum := sha256.Sum256(entropy)
+	checksumBits := uint(len(entropy) / 4)
+	n := new(big.Int).SetBytes(entropy)
+	n.Lsh(n, checksumBits).Or(n, big.NewInt(int64(sum[0]>>(8-checksumBits))))
+	words := make([]string, (len(entropy)*8+int(checksumBits))/11)
+	mask := big.NewInt(2047)
+	for i := len(words) - 1; i >= 0; i-- {
+		words[i] = list[new(big.Int).And(n, mask).Int64()]
+		n.Rsh(n, 11)
+	}
+	return strings.Join(words, lang.separator()), nil
+}
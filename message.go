@@ -0,0 +1,286 @@
+package cryptopay
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"strings"
+)
+
+// ErrInvalidSignature is a signature not made by the address.
+var ErrInvalidSignature = errors.New("Invalid signature")
+
+// SignMessageBTC proves the ownership of the address of type typ of the key,
+// see ScriptAddress. P2PKH signs the legacy signmessage format, the segwit
+// and taproot types BIP 322: the simple format for P2WPKH and P2TR, the full
+// one for P2SH. The signature is base64.
+func (k *Key) SignMessageBTC(typ AddressType, network Network, msg string) (string, error) {
+	priv, err := (*hdkeychain.ExtendedKey)(k).ECPrivKey()
+	if err != nil {
+		return "", err
+	}
+	if typ == P2PKH {
+		sig, err := btcec.SignCompact(btcec.S256(), priv, legacyMessageHash(msg), true)
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(sig), nil
+	}
+	addr, err := k.ScriptAddress(typ, network)
+	if err != nil {
+		return "", err
+	}
+	script, _, err := addressScript(network, addr)
+	if err != nil {
+		return "", err
+	}
+	toSign := bip322ToSign(script, msg)
+	in := toSign.TxIn[0]
+	switch typ {
+	case P2SH, P2WPKH:
+		program := append([]byte{0x00, 0x14}, btcutil.Hash160(priv.PubKey().SerializeCompressed())...)
+		in.Witness, err = txscript.WitnessSignature(toSign, txscript.NewTxSigHashes(toSign), 0, 0, program, txscript.SigHashAll, priv, true)
+		if err != nil {
+			return "", err
+		}
+		if typ == P2SH {
+			if in.SignatureScript, err = txscript.NewScriptBuilder().AddData(program).Script(); err != nil {
+				return "", err
+			}
+			var buf bytes.Buffer
+			if err = toSign.Serialize(&buf); err != nil {
+				return "", err
+			}
+			return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+		}
+	case P2TR:
+		d, err := taprootSecret(priv)
+		if err != nil {
+			return "", err
+		}
+		hash, err := taprootSigHash(toSign, script, 0, 0)
+		if err != nil {
+			return "", err
+		}
+		aux := make([]byte, 32)
+		if _, err = rand.Read(aux); err != nil {
+			return "", err
+		}
+		sig, err := schnorrSign(d, hash, aux)
+		if err != nil {
+			return "", err
+		}
+		in.Witness = wire.TxWitness{sig}
+	default:
+		return "", fmt.Errorf("Can't sign messages of %s addresses", typ)
+	}
+	var buf bytes.Buffer
+	if err = writeWitness(&buf, in.Witness); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// VerifyMessageBTC checks the base64 signature of msg by the bitcoin address
+// of the main or test network, nil means it's signed by the address.
+// It takes the legacy signmessage format, of P2PKH and, like some hardware
+// wallets sign, of P2SH-P2WPKH and P2WPKH, and BIP 322 simple and full.
+func VerifyMessageBTC(address, msg, signature string) error {
+	network := MainNet
+	if _, err := ValidateAddress(BTC, network, address); err != nil {
+		network = TestNet
+	}
+	script, typ, err := addressScript(network, address)
+	if err != nil {
+		return err
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+	if len(sig) == 65 && sig[0] >= 27 && sig[0] <= 42 {
+		return verifyLegacyMessage(address, typ, network, msg, sig)
+	}
+	toSign := bip322ToSign(script, msg)
+	switch typ {
+	case P2PKH, P2SH:
+		var full wire.MsgTx
+		if err = full.Deserialize(bytes.NewReader(sig)); err != nil {
+			return err
+		}
+		if len(full.TxIn) != 1 || full.TxIn[0].PreviousOutPoint != toSign.TxIn[0].PreviousOutPoint {
+			return ErrInvalidSignature
+		}
+		toSign.TxIn[0].SignatureScript = full.TxIn[0].SignatureScript
+		toSign.TxIn[0].Witness = full.TxIn[0].Witness
+	default:
+		if toSign.TxIn[0].Witness, err = readWitness(bytes.NewReader(sig)); err != nil {
+			return err
+		}
+	}
+	if typ == P2TR {
+		w := toSign.TxIn[0].Witness
+		if len(w) != 1 || len(w[0]) != 64 && len(w[0]) != 65 {
+			return ErrInvalidSignature
+		}
+		// 65 bytes have an explicit hash type, only SIGHASH_ALL is sane.
+		hashType := byte(0)
+		if len(w[0]) == 65 {
+			if hashType = w[0][64]; hashType != byte(txscript.SigHashAll) {
+				return ErrInvalidSignature
+			}
+		}
+		hash, err := taprootSigHash(toSign, script, 0, hashType)
+		if err != nil {
+			return err
+		}
+		if !schnorrVerify(script[2:], hash, w[0][:64]) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+	vm, err := txscript.NewEngine(script, toSign, 0, txscript.StandardVerifyFlags, nil, txscript.NewTxSigHashes(toSign), 0)
+	if err != nil {
+		return err
+	}
+	if err = vm.Execute(); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func verifyLegacyMessage(address string, typ AddressType, network Network, msg string, sig []byte) error {
+	header := sig[0]
+	// 35 to 38 is P2SH-P2WPKH, 39 to 42 P2WPKH, both compressed.
+	switch {
+	case header >= 39:
+		header -= 12
+	case header >= 35:
+		header -= 8
+	}
+	pub, compressed, err := btcec.RecoverCompact(btcec.S256(), append([]byte{header}, sig[1:]...), legacyMessageHash(msg))
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	hash := btcutil.Hash160(serializePub(pub, compressed))
+	p := network.Params()
+	var got string
+	switch {
+	case typ == P2PKH:
+		got = base58.CheckEncode(hash, p.PubKeyHashAddrID)
+	case typ == P2SH && compressed:
+		redeem := append([]byte{0x00, 0x14}, hash...)
+		got = base58.CheckEncode(btcutil.Hash160(redeem), p.ScriptHashAddrID)
+	case typ == P2WPKH && compressed:
+		got = segwitEncode(network, 0, hash)
+	}
+	if !strings.EqualFold(got, address) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func legacyMessageHash(msg string) []byte {
+	var buf bytes.Buffer
+	wire.WriteVarString(&buf, 0, "Bitcoin Signed Message:\n")
+	wire.WriteVarString(&buf, 0, msg)
+	return sha256d(buf.Bytes())
+}
+
+// https://github.com/bitcoin/bips/blob/master/bip-0322.mediawiki
+func bip322ToSign(script []byte, msg string) *wire.MsgTx {
+	hash := taggedHash("BIP0322-signed-message", []byte(msg))
+	sigScript := append([]byte{txscript.OP_0, txscript.OP_DATA_32}, hash...)
+	toSpend := wire.NewMsgTx(0)
+	in := wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, 0xffffffff), sigScript, nil)
+	in.Sequence = 0
+	toSpend.AddTxIn(in)
+	toSpend.AddTxOut(wire.NewTxOut(0, script))
+
+	toSign := wire.NewMsgTx(0)
+	h := toSpend.TxHash()
+	in = wire.NewTxIn(wire.NewOutPoint(&h, 0), nil, nil)
+	in.Sequence = 0
+	toSign.AddTxIn(in)
+	toSign.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN}))
+	return toSign
+}
+
+func writeWitness(buf *bytes.Buffer, w wire.TxWitness) error {
+	if err := wire.WriteVarInt(buf, 0, uint64(len(w))); err != nil {
+		return err
+	}
+	for _, item := range w {
+		if err := wire.WriteVarBytes(buf, 0, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readWitness(r *bytes.Reader) (wire.TxWitness, error) {
+	n, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if n > 500 {
+		return nil, errors.New("Invalid witness")
+	}
+	w := make(wire.TxWitness, n)
+	for i := range w {
+		if w[i], err = wire.ReadVarBytes(r, 0, 10000, "witness"); err != nil {
+			return nil, err
+		}
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("Invalid witness")
+	}
+	return w, nil
+}
+
+// addressScript returns the script the bitcoin address pays to.
+func addressScript(network Network, addr string) ([]byte, AddressType, error) {
+	typ, err := ValidateAddress(BTC, network, addr)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch typ {
+	case P2PKH:
+		hash, _, err := base58.CheckDecode(addr)
+		if err != nil {
+			return nil, 0, err
+		}
+		script, err := txscript.NewScriptBuilder().AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).
+			AddData(hash).AddOp(txscript.OP_EQUALVERIFY).AddOp(txscript.OP_CHECKSIG).Script()
+		return script, typ, err
+	case P2SH:
+		hash, _, err := base58.CheckDecode(addr)
+		if err != nil {
+			return nil, 0, err
+		}
+		script, err := txscript.NewScriptBuilder().AddOp(txscript.OP_HASH160).AddData(hash).AddOp(txscript.OP_EQUAL).Script()
+		return script, typ, err
+	}
+	hrp := "bc"
+	if network == TestNet {
+		hrp = "tb"
+	}
+	version, program, err := witnessProgram(hrp, strings.ToLower(addr))
+	if err != nil {
+		return nil, 0, err
+	}
+	op := byte(txscript.OP_0)
+	if version > 0 {
+		op = txscript.OP_1 + version - 1
+	}
+	return append([]byte{op, byte(len(program))}, program...), typ, nil
+}
@@ -0,0 +1,347 @@
+package cryptopay
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SignMessageETH signs msg like personal_sign, EIP-191 version 0x45. The
+// signature is the 0x hex of r, s and v (27 or 28).
+func (k *Key) SignMessageETH(msg []byte) (string, error) {
+	return k.signETH(ethMessageHash(msg))
+}
+
+// RecoverMessageETH returns the EIP-55 address of the signer of msg.
+func RecoverMessageETH(msg []byte, signature string) (string, error) {
+	return recoverETH(ethMessageHash(msg), signature)
+}
+
+// VerifyMessageETH checks the personal_sign signature of msg by address.
+func VerifyMessageETH(address string, msg []byte, signature string) error {
+	return verifyETH(address, ethMessageHash(msg), signature)
+}
+
+func ethMessageHash(msg []byte) []byte {
+	prefix := fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(msg))
+	return crypto.Keccak256([]byte(prefix), msg)
+}
+
+func (k *Key) signETH(hash []byte) (string, error) {
+	priv, err := (*hdkeychain.ExtendedKey)(k).ECPrivKey()
+	if err != nil {
+		return "", err
+	}
+	sig, err := btcec.SignCompact(btcec.S256(), priv, hash, false)
+	if err != nil {
+		return "", err
+	}
+	// the compact header is 27 plus the recovery id, ethereum puts it last.
+	return "0x" + hex.EncodeToString(append(sig[1:], sig[0])), nil
+}
+
+func recoverETH(hash []byte, signature string) (string, error) {
+	sig, err := hex.DecodeString(strings.TrimPrefix(signature, "0x"))
+	if err != nil {
+		return "", err
+	}
+	if len(sig) != 65 {
+		return "", fmt.Errorf("Invalid signature of %v bytes", len(sig))
+	}
+	v := sig[64]
+	if v < 27 {
+		v += 27
+	}
+	if v != 27 && v != 28 {
+		return "", fmt.Errorf("Invalid signature v %v", sig[64])
+	}
+	pub, _, err := btcec.RecoverCompact(btcec.S256(), append([]byte{v}, sig[:64]...), hash)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	return ethPubAddress(pub), nil
+}
+
+func verifyETH(address string, hash []byte, signature string) error {
+	if _, err := ValidateAddress(ETH, MainNet, address); err != nil {
+		return err
+	}
+	got, err := recoverETH(hash, signature)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(got, address) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// ethPubAddress returns the EIP-55 address of pub.
+func ethPubAddress(pub *btcec.PublicKey) string {
+	addr := hex.EncodeToString(crypto.Keccak256(pub.SerializeUncompressed()[1:])[12:])
+	sum := crypto.Keccak256([]byte(addr))
+	b := []byte(addr)
+	for i := range b {
+		if b[i] >= 'a' && sum[i/2]>>(4*uint(1-i%2))&0xf >= 8 {
+			b[i] -= 'a' - 'A'
+		}
+	}
+	return "0x" + string(b)
+}
+
+// https://eips.ethereum.org/EIPS/eip-712
+
+// TypedDataField is a member of an EIP-712 struct type.
+type TypedDataField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// TypedData is the eth_signTypedData_v4 JSON. Types includes EIP712Domain.
+type TypedData struct {
+	Types       map[string][]TypedDataField `json:"types"`
+	PrimaryType string                      `json:"primaryType"`
+	Domain      map[string]interface{}      `json:"domain"`
+	Message     map[string]interface{}      `json:"message"`
+}
+
+// ParseTypedData parses the JSON of typed data, keeping the numbers exact.
+func ParseTypedData(b []byte) (*TypedData, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var t TypedData
+	if err := d.Decode(&t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Hash returns the EIP-712 hash of the message in the domain, the one
+// signed.
+func (t *TypedData) Hash() ([]byte, error) {
+	domain, err := t.hashStruct("EIP712Domain", t.Domain)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := t.hashStruct(t.PrimaryType, t.Message)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Keccak256([]byte{0x19, 0x01}, domain, msg), nil
+}
+
+// SignTypedData signs the typed data like eth_signTypedData_v4.
+func (k *Key) SignTypedData(t *TypedData) (string, error) {
+	hash, err := t.Hash()
+	if err != nil {
+		return "", err
+	}
+	return k.signETH(hash)
+}
+
+// RecoverTypedData returns the EIP-55 address of the signer of t.
+func RecoverTypedData(t *TypedData, signature string) (string, error) {
+	hash, err := t.Hash()
+	if err != nil {
+		return "", err
+	}
+	return recoverETH(hash, signature)
+}
+
+// VerifyTypedData checks the signature of t by address.
+func VerifyTypedData(address string, t *TypedData, signature string) error {
+	hash, err := t.Hash()
+	if err != nil {
+		return err
+	}
+	return verifyETH(address, hash, signature)
+}
+
+func (t *TypedData) hashStruct(typ string, data map[string]interface{}) ([]byte, error) {
+	fields, ok := t.Types[typ]
+	if !ok {
+		return nil, fmt.Errorf("Unknown EIP-712 type %q", typ)
+	}
+	enc := [][]byte{crypto.Keccak256([]byte(t.encodeType(typ)))}
+	for _, f := range fields {
+		v, ok := data[f.Name]
+		if !ok {
+			return nil, fmt.Errorf("Missing EIP-712 field %s.%s", typ, f.Name)
+		}
+		b, err := t.encodeValue(f.Type, v)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", typ, f.Name, err)
+		}
+		enc = append(enc, b)
+	}
+	return crypto.Keccak256(enc...), nil
+}
+
+// encodeType is the type followed by the struct types it references,
+// sorted.
+func (t *TypedData) encodeType(typ string) string {
+	deps := map[string]bool{}
+	t.dependencies(typ, deps)
+	delete(deps, typ)
+	names := []string{typ}
+	var sorted []string
+	for name := range deps {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	var b strings.Builder
+	for _, name := range append(names, sorted...) {
+		var members []string
+		for _, f := range t.Types[name] {
+			members = append(members, f.Type+" "+f.Name)
+		}
+		b.WriteString(name + "(" + strings.Join(members, ",") + ")")
+	}
+	return b.String()
+}
+
+func (t *TypedData) dependencies(typ string, found map[string]bool) {
+	if i := strings.Index(typ, "["); i >= 0 {
+		typ = typ[:i]
+	}
+	if _, ok := t.Types[typ]; !ok || found[typ] {
+		return
+	}
+	found[typ] = true
+	for _, f := range t.Types[typ] {
+		t.dependencies(f.Type, found)
+	}
+}
+
+// encodeValue returns the 32 bytes of v of type typ.
+func (t *TypedData) encodeValue(typ string, v interface{}) ([]byte, error) {
+	if strings.HasSuffix(typ, "]") {
+		items, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Invalid %s array %v", typ, v)
+		}
+		base := typ[:strings.LastIndex(typ, "[")]
+		var enc [][]byte
+		for _, item := range items {
+			b, err := t.encodeValue(base, item)
+			if err != nil {
+				return nil, err
+			}
+			enc = append(enc, b)
+		}
+		return crypto.Keccak256(enc...), nil
+	}
+	if _, ok := t.Types[typ]; ok {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Invalid %s struct %v", typ, v)
+		}
+		return t.hashStruct(typ, m)
+	}
+	switch {
+	case typ == "string":
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("Invalid string %v", v)
+		}
+		return crypto.Keccak256([]byte(s)), nil
+	case typ == "bytes":
+		b, err := typedBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.Keccak256(b), nil
+	case typ == "bool":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("Invalid bool %v", v)
+		}
+		out := make([]byte, 32)
+		if b {
+			out[31] = 1
+		}
+		return out, nil
+	case typ == "address":
+		b, err := typedBytes(v)
+		if err != nil || len(b) != 20 {
+			return nil, fmt.Errorf("Invalid address %v", v)
+		}
+		return append(make([]byte, 12), b...), nil
+	case strings.HasPrefix(typ, "bytes"):
+		n, err := strconv.Atoi(typ[5:])
+		if err != nil || n < 1 || n > 32 {
+			return nil, fmt.Errorf("Invalid type %s", typ)
+		}
+		b, err := typedBytes(v)
+		if err != nil || len(b) > n {
+			return nil, fmt.Errorf("Invalid %s %v", typ, v)
+		}
+		return append(b, make([]byte, 32-len(b))...), nil
+	case strings.HasPrefix(typ, "uint"), strings.HasPrefix(typ, "int"):
+		n, err := typedInteger(v)
+		if err != nil {
+			return nil, err
+		}
+		if n.Sign() < 0 {
+			if strings.HasPrefix(typ, "uint") {
+				return nil, fmt.Errorf("Negative %s %v", typ, n)
+			}
+			// two's complement.
+			n.Add(n, new(big.Int).Lsh(big.NewInt(1), 256))
+		}
+		if n.BitLen() > 256 {
+			return nil, fmt.Errorf("Invalid %s %v", typ, n)
+		}
+		return pad32(n), nil
+	}
+	return nil, fmt.Errorf("Unknown EIP-712 type %q", typ)
+}
+
+func typedBytes(v interface{}) ([]byte, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("Invalid bytes %v", v)
+	}
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
+
+func typedInteger(v interface{}) (*big.Int, error) {
+	var s string
+	switch v := v.(type) {
+	case json.Number:
+		s = v.String()
+	case string:
+		s = v
+	case float64:
+		if v != float64(int64(v)) {
+			return nil, fmt.Errorf("Invalid integer %v", v)
+		}
+		return big.NewInt(int64(v)), nil
+	case int:
+		return big.NewInt(int64(v)), nil
+	case int64:
+		return big.NewInt(v), nil
+	case uint64:
+		return new(big.Int).SetUint64(v), nil
+	default:
+		return nil, fmt.Errorf("Invalid integer %v", v)
+	}
+	base := 10
+	if strings.HasPrefix(s, "0x") {
+		s, base = s[2:], 16
+	}
+	n, ok := new(big.Int).SetString(s, base)
+	if !ok {
+		return nil, errors.New("Invalid integer " + s)
+	}
+	return n, nil
+}
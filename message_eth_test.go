@@ -0,0 +1,99 @@
+package cryptopay
+
+import (
+	"encoding/hex"
+	"github.com/ethereum/go-ethereum/crypto"
+	"testing"
+)
+
+// the example of EIP-712, signed by the key of keccak256("cow").
+const mailTypedData = `{
+	"types": {
+		"EIP712Domain": [
+			{"name": "name", "type": "string"},
+			{"name": "version", "type": "string"},
+			{"name": "chainId", "type": "uint256"},
+			{"name": "verifyingContract", "type": "address"}
+		],
+		"Person": [
+			{"name": "name", "type": "string"},
+			{"name": "wallet", "type": "address"}
+		],
+		"Mail": [
+			{"name": "from", "type": "Person"},
+			{"name": "to", "type": "Person"},
+			{"name": "contents", "type": "string"}
+		]
+	},
+	"primaryType": "Mail",
+	"domain": {
+		"name": "Ether Mail",
+		"version": "1",
+		"chainId": 1,
+		"verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+	},
+	"message": {
+		"from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+		"to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+		"contents": "Hello, Bob!"
+	}
+}`
+
+const cowAddress = "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"
+
+func cowKey(t *testing.T) *Key {
+	k, err := NewKeyFromPrivate(crypto.Keccak256([]byte("cow")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestTypedData(t *testing.T) {
+	td, err := ParseTypedData([]byte(mailTypedData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := td.encodeType("Mail"); got != "Mail(Person from,Person to,string contents)Person(string name,address wallet)" {
+		t.Errorf("encodeType %s", got)
+	}
+	hash, err := td.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(hash); got != "be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2" {
+		t.Errorf("hash %s", got)
+	}
+	sig, err := cowKey(t).SignTypedData(td)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "0x4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b915621c"
+	if sig != want {
+		t.Errorf("signature %s", sig)
+	}
+	if got, err := RecoverTypedData(td, sig); err != nil || got != cowAddress {
+		t.Errorf("recovered %s, %v", got, err)
+	}
+	td.Message["contents"] = "Hello, Alice!"
+	if err = VerifyTypedData(cowAddress, td, sig); err != ErrInvalidSignature {
+		t.Errorf("verified another message, %v", err)
+	}
+}
+
+func TestSignMessageETH(t *testing.T) {
+	k := cowKey(t)
+	sig, err := k.SignMessageETH([]byte("proof of ownership"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyMessageETH(cowAddress, []byte("proof of ownership"), sig); err != nil {
+		t.Error(err)
+	}
+	if err = VerifyMessageETH("0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB", []byte("proof of ownership"), sig); err != ErrInvalidSignature {
+		t.Errorf("verified another address, %v", err)
+	}
+	if got, err := RecoverMessageETH([]byte("proof"), sig); err != nil || got == cowAddress {
+		t.Errorf("recovered %s of another message, %v", got, err)
+	}
+}
@@ -0,0 +1,104 @@
+package cryptopay
+
+import (
+	"encoding/hex"
+	"github.com/btcsuite/btcutil"
+	"math/big"
+	"testing"
+)
+
+// BIP 340 test vector 0.
+func TestSchnorr(t *testing.T) {
+	msg := make([]byte, 32)
+	sig, err := schnorrSign(big.NewInt(3), msg, make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "e907831f80848d1069a5371b402410364bdf1c5f8307b0084c55f1ce2dca821525f66a4a85ea8b71e482a74f382d2ce5ebeee8fdb2172f477df4900d310536c0"
+	if got := hex.EncodeToString(sig); got != want {
+		t.Errorf("got %s", got)
+	}
+	pub, _ := hex.DecodeString("f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9")
+	if !schnorrVerify(pub, msg, sig) {
+		t.Error("not verified")
+	}
+	msg[0] = 1
+	if schnorrVerify(pub, msg, sig) {
+		t.Error("verified another message")
+	}
+}
+
+// BIP 322 test vectors.
+func TestVerifyBIP322(t *testing.T) {
+	if got := hex.EncodeToString(taggedHash("BIP0322-signed-message", []byte("Hello World"))); got != "f0eb03b1a75ac6d9847f55c624a99169b5dccba2a31f5b23bea77ba270de0a7a" {
+		t.Errorf("message hash %s", got)
+	}
+	const addr = "bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l"
+	for msg, sig := range map[string]string{
+		"":            "AkcwRAIgM2gBAQqvZX15ZiysmKmQpDrG83avLIT492QBzLnQIxYCIBaTpOaD20qRlEylyxFSeEA2ba9YOixpX8z46TSDtS40ASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+		"Hello World": "AkcwRAIgZRfIY3p7/DoVTty6YZbWS71bc5Vct9p9Fia83eRmw2QCICK/ENGfwLtptFluMGs2KsqoNSk89pO7F29zJLUx9a/sASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+	} {
+		if err := VerifyMessageBTC(addr, msg, sig); err != nil {
+			t.Errorf("%q: %v", msg, err)
+		}
+		if err := VerifyMessageBTC(addr, msg+"!", sig); err != ErrInvalidSignature {
+			t.Errorf("%q: verified another message, %v", msg, err)
+		}
+	}
+	w, err := btcutil.DecodeWIF("L3VFeEujGtevx9w18HD1fhRbCH67Az2dpCymeRE1SoPK6XQtaN2k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := NewKeyFromPrivate(pad32(w.PrivKey.D))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := k.SignMessageBTC(P2WPKH, MainNet, "Hello World")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// bitcoin core grinds a low R, the signature differs from the vector.
+	if err = VerifyMessageBTC(addr, "Hello World", sig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSignMessageBTC(t *testing.T) {
+	master, _, err := NewFromMnemonic(testMnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := master.Derive(Path{Hardened(84), Hardened(0), Hardened(0), 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := master.Derive(Path{Hardened(84), Hardened(0), Hardened(0), 0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, typ := range []AddressType{P2PKH, P2SH, P2WPKH, P2TR} {
+		for _, network := range []Network{MainNet, TestNet} {
+			addr, err := k.ScriptAddress(typ, network)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig, err := k.SignMessageBTC(typ, network, "proof of ownership")
+			if err != nil {
+				t.Fatalf("%s: %v", typ, err)
+			}
+			if err = VerifyMessageBTC(addr, "proof of ownership", sig); err != nil {
+				t.Errorf("%s %s: %v", typ, addr, err)
+			}
+			if err = VerifyMessageBTC(addr, "proof of something else", sig); err == nil {
+				t.Errorf("%s: verified another message", typ)
+			}
+			otherAddr, err := other.ScriptAddress(typ, network)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = VerifyMessageBTC(otherAddr, "proof of ownership", sig); err == nil {
+				t.Errorf("%s: verified another address", typ)
+			}
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package cryptopay
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/unicode/norm"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrMnemonicLength   = errors.New("Mnemonics have 12, 15, 18, 21 or 24 words")
+	ErrMnemonicChecksum = errors.New("Invalid mnemonic checksum")
+)
+
+// MnemonicWordError is a word of a mnemonic missing from its wordlist.
+type MnemonicWordError struct {
+	// Index of the word, from 0.
+	Index int
+	Word  string
+}
+
+func (e *MnemonicWordError) Error() string {
+	return fmt.Sprintf("Unknown mnemonic word %v %q", e.Index+1, e.Word)
+}
+
+var (
+	wordIndexOnce [Portuguese + 1]sync.Once
+	wordIndexes   [Portuguese + 1]map[string]int
+)
+
+// wordIndex maps the NFKD words of the language to their index, it's nil
+// for the languages without a wordlist.
+func (l Language) wordIndex() map[string]int {
+	if l < 0 || l > Portuguese {
+		return nil
+	}
+	wordIndexOnce[l].Do(func() {
+		list, err := l.Wordlist()
+		if err != nil {
+			return
+		}
+		m := make(map[string]int, len(list))
+		for i, w := range list {
+			m[norm.NFKD.String(w)] = i
+		}
+		wordIndexes[l] = m
+	})
+	return wordIndexes[l]
+}
+
+func mnemonicWords(mnemonic string) []string {
+	return strings.Fields(norm.NFKD.String(mnemonic))
+}
+
+// detectLanguage returns the language knowing most of the words.
+func detectLanguage(words []string) Language {
+	var best Language
+	bestN := -1
+	for l := English; l <= Portuguese; l++ {
+		index := l.wordIndex()
+		if index == nil {
+			continue
+		}
+		n := 0
+		for _, w := range words {
+			if _, ok := index[w]; ok {
+				n++
+			}
+		}
+		if n > bestN {
+			best, bestN = l, n
+		}
+	}
+	return best
+}
+
+func checkMnemonic(words []string, lang Language) error {
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return ErrMnemonicLength
+	}
+	index := lang.wordIndex()
+	n := new(big.Int)
+	for i, w := range words {
+		j, ok := index[w]
+		if !ok {
+			return &MnemonicWordError{Index: i, Word: w}
+		}
+		n.Lsh(n, 11).Or(n, big.NewInt(int64(j)))
+	}
+	// one bit of checksum per 32 bits of entropy, three words.
+	checksumBits := uint(len(words) / 3)
+	checksum := new(big.Int).And(n, big.NewInt(1<<checksumBits-1)).Int64()
+	b := n.Rsh(n, checksumBits).Bytes()
+	entropy := append(make([]byte, len(words)*4/3-len(b)), b...)
+	sum := sha256.Sum256(entropy)
+	if int64(sum[0]>>(8-checksumBits)) != checksum {
+		return ErrMnemonicChecksum
+	}
+	return nil
+}
+
+// ValidateMnemonic checks the length, words and checksum of the BIP 39
+// mnemonic and returns its language. Unknown words are MnemonicWordErrors.
+func ValidateMnemonic(mnemonic string) (Language, error) {
+	words := mnemonicWords(mnemonic)
+	lang := detectLanguage(words)
+	return lang, checkMnemonic(words, lang)
+}
+
+// LegacySeed makes NewFromMnemonic derive the seed of the raw bytes of the
+// mnemonic and passphrase, like cryptopay did before it normalized them as
+// BIP 39 requires. The seeds only differ for non-ASCII passphrases or
+// mnemonics and for words separated by other than single spaces, see
+// SeedChanged: set it to open the wallets created with those before.
+var LegacySeed = false
+
+// mnemonicSeed is the BIP 39 seed of the words, NFKD normalized like the
+// passphrase, or the legacy one.
+func mnemonicSeed(mnemonic, passw string) []byte {
+	if LegacySeed {
+		return legacySeed(mnemonic, passw)
+	}
+	words := strings.Join(mnemonicWords(mnemonic), " ")
+	return pbkdf2.Key([]byte(words), []byte("mnemonic"+norm.NFKD.String(passw)), 2048, 64, sha512.New)
+}
+
+func legacySeed(mnemonic, passw string) []byte {
+	return pbkdf2.Key([]byte(mnemonic), []byte("mnemonic"+passw), 2048, 64, sha512.New)
+}
+
+// SeedChanged reports whether the seed of mnemonic and passw isn't the
+// legacy one, so their wallet opened before needs LegacySeed.
+func SeedChanged(mnemonic, passw string) bool {
+	words := strings.Join(mnemonicWords(mnemonic), " ")
+	return words != mnemonic || norm.NFKD.String(passw) != passw
+}
+
+// RepairMnemonic suggests the valid mnemonics one word away from mnemonic:
+// the unknown word replaced, any word replaced if they're all known but the
+// checksum fails, or a word inserted anywhere if one is missing. The
+// replacements closest to the mistyped word come first.
+func RepairMnemonic(mnemonic string) ([]string, error) {
+	words := mnemonicWords(mnemonic)
+	lang := detectLanguage(words)
+	list, err := lang.Wordlist()
+	if err != nil {
+		return nil, err
+	}
+	type candidate struct {
+		words    []string
+		distance int
+	}
+	var found []candidate
+	try := func(ws []string, distance int) {
+		if checkMnemonic(ws, lang) == nil {
+			found = append(found, candidate{append([]string(nil), ws...), distance})
+		}
+	}
+	switch {
+	case len(words) >= 11 && len(words) <= 23 && len(words)%3 == 2:
+		ws := make([]string, len(words)+1)
+		for pos := 0; pos <= len(words); pos++ {
+			copy(ws, words[:pos])
+			copy(ws[pos+1:], words[pos:])
+			for _, w := range list {
+				ws[pos] = norm.NFKD.String(w)
+				try(ws, 0)
+			}
+		}
+	case len(words) >= 12 && len(words) <= 24 && len(words)%3 == 0:
+		err := checkMnemonic(words, lang)
+		if err == nil {
+			return []string{strings.Join(words, lang.separator())}, nil
+		}
+		var positions []int
+		index := lang.wordIndex()
+		for i, w := range words {
+			if _, ok := index[w]; !ok {
+				positions = append(positions, i)
+			}
+		}
+		if len(positions) > 1 {
+			return nil, fmt.Errorf("%v unknown words, only one can be repaired", len(positions))
+		}
+		if len(positions) == 0 {
+			for i := range words {
+				positions = append(positions, i)
+			}
+		}
+		ws := append([]string(nil), words...)
+		for _, pos := range positions {
+			for _, w := range list {
+				w = norm.NFKD.String(w)
+				if w == words[pos] {
+					continue
+				}
+				ws[pos] = w
+				try(ws, editDistance(words[pos], w))
+			}
+			ws[pos] = words[pos]
+		}
+	default:
+		return nil, ErrMnemonicLength
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].distance < found[j].distance })
+	out := make([]string, len(found))
+	for i, c := range found {
+		out[i] = strings.Join(c.words, lang.separator())
+	}
+	return out, nil
+}
+
+// editDistance is the Levenshtein distance of the runes of a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,116 @@
+package cryptopay
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/bartekn/go-bip39"
+	"strings"
+	"testing"
+)
+
+func TestValidateMnemonic(t *testing.T) {
+	for _, tt := range []struct {
+		mnemonic string
+		err      bool
+	}{
+		{testMnemonic, false},
+		{"legal winner thank year wave sausage worth useful legal winner thank yellow", false},
+		{"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon", true},
+		{"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", true},
+		{"abandon abandon abandon abandon abandon abandn abandon abandon abandon abandon abandon about", true},
+	} {
+		if _, err := ValidateMnemonic(tt.mnemonic); (err != nil) != tt.err {
+			t.Errorf("%q: %v", tt.mnemonic, err)
+		}
+	}
+	if _, _, err := NewFromMnemonic("abandon abandon abandon", ""); err != ErrMnemonicLength {
+		t.Errorf("got %v", err)
+	}
+	_, err := ValidateMnemonic("abandon abandon abandon abandon abandon abandn abandon abandon abandon abandon abandon about")
+	if e, ok := err.(*MnemonicWordError); !ok || e.Index != 5 {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestMnemonicSeed(t *testing.T) {
+	seed := mnemonicSeed("legal winner thank year wave sausage worth useful legal winner thank yellow", "TREZOR")
+	want := "2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607"
+	if got := hex.EncodeToString(seed); got != want {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestLegacySeed(t *testing.T) {
+	const mnemonic = "legal winner thank year wave sausage worth useful legal winner thank yellow"
+	for _, tc := range []struct {
+		mnemonic, passw string
+		changed         bool
+	}{
+		{mnemonic, "TREZOR", false},
+		{mnemonic, "", false},
+		{mnemonic, "p\u00e4ss", true},
+		{"legal  winner thank year wave sausage worth useful legal winner thank yellow", "", true},
+		{mnemonic + "\n", "", true},
+	} {
+		if got := SeedChanged(tc.mnemonic, tc.passw); got != tc.changed {
+			t.Errorf("%q %q: changed %v", tc.mnemonic, tc.passw, got)
+		}
+		changed := !bytes.Equal(mnemonicSeed(tc.mnemonic, tc.passw), bip39.NewSeed(tc.mnemonic, tc.passw))
+		if changed != tc.changed {
+			t.Errorf("%q %q: seed changed %v", tc.mnemonic, tc.passw, changed)
+		}
+		LegacySeed = true
+		legacy := mnemonicSeed(tc.mnemonic, tc.passw)
+		LegacySeed = false
+		if !bytes.Equal(legacy, bip39.NewSeed(tc.mnemonic, tc.passw)) {
+			t.Errorf("%q %q: not the legacy seed", tc.mnemonic, tc.passw)
+		}
+	}
+}
+
+func TestMnemonicLanguages(t *testing.T) {
+	// Portuguese waits for its vendored wordlist.
+	for lang := English; lang <= Czech; lang++ {
+		for _, words := range []int{12, 15, 18, 21, 24} {
+			_, _, mnemonic, err := NewMasterLanguage("", words, lang)
+			if err != nil {
+				t.Fatalf("%s %v: %v", lang, words, err)
+			}
+			got, err := ValidateMnemonic(mnemonic)
+			if err != nil || got != lang {
+				t.Errorf("%s %v: got %s, %v", lang, words, got, err)
+			}
+		}
+	}
+	// BIP 85 language 9.
+	if lang, err := ParseLanguage("portuguese"); err != nil || lang != 9 {
+		t.Errorf("portuguese is %v, %v", int(lang), err)
+	}
+	if _, _, _, err := NewMasterLanguage("", 12, Portuguese+1); err == nil {
+		t.Error("made a mnemonic of an unknown language")
+	}
+}
+
+func TestRepairMnemonic(t *testing.T) {
+	got, err := RepairMnemonic("abandon abandon abandon abandon abandon abandn abandon abandon abandon abandon abandon about")
+	if err != nil || len(got) == 0 || got[0] != testMnemonic {
+		t.Errorf("typo: got %v, %v", got, err)
+	}
+	got, err = RepairMnemonic("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ok bool
+	for _, m := range got {
+		if _, err := ValidateMnemonic(m); err != nil {
+			t.Errorf("%q: %v", m, err)
+		}
+		ok = ok || m == testMnemonic
+	}
+	if !ok {
+		t.Errorf("missing word: %v candidates without %q", len(got), testMnemonic)
+	}
+	if _, err = RepairMnemonic(strings.Repeat("foo ", 12)); err == nil {
+		t.Error("repaired 12 unknown words")
+	}
+}
@@ -0,0 +1,376 @@
+// Package multi combines several wallet.Requester backends into one.
+// In failover mode the first healthy backend answers and a failing backend is
+// skipped until its cooldown expires. In quorum mode every healthy backend is
+// queried and at least Quorum of them must return the same answer, so the
+// wallet never signs a transaction built from a single node's view of the chain.
+package multi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/golang/glog"
+	"github.com/winteraz/cryptopay"
+	"github.com/winteraz/cryptopay/wallet"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backend is a named remote. The name is only used in logs and errors.
+type Backend struct {
+	Name string
+	wallet.Requester
+}
+
+// How long a backend is skipped after an error. It doubles with every
+// consecutive failure up to maxCooldown.
+const (
+	cooldown    = 5 * time.Second
+	maxCooldown = 5 * time.Minute
+)
+
+type backend struct {
+	Backend
+	failures  int
+	downUntil time.Time
+}
+
+type Client struct {
+	coin cryptopay.CoinType
+	// number of backends that must agree on an answer, 0 or 1 means failover.
+	quorum   int
+	now      func() time.Time
+	mu       sync.Mutex
+	backends []*backend
+}
+
+// New returns a Requester of coin that queries the backends in the given
+// order.
+func New(coin cryptopay.CoinType, quorum int, backends ...Backend) (*Client, error) {
+	if len(backends) == 0 {
+		return nil, errors.New("Invalid backend list/empty")
+	}
+	if quorum > len(backends) {
+		return nil, fmt.Errorf("quorum %v is larger than the number of backends %v", quorum, len(backends))
+	}
+	c := &Client{coin: coin, quorum: quorum, now: time.Now}
+	for _, b := range backends {
+		if b.Requester == nil {
+			return nil, fmt.Errorf("backend %q has no requester", b.Name)
+		}
+		c.backends = append(c.backends, &backend{Backend: b})
+	}
+	return c, nil
+}
+
+// Answer is what one backend returned for a call.
+type Answer struct {
+	Backend string
+	Value   interface{}
+	Err     error
+}
+
+// QuorumError is returned when fewer than Quorum backends agree.
+type QuorumError struct {
+	Method  string
+	Quorum  int
+	Answers []Answer
+}
+
+func (e *QuorumError) Error() string {
+	var sa []string
+	for _, a := range e.Answers {
+		if a.Err != nil {
+			sa = append(sa, fmt.Sprintf("%s: err %v", a.Backend, a.Err))
+			continue
+		}
+		sa = append(sa, fmt.Sprintf("%s: %v", a.Backend, a.Value))
+	}
+	return fmt.Sprintf("%s: no quorum of %v backends, answers: %s",
+		e.Method, e.Quorum, strings.Join(sa, "; "))
+}
+
+// Check probes every backend with HasTransactions(addr) and updates its
+// health. It returns the backends that failed.
+func (c *Client) Check(cx context.Context, addr string) map[string]error {
+	m := make(map[string]error)
+	for _, b := range c.backends {
+		_, err := b.HasTransactions(cx, addr)
+		c.report(b, err)
+		if err != nil {
+			m[b.Name] = err
+		}
+	}
+	return m
+}
+
+// Healthy returns the names of the backends that are not cooling down.
+func (c *Client) Healthy() []string {
+	var sa []string
+	for _, b := range c.healthy() {
+		sa = append(sa, b.Name)
+	}
+	return sa
+}
+
+func (c *Client) healthy() []*backend {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	var ba []*backend
+	for _, b := range c.backends {
+		if now.Before(b.downUntil) {
+			continue
+		}
+		ba = append(ba, b)
+	}
+	if len(ba) == 0 {
+		// everything is down, try them all rather than failing without a call.
+		return append(ba, c.backends...)
+	}
+	return ba
+}
+
+func (c *Client) report(b *backend, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		b.downUntil = time.Time{}
+		return
+	}
+	b.failures++
+	d := cooldown << uint(b.failures-1)
+	if d > maxCooldown || d <= 0 {
+		d = maxCooldown
+	}
+	b.downUntil = c.now().Add(d)
+	log.Errorf("backend %s failed %v times, down for %s: %v", b.Name, b.failures, d, err)
+}
+
+// call runs fn against the backends according to the mode and returns the
+// selected answer. key normalizes an answer for comparison in quorum mode.
+func (c *Client) call(cx context.Context, method string, fn func(wallet.Requester) (interface{}, error), key func(interface{}) interface{}) (interface{}, error) {
+	ba := c.healthy()
+	if c.quorum < 2 {
+		var err error
+		for _, b := range ba {
+			var v interface{}
+			v, err = fn(b.Requester)
+			c.report(b, err)
+			if err == nil {
+				return v, nil
+			}
+		}
+		return nil, err
+	}
+	answers := make([]Answer, len(ba))
+	var wg sync.WaitGroup
+	for i, b := range ba {
+		wg.Add(1)
+		go func(i int, b *backend) {
+			defer wg.Done()
+			v, err := fn(b.Requester)
+			c.report(b, err)
+			answers[i] = Answer{Backend: b.Name, Value: v, Err: err}
+		}(i, b)
+	}
+	wg.Wait()
+	for i, a := range answers {
+		if a.Err != nil {
+			continue
+		}
+		agree := 0
+		for _, o := range answers[i:] {
+			if o.Err == nil && reflect.DeepEqual(key(a.Value), key(o.Value)) {
+				agree++
+			}
+		}
+		if agree >= c.quorum {
+			return a.Value, nil
+		}
+	}
+	return nil, &QuorumError{Method: method, Quorum: c.quorum, Answers: answers}
+}
+
+func (c *Client) HasTransactions(cx context.Context, addr ...string) (map[string]bool, error) {
+	v, err := c.call(cx, "HasTransactions", func(r wallet.Requester) (interface{}, error) {
+		return r.HasTransactions(cx, addr...)
+	}, func(v interface{}) interface{} {
+		// a missing address and a false one mean the same thing.
+		m := make(map[string]bool)
+		for k, ok := range v.(map[string]bool) {
+			if ok {
+				m[k] = ok
+			}
+		}
+		return m
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]bool), nil
+}
+
+func (c *Client) Unspent(cx context.Context, addr ...string) (map[string][]cryptopay.Unspent, error) {
+	v, err := c.call(cx, "Unspent", func(r wallet.Requester) (interface{}, error) {
+		return r.Unspent(cx, addr...)
+	}, func(v interface{}) interface{} {
+		if c.coin == cryptopay.ETH {
+			// the balances are split at a depth from each backend's tip,
+			// only their sum is the same.
+			m := make(map[string]uint64)
+			for k, una := range v.(map[string][]cryptopay.Unspent) {
+				for _, un := range una {
+					m[k] += un.Amount
+				}
+			}
+			return m
+		}
+		// backends see new blocks at slightly different times and some fake
+		// the confirmations so only the outputs themselves are compared.
+		m := make(map[string][]cryptopay.Unspent)
+		for k, una := range v.(map[string][]cryptopay.Unspent) {
+			if len(una) == 0 {
+				continue
+			}
+			var out []cryptopay.Unspent
+			for _, un := range una {
+				un.Confirmations = 0
+				out = append(out, un)
+			}
+			sort.Slice(out, func(i, j int) bool {
+				if out[i].Tx != out[j].Tx {
+					return out[i].Tx < out[j].Tx
+				}
+				return out[i].N < out[j].N
+			})
+			m[k] = out
+		}
+		return m
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string][]cryptopay.Unspent), nil
+}
+
+func (c *Client) CountTransactions(cx context.Context, addr ...string) (map[string]uint64, error) {
+	v, err := c.call(cx, "CountTransactions", func(r wallet.Requester) (interface{}, error) {
+		return r.CountTransactions(cx, addr...)
+	}, func(v interface{}) interface{} {
+		return v
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]uint64), nil
+}
+
+// Broadcast sends the transactions through every healthy backend. A
+// transaction is reported as successful if at least one backend accepted it.
+func (c *Client) Broadcast(cx context.Context, txa ...string) (map[string]error, error) {
+	if len(txa) == 0 {
+		return nil, errors.New("Invalid transaction list")
+	}
+	type Rsp struct {
+		name string
+		m    map[string]error
+		err  error
+	}
+	ba := c.healthy()
+	ch := make(chan Rsp, len(ba))
+	for _, b := range ba {
+		go func(b *backend) {
+			r := Rsp{name: b.Name}
+			r.m, r.err = b.Broadcast(cx, txa...)
+			c.report(b, r.err)
+			ch <- r
+		}(b)
+	}
+	m := make(map[string]error)
+	var lastErr error
+	for range ba {
+		r := <-ch
+		if r.err != nil {
+			lastErr = r.err
+			continue
+		}
+		for _, tx := range txa {
+			err, ok := r.m[tx]
+			if !ok {
+				continue
+			}
+			if err == nil {
+				m[tx] = nil
+				continue
+			}
+			if prev, seen := m[tx]; seen && prev == nil {
+				continue
+			}
+			m[tx] = fmt.Errorf("%s: %v", r.name, err)
+		}
+	}
+	if len(m) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return m, nil
+}
+
+// RawTransaction returns the transaction of the first healthy backend which
+// is a wallet.TxGetter. The transaction must hash to txid, so there's no
+// quorum.
+func (c *Client) RawTransaction(cx context.Context, txid string) (string, error) {
+	err := errors.New("no backend returns transactions")
+	for _, b := range c.healthy() {
+		g, ok := b.Requester.(wallet.TxGetter)
+		if !ok {
+			continue
+		}
+		raw, gerr := g.RawTransaction(cx, txid)
+		c.report(b, gerr)
+		if gerr != nil {
+			err = gerr
+			continue
+		}
+		if hash, herr := cryptopay.TXID(c.coin, raw); herr != nil || hash != txid {
+			err = fmt.Errorf("%s returned another transaction than %s", b.Name, txid)
+			log.Error(err)
+			continue
+		}
+		return raw, nil
+	}
+	return "", err
+}
+
+// BlockHeight returns the highest tip reported by the healthy backends which
+// are wallet.Heighter. Heights are never subject to quorum as backends see
+// blocks at different times.
+func (c *Client) BlockHeight(cx context.Context) (uint64, error) {
+	var height uint64
+	var ok bool
+	err := errors.New("no backend knows the block height")
+	for _, b := range c.healthy() {
+		h, isHeighter := b.Requester.(wallet.Heighter)
+		if !isHeighter {
+			continue
+		}
+		v, herr := h.BlockHeight(cx)
+		c.report(b, herr)
+		if herr != nil {
+			err = herr
+			continue
+		}
+		ok = true
+		if v > height {
+			height = v
+		}
+	}
+	if !ok {
+		return 0, err
+	}
+	return height, nil
+}
@@ -0,0 +1,156 @@
+package multi
+
+import (
+	"context"
+	"errors"
+	"github.com/winteraz/cryptopay"
+	"github.com/winteraz/cryptopay/chaintest"
+	"github.com/winteraz/cryptopay/wallet"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const addr = "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"
+
+// chains returns n chains where addr was paid amounts, the same funding
+// making the same transactions on every chain.
+func chains(t *testing.T, n int, amounts ...uint64) ([]*chaintest.Chain, []Backend) {
+	var ca []*chaintest.Chain
+	var ba []Backend
+	for i := 0; i < n; i++ {
+		c, err := chaintest.New(cryptopay.BTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, amount := range amounts {
+			if _, err = c.Fund(addr, amount); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ca = append(ca, c)
+		ba = append(ba, Backend{Name: string('a' + rune(i)), Requester: c})
+	}
+	return ca, ba
+}
+
+func TestFailover(t *testing.T) {
+	cx := context.Background()
+	ca, ba := chains(t, 2, 1000)
+	c, err := New(cryptopay.BTC, 1, ba...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	ca[0].Fail("HasTransactions", errors.New("down"))
+	if m, err := c.HasTransactions(cx, addr); err != nil || !m[addr] {
+		t.Fatalf("failover: %v, %v", m, err)
+	}
+	if h := c.Healthy(); !reflect.DeepEqual(h, []string{"b"}) {
+		t.Fatalf("healthy %v", h)
+	}
+	now = now.Add(cooldown)
+	if h := c.Healthy(); len(h) != 2 {
+		t.Fatalf("healthy %v after the cooldown", h)
+	}
+	// the cooldown doubles with the failures.
+	ca[0].Fail("Unspent", errors.New("down"))
+	if _, err = c.Unspent(cx, addr); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(cooldown)
+	if h := c.Healthy(); len(h) != 1 {
+		t.Fatalf("healthy %v during the second cooldown", h)
+	}
+	now = now.Add(cooldown)
+	if h := c.Healthy(); len(h) != 2 {
+		t.Fatalf("healthy %v after the second cooldown", h)
+	}
+	// everything down, every backend is tried anyway.
+	for _, chain := range ca {
+		chain.Fail("CountTransactions", errors.New("down"))
+	}
+	if _, err = c.CountTransactions(cx, addr); err == nil {
+		t.Fatal("no error with every backend down")
+	}
+	if m, err := c.CountTransactions(cx, addr); err != nil || m[addr] != 1 {
+		t.Fatalf("count %v, %v with every backend cooling down", m, err)
+	}
+}
+
+func TestQuorum(t *testing.T) {
+	cx := context.Background()
+	ca, ba := chains(t, 2, 1000)
+	// a third backend which missed the payment.
+	_, odd := chains(t, 1)
+	odd[0].Name = "c"
+	ba = append(ba, odd...)
+	if _, err := New(cryptopay.BTC, 4, ba...); err == nil {
+		t.Fatal("quorum larger than the backends")
+	}
+	c, err := New(cryptopay.BTC, 2, ba...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the confirmations don't matter.
+	ca[1].Mine(1)
+	m, err := c.Unspent(cx, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m[addr]) != 1 || m[addr][0].Amount != 1000 {
+		t.Fatalf("unspent %+v", m)
+	}
+	ca[0].Fail("Unspent", errors.New("down"))
+	_, err = c.Unspent(cx, addr)
+	qe, ok := err.(*QuorumError)
+	if !ok {
+		t.Fatalf("got %v, want a quorum error", err)
+	}
+	if qe.Method != "Unspent" || qe.Quorum != 2 || len(qe.Answers) != 3 || qe.Answers[0].Err == nil {
+		t.Fatalf("quorum error %+v", qe)
+	}
+}
+
+// account answers like ethrpc, una for every address, and returns raw.
+type account struct {
+	wallet.Requester
+	una []cryptopay.Unspent
+	raw string
+}
+
+func (a account) Unspent(cx context.Context, addr ...string) (map[string][]cryptopay.Unspent, error) {
+	m := make(map[string][]cryptopay.Unspent)
+	for _, k := range addr {
+		m[k] = a.una
+	}
+	return m, nil
+}
+
+func (a account) RawTransaction(cx context.Context, txid string) (string, error) {
+	return a.raw, nil
+}
+
+func TestETH(t *testing.T) {
+	cx := context.Background()
+	const ethAddr = "0x9858EfFD232B4033E47d90003D41EC34EcaEda94"
+	const raw = "0xf86b01850bdfd63e00825208946fac4d18c912343bf86fa7049364dd4e424ab9c087038d7ea4c680008026a04b7f122dd810f9bd67c7468effed9fcb3249d3791d7e6745ef583bc80880ca3da0565eaecc2bfb1af00dd7e595c79b9238347dbff1e36ec5db29a52734352ae573"
+	// one block apart, 300 reached the depth on b only.
+	c, err := New(cryptopay.ETH, 2,
+		Backend{Name: "a", Requester: account{una: []cryptopay.Unspent{{Amount: 700, Confirmations: 12}, {Amount: 300}}, raw: raw}},
+		Backend{Name: "b", Requester: account{una: []cryptopay.Unspent{{Amount: 1000, Confirmations: 12}}, raw: raw}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Unspent(cx, ethAddr); err != nil {
+		t.Fatal(err)
+	}
+	txid, err := cryptopay.TXID(cryptopay.ETH, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.RawTransaction(cx, txid); err != nil || got != raw {
+		t.Fatalf("got %s, %v", got, err)
+	}
+}
@@ -0,0 +1,380 @@
+package cryptopay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MultisigType is the script the addresses of a multisig wallet pay to.
+type MultisigType int
+
+const (
+	// MultisigP2SH is bare multisig in P2SH, the BIP 45 wallets.
+	MultisigP2SH MultisigType = iota + 1
+	// MultisigP2SHP2WSH is P2WSH in P2SH, BIP 48 script type 1'.
+	MultisigP2SHP2WSH
+	// MultisigP2WSH is BIP 48 script type 2'.
+	MultisigP2WSH
+)
+
+func (t MultisigType) String() string {
+	switch t {
+	case MultisigP2SH:
+		return "p2sh"
+	case MultisigP2SHP2WSH:
+		return "p2sh-p2wsh"
+	case MultisigP2WSH:
+		return "p2wsh"
+	}
+	return fmt.Sprintf("MultisigType(%d)", int(t))
+}
+
+// ParseMultisigType parses the names of String.
+func ParseMultisigType(s string) (MultisigType, error) {
+	for _, t := range []MultisigType{MultisigP2SH, MultisigP2SHP2WSH, MultisigP2WSH} {
+		if t.String() == s {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown multisig type %q", s)
+}
+
+// bip45Cosigner is the cosigner index every cosigner derives the shared
+// addresses of BIP 45 wallets with.
+const bip45Cosigner = 1<<31 - 1
+
+// MultisigAccountPath returns the path of the account key of a cosigner,
+// m/45' for P2SH and m/48'/coin'/account'/script' for the segwit types.
+func MultisigAccountPath(typ MultisigType, coinTyp CoinType, account uint32) Path {
+	if typ == MultisigP2SH {
+		return Path{Hardened(45)}
+	}
+	script := uint32(1)
+	if typ == MultisigP2WSH {
+		script = 2
+	}
+	return Path{Hardened(48), Hardened(uint32(coinTyp)), Hardened(account), Hardened(script)}
+}
+
+// MultisigAccountKey derives the public account key of the cosigner of the
+// master key k, a Ypub or Zpub for the segwit types, with its origin.
+func (k *Key) MultisigAccountKey(typ MultisigType, coinTyp CoinType, account uint32) (string, error) {
+	p := MultisigAccountPath(typ, coinTyp, account)
+	acct, err := k.Derive(p)
+	if err != nil {
+		return "", err
+	}
+	pub, err := acct.Public()
+	if err != nil {
+		return "", err
+	}
+	fp, err := k.Fingerprint()
+	if err != nil {
+		return "", err
+	}
+	var s string
+	switch typ {
+	case MultisigP2SH:
+		s = pub.Base58()
+	case MultisigP2SHP2WSH:
+		s, err = pub.SLIP132(P2SH, true, MainNet)
+	case MultisigP2WSH:
+		s, err = pub.SLIP132(P2WSH, true, MainNet)
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("[%08x%s]%s", fp, strings.TrimPrefix(p.String(), "m"), s), nil
+}
+
+// Multisig is an M of N wallet of the account keys of the cosigners. The
+// keys of every address are sorted (BIP 67).
+type Multisig struct {
+	M         int
+	Type      MultisigType
+	Network   Network
+	Cosigners []*AccountKey
+}
+
+// NewMultisig makes the m of len(cosigners) wallet of typ. The cosigners are
+// xpubs, Ypubs or Zpubs (which must match typ), with an optional key origin
+// like [d34db33f/48'/0'/0'/2']Zpub... so master keys can sign the PSBTs.
+func NewMultisig(m int, typ MultisigType, cosigners ...string) (*Multisig, error) {
+	if typ < MultisigP2SH || typ > MultisigP2WSH {
+		return nil, fmt.Errorf("Invalid multisig type %v", typ)
+	}
+	// P2SH redeem scripts are at most 520 bytes, 15 keys.
+	if m < 1 || m > len(cosigners) || len(cosigners) > 15 {
+		return nil, fmt.Errorf("Invalid %v of %v multisig", m, len(cosigners))
+	}
+	ms := &Multisig{M: m, Type: typ}
+	seen := make(map[string]bool)
+	for i, s := range cosigners {
+		var origin string
+		s = strings.TrimSpace(s)
+		if strings.HasPrefix(s, "[") {
+			j := strings.Index(s, "]")
+			if j < 0 {
+				return nil, errors.New("Invalid key origin")
+			}
+			origin, s = s[1:j], s[j+1:]
+			if _, _, err := parseOrigin(origin); err != nil {
+				return nil, err
+			}
+		}
+		a, err := ParseAccountKey(s)
+		if err != nil {
+			return nil, fmt.Errorf("Cosigner %v: %v", i+1, err)
+		}
+		switch {
+		case a.Multisig && a.Type == P2SH && typ != MultisigP2SHP2WSH,
+			a.Multisig && a.Type == P2WSH && typ != MultisigP2WSH,
+			!a.Multisig && a.Type != P2PKH:
+			return nil, fmt.Errorf("Cosigner %v isn't a %s key", i+1, typ)
+		}
+		if i == 0 {
+			ms.Network = a.Network
+		} else if a.Network != ms.Network {
+			return nil, errors.New("Cosigners of different networks")
+		}
+		if seen[a.Key.Base58()] {
+			return nil, fmt.Errorf("Cosigner %v is there twice", i+1)
+		}
+		seen[a.Key.Base58()] = true
+		a.Origin = origin
+		ms.Cosigners = append(ms.Cosigners, a)
+	}
+	return ms, nil
+}
+
+// parseOrigin parses a key origin, d34db33f/48'/0'/0'/2'.
+func parseOrigin(origin string) (uint32, Path, error) {
+	if len(origin) < 8 {
+		return 0, nil, fmt.Errorf("Invalid key origin %q", origin)
+	}
+	fp, err := strconv.ParseUint(origin[:8], 16, 32)
+	if err != nil {
+		return 0, nil, fmt.Errorf("Invalid key origin %q", origin)
+	}
+	p, err := ParsePath("m" + origin[8:])
+	if err != nil {
+		return 0, nil, err
+	}
+	return uint32(fp), p, nil
+}
+
+// chainPath is the path of an address below the account keys.
+func (ms *Multisig) chainPath(kind bool, index uint32) Path {
+	chain := uint32(0)
+	if kind {
+		chain = 1
+	}
+	if ms.Type == MultisigP2SH {
+		return Path{bip45Cosigner, chain, index}
+	}
+	return Path{chain, index}
+}
+
+// multisigKey is the key of a cosigner in a script and its derivation.
+type multisigKey struct {
+	pub         []byte
+	fingerprint uint32
+	path        Path
+}
+
+// keys returns the sorted keys of an address.
+func (ms *Multisig) keys(kind bool, index uint32) ([]multisigKey, error) {
+	p := ms.chainPath(kind, index)
+	var keys []multisigKey
+	for _, a := range ms.Cosigners {
+		k, err := a.Key.Derive(p)
+		if err != nil {
+			return nil, err
+		}
+		pub, err := (*hdkeychain.ExtendedKey)(k).ECPubKey()
+		if err != nil {
+			return nil, err
+		}
+		mk := multisigKey{pub: pub.SerializeCompressed(), path: p}
+		if a.Origin != "" {
+			fp, origin, err := parseOrigin(a.Origin)
+			if err != nil {
+				return nil, err
+			}
+			mk.fingerprint, mk.path = fp, origin.Child(p...)
+		} else if mk.fingerprint, err = a.Key.Fingerprint(); err != nil {
+			return nil, err
+		}
+		keys = append(keys, mk)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i].pub, keys[j].pub) < 0 })
+	return keys, nil
+}
+
+// Script returns the multisig script of the address index of the external
+// or internal (kind) chain, the redeem script of P2SH or the witness script.
+func (ms *Multisig) Script(kind bool, index uint32) ([]byte, error) {
+	keys, err := ms.keys(kind, index)
+	if err != nil {
+		return nil, err
+	}
+	return multisigScript(ms.M, keys)
+}
+
+func multisigScript(m int, keys []multisigKey) ([]byte, error) {
+	b := txscript.NewScriptBuilder().AddInt64(int64(m))
+	for _, k := range keys {
+		b.AddData(k.pub)
+	}
+	return b.AddInt64(int64(len(keys))).AddOp(txscript.OP_CHECKMULTISIG).Script()
+}
+
+// Address returns the address index of the external or internal (kind)
+// chain.
+func (ms *Multisig) Address(kind bool, index uint32) (string, error) {
+	script, err := ms.Script(kind, index)
+	if err != nil {
+		return "", err
+	}
+	p := ms.Network.Params()
+	switch ms.Type {
+	case MultisigP2SH:
+		return base58.CheckEncode(btcutil.Hash160(script), p.ScriptHashAddrID), nil
+	case MultisigP2SHP2WSH:
+		return base58.CheckEncode(btcutil.Hash160(p2wshProgram(script)), p.ScriptHashAddrID), nil
+	}
+	h := sha256.Sum256(script)
+	return segwitEncode(ms.Network, 0, h[:]), nil
+}
+
+func p2wshProgram(script []byte) []byte {
+	h := sha256.Sum256(script)
+	return append([]byte{txscript.OP_0, txscript.OP_DATA_32}, h[:]...)
+}
+
+// dustLimit is the smallest change worth an output.
+const dustLimit = 546
+
+// NewPSBT spends the outputs of the address index of the external or
+// internal (kind) chain, paying amount to the address to and fee to the
+// miners. The rest goes back to the address, with its scripts and
+// derivations for the cosigners to check it. The PSBT has what cryptopay
+// needs to sign it, see Key.SignPSBT, other signers need the previous
+// transactions too, see PSBT.AddPrevTx.
+func (ms *Multisig) NewPSBT(kind bool, index uint32, to string, amount, fee uint64, unspent []Unspent) (*PSBT, error) {
+	keys, err := ms.keys(kind, index)
+	if err != nil {
+		return nil, err
+	}
+	script, err := multisigScript(ms.M, keys)
+	if err != nil {
+		return nil, err
+	}
+	from, err := ms.Address(kind, index)
+	if err != nil {
+		return nil, err
+	}
+	fromScript, _, err := addressScript(ms.Network, from)
+	if err != nil {
+		return nil, err
+	}
+	toScript, _, err := addressScript(ms.Network, to)
+	if err != nil {
+		return nil, err
+	}
+	var redeem, witness []byte
+	switch ms.Type {
+	case MultisigP2SH:
+		redeem = script
+	case MultisigP2SHP2WSH:
+		redeem, witness = p2wshProgram(script), script
+	case MultisigP2WSH:
+		witness = script
+	}
+	var derivations []Derivation
+	for _, k := range keys {
+		derivations = append(derivations, Derivation{Pub: k.pub, Fingerprint: k.fingerprint, Path: k.path})
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	p := &PSBT{Tx: tx}
+	var total uint64
+	for _, un := range unspent {
+		hash, err := chainhash.NewHashFromStr(un.Tx)
+		if err != nil {
+			return nil, err
+		}
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(hash, un.N), nil, nil))
+		in := PSBTInput{RedeemScript: redeem, WitnessScript: witness, Derivations: derivations}
+		if ms.Type != MultisigP2SH {
+			in.WitnessUTXO = wire.NewTxOut(int64(un.Amount), fromScript)
+		}
+		p.Inputs = append(p.Inputs, in)
+		total += un.Amount
+	}
+	if len(unspent) == 0 || total < amount+fee {
+		return nil, fmt.Errorf("The outputs pay %v, not %v and the fee %v", total, amount, fee)
+	}
+	tx.AddTxOut(wire.NewTxOut(int64(amount), toScript))
+	p.Outputs = []PSBTOutput{{}}
+	if change := total - amount - fee; change >= dustLimit {
+		tx.AddTxOut(wire.NewTxOut(int64(change), fromScript))
+		p.Outputs = append(p.Outputs, PSBTOutput{RedeemScript: redeem, WitnessScript: witness, Derivations: derivations})
+	}
+	return p, nil
+}
+
+// SignedSize estimates the virtual size of the transaction once M
+// cosigners signed every input.
+func (ms *Multisig) SignedSize(p *PSBT) int {
+	base := p.Tx.SerializeSizeStripped()
+	var witness int
+	for _, in := range p.Inputs {
+		script := in.WitnessScript
+		if ms.Type == MultisigP2SH {
+			script = in.RedeemScript
+		}
+		// OP_0, the signatures and the script.
+		stack := 1 + ms.M*(1+72) + wire.VarIntSerializeSize(uint64(len(script))) + len(script)
+		switch ms.Type {
+		case MultisigP2SH:
+			if len(script) > 75 {
+				stack++
+			}
+			base += wire.VarIntSerializeSize(uint64(stack)) + stack
+		case MultisigP2SHP2WSH:
+			base += 1 + 35
+			witness += 1 + stack
+		case MultisigP2WSH:
+			witness += 1 + stack
+		}
+	}
+	if witness > 0 {
+		// the segwit marker and flag.
+		witness += 2
+	}
+	return base + (witness+3)/4
+}
+
+// hexPub is the map key of a public key.
+func hexPub(pub []byte) string {
+	return hex.EncodeToString(pub)
+}
+
+func uint32LE(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
@@ -0,0 +1,192 @@
+package cryptopay
+
+import (
+	"bytes"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"strings"
+	"testing"
+)
+
+func cosigners(t *testing.T, typ MultisigType) ([]*Key, []string) {
+	var keys []*Key
+	var pubs []string
+	for _, pass := range []string{"alice", "bob", "carol"} {
+		master, _, err := NewFromMnemonic(testMnemonic, pass)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err := master.MultisigAccountKey(typ, BTC, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, master)
+		pubs = append(pubs, pub)
+	}
+	return keys, pubs
+}
+
+func TestMultisig(t *testing.T) {
+	for typ, want := range map[MultisigType]AddressType{
+		MultisigP2SH:      P2SH,
+		MultisigP2SHP2WSH: P2SH,
+		MultisigP2WSH:     P2WSH,
+	} {
+		keys, pubs := cosigners(t, typ)
+		ms, err := NewMultisig(2, typ, pubs...)
+		if err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+		// BIP 67 sorts the keys, the order of the cosigners doesn't matter.
+		reversed, err := NewMultisig(2, typ, pubs[2], pubs[1], pubs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr, err := ms.Address(false, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := reversed.Address(false, 3); got != addr {
+			t.Errorf("%s: %s, reversed %s", typ, addr, got)
+		}
+		if got, err := ValidateAddress(BTC, MainNet, addr); err != nil || got != want {
+			t.Errorf("%s: %s is %s, %v", typ, addr, got, err)
+		}
+		if change, _ := ms.Address(true, 3); change == addr {
+			t.Errorf("%s: the change address is the receive one", typ)
+		}
+		script, _, err := addressScript(MainNet, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the transactions paying the address, in the second output.
+		var prevTxs [][]byte
+		var unspent []Unspent
+		for i, amount := range []uint64{50000, 70000} {
+			prev := wire.NewMsgTx(wire.TxVersion)
+			prev.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{byte(i)}, 0), nil, nil))
+			prev.AddTxOut(wire.NewTxOut(1000, script))
+			prev.AddTxOut(wire.NewTxOut(int64(amount), script))
+			var buf bytes.Buffer
+			if err = prev.Serialize(&buf); err != nil {
+				t.Fatal(err)
+			}
+			prevTxs = append(prevTxs, buf.Bytes())
+			unspent = append(unspent, Unspent{Tx: prev.TxHash().String(), N: 1, Amount: amount})
+		}
+		p, err := ms.NewPSBT(false, 3, "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", 100000, 5000, unspent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Tx.TxOut) != 2 || p.Tx.TxOut[1].Value != 15000 {
+			t.Errorf("%s: outputs %v", typ, p.Tx.TxOut)
+		}
+		for _, prev := range prevTxs {
+			if err = p.AddPrevTx(prev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = p.AddPrevTx(prevTxs[0][:len(prevTxs[0])-1]); err == nil {
+			t.Error("added a truncated transaction")
+		}
+		if p, err = ParsePSBT([]byte(p.String())); err != nil {
+			t.Fatal(err)
+		}
+		// the cosigners can tell the change is theirs.
+		if change := p.Outputs[1]; len(change.Derivations) != 3 || change.RedeemScript == nil && change.WitnessScript == nil {
+			t.Errorf("%s: change output %+v", typ, change)
+		}
+		if p.Inputs[0].NonWitnessUTXO == nil || p.Inputs[0].NonWitnessUTXO.TxHash().String() != unspent[0].Tx {
+			t.Errorf("%s: no previous transaction", typ)
+		}
+		// the cosigners sign in turn, the PSBT going around serialized.
+		for _, k := range []*Key{keys[0], keys[2]} {
+			if p, err = ParsePSBT([]byte(p.String())); err != nil {
+				t.Fatal(err)
+			}
+			if n, err := k.SignPSBT(p); err != nil || n != 2 {
+				t.Fatalf("%s: signed %v, %v", typ, n, err)
+			}
+		}
+		if err = p.Finalize(); err != nil {
+			t.Fatal(err)
+		}
+		raw, err := p.Extract()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tx wire.MsgTx
+		if err = tx.Deserialize(bytes.NewReader(raw)); err != nil {
+			t.Fatal(err)
+		}
+		hashes := txscript.NewTxSigHashes(&tx)
+		for i, un := range unspent {
+			vm, err := txscript.NewEngine(script, &tx, i, txscript.StandardVerifyFlags, nil, hashes, int64(un.Amount))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = vm.Execute(); err != nil {
+				t.Errorf("%s: input %v: %v", typ, i, err)
+			}
+		}
+		// the signatures are 71 or 72 bytes.
+		vsize := (tx.SerializeSizeStripped()*3 + tx.SerializeSize() + 3) / 4
+		if size := ms.SignedSize(p); size < vsize || size > vsize+4 {
+			t.Errorf("%s: estimated %v bytes, not %v", typ, size, vsize)
+		}
+	}
+}
+
+// Without key origins the account keys sign.
+func TestMultisigAccountKeys(t *testing.T) {
+	keys, _ := cosigners(t, MultisigP2WSH)
+	var accounts []*Key
+	var pubs []string
+	for _, k := range keys {
+		acct, err := k.Derive(MultisigAccountPath(MultisigP2WSH, BTC, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err := acct.Public()
+		if err != nil {
+			t.Fatal(err)
+		}
+		accounts = append(accounts, acct)
+		pubs = append(pubs, pub.Base58())
+	}
+	ms, err := NewMultisig(2, MultisigP2WSH, pubs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ms.NewPSBT(true, 0, "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", 40000, 1000, []Unspent{{Tx: strings.Repeat("33", 32), Amount: 41000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := keys[0].SignPSBT(p); n != 0 {
+		t.Errorf("the master key signed %v inputs", n)
+	}
+	if n, err := accounts[1].SignPSBT(p); err != nil || n != 1 {
+		t.Errorf("signed %v, %v", n, err)
+	}
+	if err = p.Finalize(); err == nil {
+		t.Error("finalized with one signature")
+	}
+	other := &PSBT{Tx: p.Tx.Copy(), Inputs: []PSBTInput{{Derivations: p.Inputs[0].Derivations, WitnessScript: p.Inputs[0].WitnessScript, WitnessUTXO: p.Inputs[0].WitnessUTXO}}}
+	if n, err := accounts[0].SignPSBT(other); err != nil || n != 1 {
+		t.Errorf("signed %v, %v", n, err)
+	}
+	if err = p.Combine(other); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Finalize(); err != nil {
+		t.Error(err)
+	}
+	if _, err = NewMultisig(2, MultisigP2SHP2WSH, pubs...); err != nil {
+		t.Errorf("xpubs are any type: %v", err)
+	}
+	_, zpubs := cosigners(t, MultisigP2WSH)
+	if _, err = NewMultisig(2, MultisigP2SHP2WSH, zpubs...); err == nil {
+		t.Error("Zpubs made a P2SH-P2WSH wallet")
+	}
+}
@@ -0,0 +1,41 @@
+package cryptopay
+
+import (
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// Network of a coin, the keys are the same but the addresses and the
+// transactions differ.
+type Network int
+
+const (
+	MainNet Network = iota
+	TestNet
+)
+
+func (n Network) String() string {
+	switch n {
+	case MainNet:
+		return "mainnet"
+	case TestNet:
+		return "testnet"
+	}
+	return fmt.Sprintf("Network(%d)", int(n))
+}
+
+// Params returns the bitcoin chain parameters of n.
+func (n Network) Params() *chaincfg.Params {
+	if n == TestNet {
+		return &chaincfg.TestNet3Params
+	}
+	return &chaincfg.MainNetParams
+}
+
+// ChainID returns the EIP-155 chain id of ethereum on n, TestNet is Ropsten.
+func (n Network) ChainID() uint64 {
+	if n == TestNet {
+		return 3
+	}
+	return 1
+}
@@ -0,0 +1,104 @@
+package cryptopay
+
+import (
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"strconv"
+	"strings"
+)
+
+// Path is a BIP 32 derivation path. The hardened indexes have
+// hdkeychain.HardenedKeyStart added, see Hardened.
+type Path []uint32
+
+// Hardened returns the hardened index i.
+func Hardened(i uint32) uint32 {
+	return i + hdkeychain.HardenedKeyStart
+}
+
+// ParsePath parses paths like m/84'/0'/3'/1/17, where h or H mark the
+// hardened indexes too. The m/ is optional, "m" alone is the empty path.
+func ParsePath(s string) (Path, error) {
+	s = strings.TrimSpace(s)
+	if s == "m" || s == "" {
+		return Path{}, nil
+	}
+	s = strings.TrimPrefix(s, "m/")
+	var p Path
+	for _, e := range strings.Split(s, "/") {
+		hardened := strings.HasSuffix(e, "'") || strings.HasSuffix(e, "h") || strings.HasSuffix(e, "H")
+		if hardened {
+			e = e[:len(e)-1]
+		}
+		i, err := strconv.ParseUint(e, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid path element %q", e)
+		}
+		if i >= hdkeychain.HardenedKeyStart {
+			return nil, fmt.Errorf("Path index %v out of range", i)
+		}
+		if hardened {
+			i += hdkeychain.HardenedKeyStart
+		}
+		p = append(p, uint32(i))
+	}
+	return p, nil
+}
+
+// String formats the path with ' for the hardened indexes.
+func (p Path) String() string {
+	b := []byte("m")
+	for _, i := range p {
+		b = append(b, '/')
+		if i >= hdkeychain.HardenedKeyStart {
+			b = strconv.AppendUint(b, uint64(i-hdkeychain.HardenedKeyStart), 10)
+			b = append(b, '\'')
+			continue
+		}
+		b = strconv.AppendUint(b, uint64(i), 10)
+	}
+	return string(b)
+}
+
+// Child returns the path extended with i.
+func (p Path) Child(i ...uint32) Path {
+	return append(append(Path{}, p...), i...)
+}
+
+// Derive derives the path from k. Public keys can't derive hardened
+// indexes.
+func (k *Key) Derive(p Path) (*Key, error) {
+	if k == nil {
+		return nil, errors.New("Invalid key/nil")
+	}
+	cur := (*hdkeychain.ExtendedKey)(k)
+	for _, i := range p {
+		child, err := cur.Child(i)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", p, err)
+		}
+		cur = child
+	}
+	return (*Key)(cur), nil
+}
+
+// ParentFingerprint is the fingerprint of the key k was derived from, 0 for
+// a master key.
+func (k *Key) ParentFingerprint() uint32 {
+	return (*hdkeychain.ExtendedKey)(k).ParentFingerprint()
+}
+
+// Depth is the number of derivations from the master key.
+func (k *Key) Depth() uint8 {
+	return (*hdkeychain.ExtendedKey)(k).Depth()
+}
+
+// Public returns the public key of k.
+func (k *Key) Public() (*Key, error) {
+	pub, err := (*hdkeychain.ExtendedKey)(k).Neuter()
+	if err != nil {
+		return nil, err
+	}
+	return (*Key)(pub), nil
+}
@@ -0,0 +1,70 @@
+package cryptopay
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Path
+		out  string
+	}{
+		{"m", Path{}, "m"},
+		{"m/84'/0'/3'/1/17", Path{Hardened(84), Hardened(0), Hardened(3), 1, 17}, "m/84'/0'/3'/1/17"},
+		{"m/44h/60H/0h/0", Path{Hardened(44), Hardened(60), Hardened(0), 0}, "m/44'/60'/0'/0"},
+		{"0/2147483647", Path{0, 2147483647}, "m/0/2147483647"},
+	}
+	for _, tt := range tests {
+		p, err := ParsePath(tt.in)
+		if err != nil {
+			t.Errorf("%s: %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(p, tt.want) || p.String() != tt.out {
+			t.Errorf("%s: got %v (%s), want %v", tt.in, p, p, tt.want)
+		}
+	}
+	for _, s := range []string{"m/", "m/x", "m/1''", "m/2147483648", "m/-1", "m//1"} {
+		if p, err := ParsePath(s); err == nil {
+			t.Errorf("%s: got %v", s, p)
+		}
+	}
+}
+
+func TestDerive(t *testing.T) {
+	master, pub, err := NewFromMnemonic(testMnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ParsePath("m/84'/0'/0'/0/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := master.Derive(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := k.ScriptAddress(P2WPKH, MainNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu" {
+		t.Fatalf("got %s", addr)
+	}
+	parent, err := master.Derive(p[:4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp, err := parent.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.ParentFingerprint() != fp || k.Depth() != 5 {
+		t.Fatalf("parent fingerprint %08x depth %v, want %08x", k.ParentFingerprint(), k.Depth(), fp)
+	}
+	if _, err = pub.Derive(p); err == nil {
+		t.Fatal("derived a hardened path from a public key")
+	}
+}
@@ -0,0 +1,563 @@
+package cryptopay
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"io"
+	"sort"
+)
+
+// https://github.com/bitcoin/bips/blob/master/bip-0174.mediawiki
+
+// PSBT is a partially signed bitcoin transaction. It keeps the fields the
+// multisig wallets use and the unknown ones as they are.
+type PSBT struct {
+	// Tx is the unsigned transaction.
+	Tx      *wire.MsgTx
+	Inputs  []PSBTInput
+	Outputs []PSBTOutput
+	Unknown []PSBTField
+}
+
+// PSBTInput is what the signers of an input need and what they signed.
+// NonWitnessUTXO is the previous transaction, see PSBT.AddPrevTx.
+type PSBTInput struct {
+	NonWitnessUTXO *wire.MsgTx
+	WitnessUTXO    *wire.TxOut
+	// PartialSigs are the signatures by hex public key, with the hash type.
+	PartialSigs    map[string][]byte
+	RedeemScript   []byte
+	WitnessScript  []byte
+	Derivations    []Derivation
+	FinalScriptSig []byte
+	FinalWitness   wire.TxWitness
+	Unknown        []PSBTField
+}
+
+// PSBTOutput tells the signers the change outputs are theirs.
+type PSBTOutput struct {
+	RedeemScript  []byte
+	WitnessScript []byte
+	Derivations   []Derivation
+	Unknown       []PSBTField
+}
+
+// PSBTField is a key and value of a map of the PSBT.
+type PSBTField struct {
+	Key, Value []byte
+}
+
+// Derivation tells which key derives a public key: the fingerprint of the
+// master (or account) key and the path.
+type Derivation struct {
+	Pub         []byte
+	Fingerprint uint32
+	Path        Path
+}
+
+const (
+	psbtGlobalUnsignedTx     = 0x00
+	psbtInNonWitnessUTXO     = 0x00
+	psbtInWitnessUTXO        = 0x01
+	psbtInPartialSig         = 0x02
+	psbtInRedeemScript       = 0x04
+	psbtInWitnessScript      = 0x05
+	psbtInBIP32Derivation    = 0x06
+	psbtInFinalScriptSig     = 0x07
+	psbtInFinalScriptWitness = 0x08
+	psbtOutRedeemScript      = 0x00
+	psbtOutWitnessScript     = 0x01
+	psbtOutBIP32Derivation   = 0x02
+)
+
+var psbtMagic = []byte("psbt\xff")
+
+// ParsePSBT parses the binary or base64 PSBT.
+func ParsePSBT(b []byte) (*PSBT, error) {
+	if !bytes.HasPrefix(b, psbtMagic) {
+		d, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(b)))
+		if err != nil || !bytes.HasPrefix(d, psbtMagic) {
+			return nil, errors.New("Invalid PSBT")
+		}
+		b = d
+	}
+	r := bytes.NewReader(b[len(psbtMagic):])
+	global, err := readPSBTMap(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &PSBT{}
+	for _, f := range global {
+		if len(f.Key) == 1 && f.Key[0] == psbtGlobalUnsignedTx {
+			p.Tx = wire.NewMsgTx(wire.TxVersion)
+			if err = p.Tx.DeserializeNoWitness(bytes.NewReader(f.Value)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		p.Unknown = append(p.Unknown, f)
+	}
+	if p.Tx == nil {
+		return nil, errors.New("PSBT without the unsigned transaction")
+	}
+	for range p.Tx.TxIn {
+		fields, err := readPSBTMap(r)
+		if err != nil {
+			return nil, err
+		}
+		in, err := parsePSBTInput(fields)
+		if err != nil {
+			return nil, err
+		}
+		p.Inputs = append(p.Inputs, in)
+	}
+	for range p.Tx.TxOut {
+		fields, err := readPSBTMap(r)
+		if err != nil {
+			return nil, err
+		}
+		out, err := parsePSBTOutput(fields)
+		if err != nil {
+			return nil, err
+		}
+		p.Outputs = append(p.Outputs, out)
+	}
+	return p, nil
+}
+
+func parsePSBTInput(fields []PSBTField) (PSBTInput, error) {
+	in := PSBTInput{PartialSigs: make(map[string][]byte)}
+	for _, f := range fields {
+		v := f.Value
+		var err error
+		switch f.Key[0] {
+		case psbtInNonWitnessUTXO:
+			in.NonWitnessUTXO = wire.NewMsgTx(wire.TxVersion)
+			err = in.NonWitnessUTXO.Deserialize(bytes.NewReader(v))
+		case psbtInWitnessUTXO:
+			in.WitnessUTXO, err = parseTxOut(v)
+		case psbtInPartialSig:
+			in.PartialSigs[hexPub(f.Key[1:])] = v
+		case psbtInRedeemScript:
+			in.RedeemScript = v
+		case psbtInWitnessScript:
+			in.WitnessScript = v
+		case psbtInBIP32Derivation:
+			var d Derivation
+			d, err = parseDerivation(f)
+			in.Derivations = append(in.Derivations, d)
+		case psbtInFinalScriptSig:
+			in.FinalScriptSig = v
+		case psbtInFinalScriptWitness:
+			in.FinalWitness, err = readWitness(bytes.NewReader(v))
+		default:
+			in.Unknown = append(in.Unknown, f)
+		}
+		if err != nil {
+			return in, err
+		}
+	}
+	return in, nil
+}
+
+func parsePSBTOutput(fields []PSBTField) (PSBTOutput, error) {
+	var out PSBTOutput
+	for _, f := range fields {
+		switch f.Key[0] {
+		case psbtOutRedeemScript:
+			out.RedeemScript = f.Value
+		case psbtOutWitnessScript:
+			out.WitnessScript = f.Value
+		case psbtOutBIP32Derivation:
+			d, err := parseDerivation(f)
+			if err != nil {
+				return out, err
+			}
+			out.Derivations = append(out.Derivations, d)
+		default:
+			out.Unknown = append(out.Unknown, f)
+		}
+	}
+	return out, nil
+}
+
+func parseDerivation(f PSBTField) (Derivation, error) {
+	v := f.Value
+	if len(v) < 4 || len(v)%4 != 0 {
+		return Derivation{}, errors.New("Invalid PSBT derivation")
+	}
+	d := Derivation{Pub: f.Key[1:], Fingerprint: binary.BigEndian.Uint32(v)}
+	for i := 4; i < len(v); i += 4 {
+		d.Path = append(d.Path, binary.LittleEndian.Uint32(v[i:]))
+	}
+	return d, nil
+}
+
+func (d *Derivation) value() []byte {
+	v := make([]byte, 4, 4+4*len(d.Path))
+	binary.BigEndian.PutUint32(v, d.Fingerprint)
+	for _, i := range d.Path {
+		v = append(v, uint32LE(i)...)
+	}
+	return v
+}
+
+// parseTxOut parses the amount and script of an output.
+func parseTxOut(b []byte) (*wire.TxOut, error) {
+	if len(b) < 9 {
+		return nil, errors.New("Invalid PSBT output")
+	}
+	script, err := wire.ReadVarBytes(bytes.NewReader(b[8:]), 0, 10000, "script")
+	if err != nil {
+		return nil, err
+	}
+	return wire.NewTxOut(int64(binary.LittleEndian.Uint64(b)), script), nil
+}
+
+func readPSBTMap(r io.Reader) ([]PSBTField, error) {
+	var fields []PSBTField
+	for {
+		key, err := wire.ReadVarBytes(r, 0, 1<<16, "psbt key")
+		if err != nil {
+			return nil, err
+		}
+		if len(key) == 0 {
+			return fields, nil
+		}
+		value, err := wire.ReadVarBytes(r, 0, 1<<24, "psbt value")
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, PSBTField{key, value})
+	}
+}
+
+// Bytes serializes the PSBT.
+func (p *PSBT) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(psbtMagic)
+	var tx bytes.Buffer
+	if err := p.Tx.SerializeNoWitness(&tx); err != nil {
+		return nil, err
+	}
+	global := append([]PSBTField{{[]byte{psbtGlobalUnsignedTx}, tx.Bytes()}}, p.Unknown...)
+	if err := writePSBTMap(&buf, global); err != nil {
+		return nil, err
+	}
+	for _, in := range p.Inputs {
+		fields, err := in.fields()
+		if err != nil {
+			return nil, err
+		}
+		if err = writePSBTMap(&buf, fields); err != nil {
+			return nil, err
+		}
+	}
+	for _, out := range p.Outputs {
+		if err := writePSBTMap(&buf, out.fields()); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// String is the base64 PSBT.
+func (p *PSBT) String() string {
+	b, err := p.Bytes()
+	if err != nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func (in *PSBTInput) fields() ([]PSBTField, error) {
+	var fields []PSBTField
+	add := func(key []byte, value []byte) {
+		fields = append(fields, PSBTField{key, value})
+	}
+	if in.NonWitnessUTXO != nil {
+		var buf bytes.Buffer
+		if err := in.NonWitnessUTXO.Serialize(&buf); err != nil {
+			return nil, err
+		}
+		add([]byte{psbtInNonWitnessUTXO}, buf.Bytes())
+	}
+	if in.WitnessUTXO != nil {
+		var buf bytes.Buffer
+		if err := wire.WriteTxOut(&buf, 0, 0, in.WitnessUTXO); err != nil {
+			return nil, err
+		}
+		add([]byte{psbtInWitnessUTXO}, buf.Bytes())
+	}
+	var pubs []string
+	for pub := range in.PartialSigs {
+		pubs = append(pubs, pub)
+	}
+	sort.Strings(pubs)
+	for _, pub := range pubs {
+		b, err := hex.DecodeString(pub)
+		if err != nil {
+			return nil, err
+		}
+		add(append([]byte{psbtInPartialSig}, b...), in.PartialSigs[pub])
+	}
+	if in.RedeemScript != nil {
+		add([]byte{psbtInRedeemScript}, in.RedeemScript)
+	}
+	if in.WitnessScript != nil {
+		add([]byte{psbtInWitnessScript}, in.WitnessScript)
+	}
+	for _, d := range in.Derivations {
+		add(append([]byte{psbtInBIP32Derivation}, d.Pub...), d.value())
+	}
+	if in.FinalScriptSig != nil {
+		add([]byte{psbtInFinalScriptSig}, in.FinalScriptSig)
+	}
+	if in.FinalWitness != nil {
+		var buf bytes.Buffer
+		if err := writeWitness(&buf, in.FinalWitness); err != nil {
+			return nil, err
+		}
+		add([]byte{psbtInFinalScriptWitness}, buf.Bytes())
+	}
+	return append(fields, in.Unknown...), nil
+}
+
+func (out *PSBTOutput) fields() []PSBTField {
+	var fields []PSBTField
+	if out.RedeemScript != nil {
+		fields = append(fields, PSBTField{[]byte{psbtOutRedeemScript}, out.RedeemScript})
+	}
+	if out.WitnessScript != nil {
+		fields = append(fields, PSBTField{[]byte{psbtOutWitnessScript}, out.WitnessScript})
+	}
+	for _, d := range out.Derivations {
+		fields = append(fields, PSBTField{append([]byte{psbtOutBIP32Derivation}, d.Pub...), d.value()})
+	}
+	return append(fields, out.Unknown...)
+}
+
+// AddPrevTx adds the raw transaction, which an input spends, to the inputs
+// spending it. Most signers need it, for legacy inputs and segwit ones
+// alike.
+func (p *PSBT) AddPrevTx(raw []byte) error {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return err
+	}
+	hash := tx.TxHash()
+	var found bool
+	for i, txIn := range p.Tx.TxIn {
+		if txIn.PreviousOutPoint.Hash != hash {
+			continue
+		}
+		if int(txIn.PreviousOutPoint.Index) >= len(tx.TxOut) {
+			return fmt.Errorf("Input %v spends a missing output of %s", i, hash)
+		}
+		p.Inputs[i].NonWitnessUTXO = tx
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("No input spends %s", hash)
+	}
+	return nil
+}
+
+// prevOut is the output input i spends, from the previous transaction or
+// the witness UTXO.
+func (p *PSBT) prevOut(i int) (*wire.TxOut, error) {
+	in := &p.Inputs[i]
+	if prev := in.NonWitnessUTXO; prev != nil {
+		op := p.Tx.TxIn[i].PreviousOutPoint
+		if prev.TxHash() != op.Hash || int(op.Index) >= len(prev.TxOut) {
+			return nil, fmt.Errorf("Input %v has the wrong previous transaction", i)
+		}
+		return prev.TxOut[op.Index], nil
+	}
+	if in.WitnessUTXO != nil {
+		return in.WitnessUTXO, nil
+	}
+	return nil, nil
+}
+
+func writePSBTMap(w io.Writer, fields []PSBTField) error {
+	for _, f := range fields {
+		if err := wire.WriteVarBytes(w, 0, f.Key); err != nil {
+			return err
+		}
+		if err := wire.WriteVarBytes(w, 0, f.Value); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write([]byte{0x00})
+	return err
+}
+
+// SignPSBT adds the signatures of the keys k derives, the ones of the
+// derivations with the fingerprint of k, to the inputs. k is the master key
+// of a cosigner, or its account key if the wallet has no key origins. It
+// returns the number of signatures added.
+func (k *Key) SignPSBT(p *PSBT) (int, error) {
+	fp, err := k.Fingerprint()
+	if err != nil {
+		return 0, err
+	}
+	hashes := txscript.NewTxSigHashes(p.Tx)
+	var n int
+	for i := range p.Inputs {
+		in := &p.Inputs[i]
+		if in.FinalScriptSig != nil || in.FinalWitness != nil {
+			continue
+		}
+		prev, err := p.prevOut(i)
+		if err != nil {
+			return n, err
+		}
+		for _, d := range in.Derivations {
+			if d.Fingerprint != fp {
+				continue
+			}
+			child, err := k.Derive(d.Path)
+			if err != nil {
+				return n, err
+			}
+			priv, err := (*hdkeychain.ExtendedKey)(child).ECPrivKey()
+			if err != nil {
+				return n, err
+			}
+			if !bytes.Equal(priv.PubKey().SerializeCompressed(), d.Pub) {
+				// another key with the same fingerprint.
+				continue
+			}
+			var sig []byte
+			switch {
+			case in.WitnessScript != nil && prev != nil:
+				sig, err = txscript.RawTxInWitnessSignature(p.Tx, hashes, i, prev.Value, in.WitnessScript, txscript.SigHashAll, priv)
+			case in.WitnessScript == nil && in.RedeemScript != nil:
+				sig, err = txscript.RawTxInSignature(p.Tx, i, in.RedeemScript, txscript.SigHashAll, priv)
+			default:
+				err = fmt.Errorf("Input %v has no script to sign", i)
+			}
+			if err != nil {
+				return n, err
+			}
+			if in.PartialSigs == nil {
+				in.PartialSigs = make(map[string][]byte)
+			}
+			in.PartialSigs[hexPub(d.Pub)] = sig
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Combine adds the signatures of o, a copy of p signed by other cosigners.
+func (p *PSBT) Combine(o *PSBT) error {
+	if p.Tx.TxHash() != o.Tx.TxHash() || len(p.Inputs) != len(o.Inputs) {
+		return errors.New("The PSBTs spend different transactions")
+	}
+	for i := range p.Inputs {
+		if p.Inputs[i].PartialSigs == nil {
+			p.Inputs[i].PartialSigs = make(map[string][]byte)
+		}
+		for pub, sig := range o.Inputs[i].PartialSigs {
+			p.Inputs[i].PartialSigs[pub] = sig
+		}
+		if p.Inputs[i].NonWitnessUTXO == nil {
+			p.Inputs[i].NonWitnessUTXO = o.Inputs[i].NonWitnessUTXO
+		}
+	}
+	return nil
+}
+
+// Finalize makes the scripts of the multisig inputs with enough
+// signatures, in the order of the keys of the script.
+func (p *PSBT) Finalize() error {
+	for i := range p.Inputs {
+		in := &p.Inputs[i]
+		if in.FinalScriptSig != nil || in.FinalWitness != nil {
+			continue
+		}
+		script := in.WitnessScript
+		if script == nil {
+			script = in.RedeemScript
+		}
+		m, pubs, err := parseMultisigScript(script)
+		if err != nil {
+			return fmt.Errorf("Input %v: %v", i, err)
+		}
+		var sigs [][]byte
+		for _, pub := range pubs {
+			if sig, ok := in.PartialSigs[hexPub(pub)]; ok && len(sigs) < m {
+				sigs = append(sigs, sig)
+			}
+		}
+		if len(sigs) < m {
+			return fmt.Errorf("Input %v has %v of %v signatures", i, len(sigs), m)
+		}
+		// OP_CHECKMULTISIG pops an extra item.
+		stack := append([][]byte{nil}, sigs...)
+		stack = append(stack, script)
+		if in.WitnessScript == nil {
+			b := txscript.NewScriptBuilder()
+			for _, item := range stack {
+				b.AddData(item)
+			}
+			if in.FinalScriptSig, err = b.Script(); err != nil {
+				return err
+			}
+		} else {
+			in.FinalWitness = stack
+			if in.RedeemScript != nil {
+				if in.FinalScriptSig, err = txscript.NewScriptBuilder().AddData(in.RedeemScript).Script(); err != nil {
+					return err
+				}
+			}
+		}
+		in.PartialSigs, in.Derivations = nil, nil
+	}
+	return nil
+}
+
+// Extract returns the signed transaction of a finalized PSBT.
+func (p *PSBT) Extract() ([]byte, error) {
+	tx := p.Tx.Copy()
+	for i, in := range p.Inputs {
+		if in.FinalScriptSig == nil && in.FinalWitness == nil {
+			return nil, fmt.Errorf("Input %v isn't finalized", i)
+		}
+		tx.TxIn[i].SignatureScript = in.FinalScriptSig
+		tx.TxIn[i].Witness = in.FinalWitness
+	}
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// parseMultisigScript returns M and the keys of OP_M <keys> OP_N
+// OP_CHECKMULTISIG.
+func parseMultisigScript(script []byte) (int, [][]byte, error) {
+	pushes, err := txscript.PushedData(script)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(script) < 3 || script[len(script)-1] != txscript.OP_CHECKMULTISIG ||
+		script[0] < txscript.OP_1 || script[0] > txscript.OP_16 {
+		return 0, nil, errors.New("Not a multisig script")
+	}
+	m := int(script[0] - txscript.OP_1 + 1)
+	n := int(script[len(script)-2] - txscript.OP_1 + 1)
+	if len(pushes) != n || m > n {
+		return 0, nil, errors.New("Not a multisig script")
+	}
+	return m, pushes, nil
+}
@@ -0,0 +1,124 @@
+package qrcode
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// The BBQr file types.
+const (
+	PSBT        = 'P'
+	Transaction = 'T'
+	JSON        = 'J'
+	Text        = 'U'
+	Binary      = 'B'
+)
+
+// MaxChars is the part size used by the CLI, small enough for a phone to
+// read the codes off a terminal.
+const MaxChars = 400
+
+const bbqrHeader = 8 // B$, encoding, file type, total and index
+
+var base32NoPad = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Split encodes data of fileType as BBQr parts of at most maxChars
+// characters. It's base32 so the parts use the compact alphanumeric QR mode.
+func Split(data []byte, fileType byte, maxChars int) ([]string, error) {
+	if len(data) == 0 {
+		return nil, errors.New("Invalid data/empty")
+	}
+	// every 8 base32 characters are 5 bytes, the parts split on them.
+	chunk := (maxChars - bbqrHeader) / 8 * 8
+	if chunk <= 0 {
+		return nil, fmt.Errorf("Invalid maxChars %v", maxChars)
+	}
+	enc := base32NoPad.EncodeToString(data)
+	total := (len(enc) + chunk - 1) / chunk
+	if total > 36*36-1 {
+		return nil, fmt.Errorf("%v bytes need %v parts, more than BBQr allows", len(data), total)
+	}
+	var parts []string
+	for i := 0; i < total; i++ {
+		end := (i + 1) * chunk
+		if end > len(enc) {
+			end = len(enc)
+		}
+		parts = append(parts, fmt.Sprintf("B$2%c%s%s", fileType, base36(total), base36(i))+enc[i*chunk:end])
+	}
+	return parts, nil
+}
+
+// Join decodes the BBQr parts, in any order, and returns the file type and
+// the data.
+func Join(parts ...string) (byte, []byte, error) {
+	if len(parts) == 0 {
+		return 0, nil, errors.New("Invalid part list")
+	}
+	var encoding, fileType byte
+	var total int
+	body := make(map[int]string)
+	for _, p := range parts {
+		if len(p) < bbqrHeader || !strings.HasPrefix(p, "B$") {
+			return 0, nil, fmt.Errorf("Invalid BBQr part %.16q", p)
+		}
+		n, err := strconv.ParseUint(p[4:6], 36, 16)
+		if err != nil {
+			return 0, nil, err
+		}
+		i, err := strconv.ParseUint(p[6:8], 36, 16)
+		if err != nil {
+			return 0, nil, err
+		}
+		if total == 0 {
+			encoding, fileType, total = p[2], p[3], int(n)
+		}
+		if p[2] != encoding || p[3] != fileType || int(n) != total || int(i) >= total {
+			return 0, nil, fmt.Errorf("Part %v of %v doesn't belong to the others", i, n)
+		}
+		body[int(i)] = p[bbqrHeader:]
+	}
+	var buf bytes.Buffer
+	for i := 0; i < total; i++ {
+		b, ok := body[i]
+		if !ok {
+			return 0, nil, fmt.Errorf("Missing part %v of %v", i, total)
+		}
+		buf.WriteString(b)
+	}
+	var data []byte
+	var err error
+	switch encoding {
+	case 'H':
+		data, err = hex.DecodeString(buf.String())
+	case '2':
+		data, err = base32NoPad.DecodeString(buf.String())
+	case 'Z':
+		// raw deflate, then base32.
+		var z []byte
+		if z, err = base32NoPad.DecodeString(buf.String()); err == nil {
+			data, err = ioutil.ReadAll(flate.NewReader(bytes.NewReader(z)))
+		}
+	default:
+		return 0, nil, fmt.Errorf("Unsupported BBQr encoding %q", encoding)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return fileType, data, nil
+}
+
+func base36(n int) string {
+	s := strings.ToUpper(strconv.FormatInt(int64(n), 36))
+	if len(s) < 2 {
+		s = "0" + s
+	}
+	return s
+}
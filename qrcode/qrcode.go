@@ -0,0 +1,139 @@
+// Package qrcode renders addresses, extended keys, payment URIs and PSBTs as
+// QR codes for terminals and image files.
+//
+// Payloads too large for a single scannable code are split in BBQr parts
+// (https://bbqr.org) which are shown one after the other, see Split.
+package qrcode
+
+import (
+	"bufio"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"rsc.io/qr"
+	"time"
+)
+
+// quiet is the white border around the code, in modules, required by the
+// spec so the scanners find it.
+const quiet = 4
+
+// The error correction of the codes, M survives a bit of glare or a
+// scratched screen.
+var Level = qr.M
+
+var palette = color.Palette{color.White, color.Black}
+
+// Terminal writes the code of text with UTF-8 blocks, two modules per
+// character, or with ASCII if the terminal has no UTF-8.
+func Terminal(w io.Writer, text string, ascii bool) error {
+	c, err := qr.Encode(text, Level)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	if ascii {
+		for y := -quiet; y < c.Size+quiet; y++ {
+			for x := -quiet; x < c.Size+quiet; x++ {
+				if c.Black(x, y) {
+					bw.WriteString("##")
+				} else {
+					bw.WriteString("  ")
+				}
+			}
+			bw.WriteByte('\n')
+		}
+		return bw.Flush()
+	}
+	// dark terminals show the blocks light, so the white modules are drawn.
+	blocks := [2][2]string{{"█", "▀"}, {"▄", " "}}
+	for y := -quiet; y < c.Size+quiet; y += 2 {
+		for x := -quiet; x < c.Size+quiet; x++ {
+			top, bottom := 0, 0
+			if c.Black(x, y) {
+				top = 1
+			}
+			if c.Black(x, y+1) {
+				bottom = 1
+			}
+			bw.WriteString(blocks[top][bottom])
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// Image returns the code of text with scale pixels per module.
+func Image(text string, scale int) (*image.Paletted, error) {
+	if scale < 1 {
+		return nil, errors.New("Invalid scale")
+	}
+	c, err := qr.Encode(text, Level)
+	if err != nil {
+		return nil, err
+	}
+	return render(c, c.Size, scale), nil
+}
+
+// render draws c in the middle of a square of size modules, the frames of an
+// animation have the size of the largest one.
+func render(c *qr.Code, size, scale int) *image.Paletted {
+	d := (size + 2*quiet) * scale
+	img := image.NewPaletted(image.Rect(0, 0, d, d), palette)
+	off := (size - c.Size) / 2
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.Black(x, y) {
+				continue
+			}
+			px, py := (x+off+quiet)*scale, (y+off+quiet)*scale
+			for i := 0; i < scale; i++ {
+				for j := 0; j < scale; j++ {
+					img.SetColorIndex(px+j, py+i, 1)
+				}
+			}
+		}
+	}
+	return img
+}
+
+// PNG writes the code of text as a PNG image.
+func PNG(w io.Writer, text string, scale int) error {
+	img, err := Image(text, scale)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
+
+// GIF writes the codes of parts, like the ones of Split, as an animated GIF
+// looping over them every delay.
+func GIF(w io.Writer, parts []string, scale int, delay time.Duration) error {
+	if len(parts) == 0 {
+		return errors.New("Invalid part list")
+	}
+	if scale < 1 {
+		return errors.New("Invalid scale")
+	}
+	var codes []*qr.Code
+	size := 0
+	for _, p := range parts {
+		c, err := qr.Encode(p, Level)
+		if err != nil {
+			return err
+		}
+		if c.Size > size {
+			size = c.Size
+		}
+		codes = append(codes, c)
+	}
+	g := &gif.GIF{}
+	for _, c := range codes {
+		g.Image = append(g.Image, render(c, size, scale))
+		g.Delay = append(g.Delay, int(delay/(10*time.Millisecond)))
+	}
+	return gif.EncodeAll(w, g)
+}
@@ -0,0 +1,82 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/gif"
+	"image/png"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitJoin(t *testing.T) {
+	data := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(data)
+	parts, err := Split(data, PSBT, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 19 || !strings.HasPrefix(parts[0], "B$2P0J00") || !strings.HasPrefix(parts[18], "B$2P0J0I") {
+		t.Fatalf("got %v parts starting %.8s", len(parts), parts[0])
+	}
+	for _, p := range parts[:18] {
+		if len(p) != 96 {
+			t.Fatalf("part %.8s has %v characters, want 96", p, len(p))
+		}
+	}
+	// scanned in any order.
+	parts[0], parts[5] = parts[5], parts[0]
+	typ, got, err := Join(parts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != PSBT || !bytes.Equal(got, data) {
+		t.Fatalf("got type %c and %v bytes back", typ, len(got))
+	}
+	if _, _, err = Join(parts[1:]...); err == nil {
+		t.Fatal("joined without a part")
+	}
+	if _, got, err = Join("B$HU0100" + "68656c6c6f"); err != nil || string(got) != "hello" {
+		t.Fatalf("hex part got %q, %v", got, err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	const text = "bitcoin:1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA?amount=0.0001"
+	var buf bytes.Buffer
+	if err := Terminal(&buf, text, true); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) == 0 || len(lines[0]) != 2*len(lines) {
+		t.Fatalf("ascii code isn't square, %v lines of %v", len(lines), len(lines[0]))
+	}
+	buf.Reset()
+	if err := PNG(&buf, text, 4); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := img.Bounds().Dx(); d != len(lines)*4 {
+		t.Fatalf("png is %v pixels wide, want %v", d, len(lines)*4)
+	}
+
+	parts, err := Split([]byte(strings.Repeat(text, 10)), Text, MaxChars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err = GIF(&buf, parts, 2, 500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	g, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image) != len(parts) {
+		t.Fatalf("got %v frames, want %v", len(g.Image), len(parts))
+	}
+}
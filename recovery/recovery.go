@@ -0,0 +1,269 @@
+// Package recovery finds the funds of a mnemonic whatever wallet made them.
+//
+// Wallets don't agree on the derivation paths: BIP 44, 49, 84 and 86 use one
+// purpose per address type, Electrum derives from the master key and the
+// ethereum wallets all have their own paths. A Scanner walks the accounts and
+// the addresses of every Scheme up to the gap limits and reports the
+// addresses with history and their balance.
+package recovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/golang/glog"
+	"github.com/winteraz/cryptopay"
+	"github.com/winteraz/cryptopay/wallet"
+	"sort"
+)
+
+// DefaultGap is the address gap limit of BIP 44.
+const DefaultGap = 20
+
+// Scheme is a way wallets derive addresses from the master key.
+type Scheme struct {
+	Name string
+	Coin cryptopay.CoinType
+	// Type of the bitcoin addresses.
+	Type cryptopay.AddressType
+	// Path returns the path of address index of a chain of an account.
+	Path func(account, chain, index uint32) cryptopay.Path
+	// Chains of the accounts, receive and change or one chain.
+	Chains []uint32
+	// Accounts tells if the scheme has more than account 0.
+	Accounts bool
+	// AccountGap overrides the Scanner's when it's larger, for the
+	// schemes whose accounts are cheap to scan.
+	AccountGap uint32
+	// Addresses is the number of addresses of a chain, 0 if they are
+	// scanned up to the gap limit.
+	Addresses uint32
+}
+
+func bip44(purpose uint32, coin cryptopay.CoinType) func(account, chain, index uint32) cryptopay.Path {
+	return func(account, chain, index uint32) cryptopay.Path {
+		return cryptopay.AccountPath(purpose, coin, account).Child(chain, index)
+	}
+}
+
+// DefaultSchemes are the standard purposes and the paths of the popular
+// wallets which don't follow them.
+var DefaultSchemes = []Scheme{
+	{Name: "BIP44", Coin: cryptopay.BTC, Type: cryptopay.P2PKH, Path: bip44(44, cryptopay.BTC), Chains: []uint32{0, 1}, Accounts: true},
+	{Name: "BIP49", Coin: cryptopay.BTC, Type: cryptopay.P2SH, Path: bip44(49, cryptopay.BTC), Chains: []uint32{0, 1}, Accounts: true},
+	{Name: "BIP84", Coin: cryptopay.BTC, Type: cryptopay.P2WPKH, Path: bip44(84, cryptopay.BTC), Chains: []uint32{0, 1}, Accounts: true},
+	{Name: "BIP86", Coin: cryptopay.BTC, Type: cryptopay.P2TR, Path: bip44(86, cryptopay.BTC), Chains: []uint32{0, 1}, Accounts: true},
+	// Electrum with a BIP 39 seed and no derivation path, m/0/x and m/1/x.
+	// Electrum's own seeds aren't BIP 39 and need Electrum.
+	{Name: "Electrum legacy", Coin: cryptopay.BTC, Type: cryptopay.P2PKH, Chains: []uint32{0, 1},
+		Path: func(account, chain, index uint32) cryptopay.Path {
+			return cryptopay.Path{chain, index}
+		}},
+	{Name: "BIP44", Coin: cryptopay.BCH, Type: cryptopay.P2PKH, Path: bip44(44, cryptopay.BCH), Chains: []uint32{0, 1}, Accounts: true},
+	{Name: "BIP44", Coin: cryptopay.ETH, Path: bip44(44, cryptopay.ETH), Chains: []uint32{0, 1}, Accounts: true},
+	// Ledger Live has one address per account, m/44'/60'/x'/0/0. It's the
+	// first of a BIP44 account but the accounts are scanned past the empty
+	// ones as they are a single address.
+	{Name: "Ledger Live", Coin: cryptopay.ETH, Chains: []uint32{0}, Accounts: true, AccountGap: DefaultGap, Addresses: 1,
+		Path: func(account, chain, index uint32) cryptopay.Path {
+			return cryptopay.AccountPath(44, cryptopay.ETH, account).Child(0, 0)
+		}},
+	// MyEtherWallet and the old Ledger app, m/44'/60'/0'/x.
+	{Name: "MyEtherWallet", Coin: cryptopay.ETH, Chains: []uint32{0},
+		Path: func(account, chain, index uint32) cryptopay.Path {
+			return cryptopay.AccountPath(44, cryptopay.ETH, 0).Child(index)
+		}},
+}
+
+// Found is an address with history.
+type Found struct {
+	Scheme  string
+	Coin    cryptopay.CoinType
+	Path    cryptopay.Path
+	Address string
+	Balance wallet.Balance
+}
+
+type Scanner struct {
+	Schemes []Scheme
+	// AccountGap is the number of empty accounts after the last used one
+	// which are scanned, 1 stops at the first empty account.
+	AccountGap uint32
+	// AddressGap is the number of unused addresses after the last used one.
+	AddressGap    uint32
+	Confirmations wallet.Policy
+	// Network of the bitcoin addresses.
+	Network    cryptopay.Network
+	unspenders map[cryptopay.CoinType]wallet.Unspender
+}
+
+// New returns a scanner of the DefaultSchemes of the coins with an
+// unspender.
+func New(unspenders map[cryptopay.CoinType]wallet.Unspender) *Scanner {
+	return &Scanner{
+		Schemes:    DefaultSchemes,
+		AccountGap: 1,
+		AddressGap: DefaultGap,
+		unspenders: unspenders,
+	}
+}
+
+// ScanMnemonic scans the master key of the mnemonic, see Scan.
+func (s *Scanner) ScanMnemonic(cx context.Context, mnemonic, passwd string) ([]Found, error) {
+	master, _, err := cryptopay.NewFromMnemonic(mnemonic, passwd)
+	if err != nil {
+		return nil, err
+	}
+	return s.Scan(cx, master)
+}
+
+// Scan returns the addresses with history of every scheme of a coin with
+// an unspender, in scheme and path order. An address shared by two schemes
+// is reported by the first one.
+func (s *Scanner) Scan(cx context.Context, master *cryptopay.Key) ([]Found, error) {
+	if master == nil {
+		return nil, errors.New("Invalid master key/nil")
+	}
+	var out []Found
+	seen := make(map[string]bool)
+	for _, scheme := range s.Schemes {
+		unspender, ok := s.unspenders[scheme.Coin]
+		if !ok {
+			continue
+		}
+		found, err := s.scanScheme(cx, master, scheme, unspender)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %v", scheme.Name, scheme.Coin, err)
+		}
+		for _, f := range found {
+			if !seen[f.Address] {
+				seen[f.Address] = true
+				out = append(out, f)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (s *Scanner) scanScheme(cx context.Context, master *cryptopay.Key, scheme Scheme, unspender wallet.Unspender) ([]Found, error) {
+	accountGap := s.AccountGap
+	if scheme.AccountGap > accountGap {
+		accountGap = scheme.AccountGap
+	}
+	if accountGap == 0 || !scheme.Accounts {
+		accountGap = 1
+	}
+	// the paths of the used addresses.
+	used := make(map[string]cryptopay.Path)
+	for account, empty := uint32(0), uint32(0); empty < accountGap; account++ {
+		n := len(used)
+		for _, chain := range scheme.Chains {
+			if err := s.scanChain(cx, master, scheme, unspender, account, chain, used); err != nil {
+				return nil, err
+			}
+		}
+		if len(used) > n {
+			empty = 0
+			log.Infof("%s %s account %v has history", scheme.Name, scheme.Coin, account)
+			continue
+		}
+		empty++
+	}
+	if len(used) == 0 {
+		return nil, nil
+	}
+	var addrs []string
+	for a := range used {
+		addrs = append(addrs, a)
+	}
+	unspent, err := unspender.Unspent(cx, addrs...)
+	if err != nil {
+		return nil, err
+	}
+	confirmations := s.Confirmations.Confirmations(scheme.Coin)
+	var out []Found
+	for a, p := range used {
+		f := Found{Scheme: scheme.Name, Coin: scheme.Coin, Path: p, Address: a}
+		for _, un := range unspent[a] {
+			switch {
+			case un.Coinbase && un.Confirmations < cryptopay.CoinbaseMaturity:
+				f.Balance.Locked += un.Amount
+			case un.Confirmations < confirmations:
+				f.Balance.Incoming += un.Amount
+			default:
+				f.Balance.Confirmed += un.Amount
+			}
+		}
+		out = append(out, f)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return pathLess(out[i].Path, out[j].Path)
+	})
+	return out, nil
+}
+
+// scanChain adds the used addresses of a chain to used, asking for the
+// history of AddressGap addresses at a time.
+func (s *Scanner) scanChain(cx context.Context, master *cryptopay.Key, scheme Scheme, unspender wallet.Unspender, account, chain uint32, used map[string]cryptopay.Path) error {
+	gap := s.AddressGap
+	if gap == 0 {
+		gap = DefaultGap
+	}
+	if scheme.Addresses > 0 {
+		gap = scheme.Addresses
+	}
+	// the index after the last used address.
+	next := uint32(0)
+	for start := uint32(0); start < next+gap; {
+		end := next + gap
+		if scheme.Addresses > 0 && end > scheme.Addresses {
+			if start >= scheme.Addresses {
+				break
+			}
+			end = scheme.Addresses
+		}
+		paths := make(map[string]cryptopay.Path)
+		var addrs []string
+		for index := start; index < end; index++ {
+			p := scheme.Path(account, chain, index)
+			addr, err := s.address(master, scheme, p)
+			if err != nil {
+				return err
+			}
+			paths[addr] = p
+			addrs = append(addrs, addr)
+		}
+		history, err := unspender.HasTransactions(cx, addrs...)
+		if err != nil {
+			return err
+		}
+		for i, addr := range addrs {
+			if history[addr] {
+				used[addr] = paths[addr]
+				next = start + uint32(i) + 1
+			}
+		}
+		start = end
+	}
+	return nil
+}
+
+func (s *Scanner) address(master *cryptopay.Key, scheme Scheme, p cryptopay.Path) (string, error) {
+	k, err := master.Derive(p)
+	if err != nil {
+		return "", err
+	}
+	if scheme.Coin != cryptopay.BTC {
+		return k.PayAddress(scheme.Coin)
+	}
+	return k.ScriptAddress(scheme.Type, s.Network)
+}
+
+func pathLess(a, b cryptopay.Path) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
@@ -0,0 +1,157 @@
+package recovery
+
+import (
+	"context"
+	"github.com/winteraz/cryptopay"
+	"github.com/winteraz/cryptopay/chaintest"
+	"github.com/winteraz/cryptopay/wallet"
+	"testing"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestScan(t *testing.T) {
+	cx := context.Background()
+	chain, err := chaintest.New(cryptopay.BTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, _, err := cryptopay.NewFromMnemonic(testMnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	funds := map[string]uint64{
+		"m/84'/0'/0'/0/3":  10000,
+		"m/84'/0'/0'/1/0":  20000,
+		"m/84'/0'/2'/0/15": 30000,
+		"m/44'/0'/0'/0/0":  40000,
+		"m/0/5":            50000,
+	}
+	types := map[uint32]cryptopay.AddressType{
+		cryptopay.Hardened(44): cryptopay.P2PKH,
+		cryptopay.Hardened(84): cryptopay.P2WPKH,
+		0:                      cryptopay.P2PKH,
+	}
+	for s, amount := range funds {
+		p, err := cryptopay.ParsePath(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k, err := master.Derive(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr, err := k.ScriptAddress(types[p[0]], cryptopay.MainNet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = chain.Fund(addr, amount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chain.Mine(1)
+	s := New(map[cryptopay.CoinType]wallet.Unspender{cryptopay.BTC: chain})
+	s.AccountGap = 2
+	found, err := s.Scan(cx, master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// account 2 is after an empty account.
+	want := []string{"m/44'/0'/0'/0/0", "m/84'/0'/0'/0/3", "m/84'/0'/0'/1/0", "m/84'/0'/2'/0/15", "m/0/5"}
+	if len(found) != len(want) {
+		t.Fatalf("got %+v, want %q", found, want)
+	}
+	for i, f := range found {
+		if f.Path.String() != want[i] || f.Balance.Confirmed != funds[want[i]] {
+			t.Errorf("%v: got %s %+v, want %s", i, f.Path, f.Balance, want[i])
+		}
+	}
+	// one empty account stops the scan.
+	s.AccountGap = 1
+	if found, err = s.Scan(cx, master); err != nil || len(found) != 4 {
+		t.Fatalf("got %+v, %v", found, err)
+	}
+}
+
+// fund pays the ethereum addresses of the paths of master and mines them.
+func fund(t *testing.T, chain *chaintest.Chain, master *cryptopay.Key, funds map[string]uint64) {
+	for s, amount := range funds {
+		p, err := cryptopay.ParsePath(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k, err := master.Derive(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr, err := k.PayAddress(cryptopay.ETH)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = chain.Fund(addr, amount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chain.Mine(1)
+}
+
+func TestScanETH(t *testing.T) {
+	cx := context.Background()
+	chain, err := chaintest.New(cryptopay.ETH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, _, err := cryptopay.NewFromMnemonic(testMnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	funds := map[string]uint64{
+		// BIP44 and the Ledger Live accounts.
+		"m/44'/60'/0'/0/0": 1000,
+		"m/44'/60'/1'/0/0": 2000,
+		"m/44'/60'/1'/0/7": 3000,
+		// MyEtherWallet.
+		"m/44'/60'/0'/4": 4000,
+	}
+	fund(t, chain, master, funds)
+	s := New(map[cryptopay.CoinType]wallet.Unspender{cryptopay.ETH: chain})
+	found, err := s.Scan(cx, master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every address once.
+	want := []string{"m/44'/60'/0'/0/0", "m/44'/60'/1'/0/0", "m/44'/60'/1'/0/7", "m/44'/60'/0'/4"}
+	if len(found) != len(want) {
+		t.Fatalf("got %+v, want %q", found, want)
+	}
+	for i, f := range found {
+		if f.Path.String() != want[i] || f.Balance.Confirmed != funds[want[i]] {
+			t.Errorf("%v: got %s %+v, want %s", i, f.Path, f.Balance, want[i])
+		}
+	}
+	if found[0].Address != "0x9858EfFD232B4033E47d90003D41EC34EcaEda94" || found[3].Scheme != "MyEtherWallet" {
+		t.Errorf("got %+v", found)
+	}
+}
+
+func TestScanLedgerLive(t *testing.T) {
+	chain, err := chaintest.New(cryptopay.ETH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, _, err := cryptopay.NewFromMnemonic(testMnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// account 0 is empty, BIP44 stops there.
+	fund(t, chain, master, map[string]uint64{"m/44'/60'/1'/0/0": 5000})
+	s := New(map[cryptopay.CoinType]wallet.Unspender{cryptopay.ETH: chain})
+	found, err := s.Scan(context.Background(), master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Scheme != "Ledger Live" || found[0].Path.String() != "m/44'/60'/1'/0/0" ||
+		found[0].Balance.Confirmed != 5000 {
+		t.Fatalf("got %+v", found)
+	}
+}
@@ -0,0 +1,146 @@
+package cryptopay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/wire"
+	"math/big"
+)
+
+// https://github.com/bitcoin/bips/blob/master/bip-0340.mediawiki
+// https://github.com/bitcoin/bips/blob/master/bip-0341.mediawiki
+
+// taprootSecret is the private key of the BIP 86 output key of priv, see
+// taprootOutputKey.
+func taprootSecret(priv *btcec.PrivateKey) (*big.Int, error) {
+	curve := btcec.S256()
+	pub := priv.PubKey()
+	d := new(big.Int).Set(priv.D)
+	if pub.Y.Bit(0) == 1 {
+		d.Sub(curve.N, d)
+	}
+	t := new(big.Int).SetBytes(taggedHash("TapTweak", pad32(pub.X)))
+	if t.Cmp(curve.N) >= 0 {
+		return nil, errors.New("Invalid taproot tweak")
+	}
+	d.Add(d, t).Mod(d, curve.N)
+	if d.Sign() == 0 {
+		return nil, errors.New("Invalid taproot tweak")
+	}
+	return d, nil
+}
+
+// schnorrSign signs the 32 bytes msg with the secret d and the auxiliary
+// randomness aux.
+func schnorrSign(d *big.Int, msg, aux []byte) ([]byte, error) {
+	curve := btcec.S256()
+	if d.Sign() == 0 || d.Cmp(curve.N) >= 0 {
+		return nil, errors.New("Invalid private key")
+	}
+	px, py := curve.ScalarBaseMult(pad32(d))
+	if py.Bit(0) == 1 {
+		d = new(big.Int).Sub(curve.N, d)
+	}
+	t := taggedHash("BIP0340/aux", aux)
+	for i, b := range pad32(d) {
+		t[i] ^= b
+	}
+	k := new(big.Int).SetBytes(taggedHash("BIP0340/nonce", t, pad32(px), msg))
+	k.Mod(k, curve.N)
+	if k.Sign() == 0 {
+		return nil, errors.New("Invalid schnorr nonce")
+	}
+	rx, ry := curve.ScalarBaseMult(pad32(k))
+	if ry.Bit(0) == 1 {
+		k.Sub(curve.N, k)
+	}
+	e := new(big.Int).SetBytes(taggedHash("BIP0340/challenge", pad32(rx), pad32(px), msg))
+	s := e.Mul(e, d).Add(e, k)
+	s.Mod(s, curve.N)
+	return append(pad32(rx), pad32(s)...), nil
+}
+
+// schnorrVerify checks the signature of msg by the x only public key.
+func schnorrVerify(pubX, msg, sig []byte) bool {
+	curve := btcec.S256()
+	if len(pubX) != 32 || len(sig) != 64 {
+		return false
+	}
+	px := new(big.Int).SetBytes(pubX)
+	py, ok := liftX(px)
+	if !ok {
+		return false
+	}
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	if r.Cmp(curve.P) >= 0 || s.Cmp(curve.N) >= 0 {
+		return false
+	}
+	e := new(big.Int).SetBytes(taggedHash("BIP0340/challenge", sig[:32], pubX, msg))
+	e.Mod(e, curve.N)
+	sx, sy := curve.ScalarBaseMult(sig[32:])
+	ex, ey := curve.ScalarMult(px, py, pad32(e))
+	rx, ry := curve.Add(sx, sy, ex, new(big.Int).Sub(curve.P, ey))
+	if rx.Sign() == 0 && ry.Sign() == 0 || ry.Bit(0) == 1 {
+		return false
+	}
+	return rx.Cmp(r) == 0
+}
+
+// liftX returns the even y of x.
+func liftX(x *big.Int) (*big.Int, bool) {
+	p := btcec.S256().P
+	if x.Cmp(p) >= 0 {
+		return nil, false
+	}
+	c := new(big.Int).Exp(x, big.NewInt(3), p)
+	c.Add(c, big.NewInt(7)).Mod(c, p)
+	y := new(big.Int).Exp(c, new(big.Int).Rsh(new(big.Int).Add(p, big.NewInt(1)), 2), p)
+	if new(big.Int).Exp(y, big.NewInt(2), p).Cmp(c) != 0 {
+		return nil, false
+	}
+	if y.Bit(0) == 1 {
+		y.Sub(p, y)
+	}
+	return y, true
+}
+
+// taprootSigHash is the hash of the key path spend of the only input of tx,
+// paying amount to script, for SIGHASH_DEFAULT (0) or SIGHASH_ALL.
+func taprootSigHash(tx *wire.MsgTx, script []byte, amount int64, hashType byte) ([]byte, error) {
+	if hashType > 1 {
+		return nil, errors.New("Unsupported taproot hash type")
+	}
+	if len(tx.TxIn) != 1 {
+		return nil, errors.New("Only single input taproot transactions are supported")
+	}
+	var prevouts, amounts, scripts, sequences, outputs bytes.Buffer
+	in := tx.TxIn[0]
+	prevouts.Write(in.PreviousOutPoint.Hash[:])
+	binary.Write(&prevouts, binary.LittleEndian, in.PreviousOutPoint.Index)
+	binary.Write(&amounts, binary.LittleEndian, amount)
+	if err := wire.WriteVarBytes(&scripts, 0, script); err != nil {
+		return nil, err
+	}
+	binary.Write(&sequences, binary.LittleEndian, in.Sequence)
+	for _, out := range tx.TxOut {
+		if err := wire.WriteTxOut(&outputs, 0, 0, out); err != nil {
+			return nil, err
+		}
+	}
+	var msg bytes.Buffer
+	// the epoch.
+	msg.Write([]byte{0x00, hashType})
+	binary.Write(&msg, binary.LittleEndian, tx.Version)
+	binary.Write(&msg, binary.LittleEndian, tx.LockTime)
+	for _, b := range []*bytes.Buffer{&prevouts, &amounts, &scripts, &sequences, &outputs} {
+		h := sha256.Sum256(b.Bytes())
+		msg.Write(h[:])
+	}
+	// key path without annex, input 0.
+	msg.Write([]byte{0x00, 0, 0, 0, 0})
+	return taggedHash("TapSighash", msg.Bytes()), nil
+}
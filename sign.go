@@ -0,0 +1,122 @@
+package cryptopay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+// SignInput is an input of a transaction spending an output of the address
+// of Type of the key at Path, relative to the account key.
+type SignInput struct {
+	Path   Path
+	Type   AddressType
+	Amount uint64
+}
+
+// NewTransactionBTC is the unsigned transaction paying amount to the address
+// to out of unspent, the rest less fee going back to change. Change below
+// the dust limit goes to the miners.
+func NewTransactionBTC(to, change string, amount, fee uint64, unspent []Unspent) ([]byte, error) {
+	pkScript, _, err := addressScript(MainNet, to)
+	if err != nil {
+		return nil, err
+	}
+	changeScript, _, err := addressScript(MainNet, change)
+	if err != nil {
+		return nil, err
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	var total uint64
+	for _, un := range unspent {
+		hash, err := chainhash.NewHashFromStr(un.Tx)
+		if err != nil {
+			return nil, err
+		}
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(hash, un.N), nil, nil))
+		total += un.Amount
+	}
+	if len(unspent) == 0 || total < amount+fee {
+		return nil, fmt.Errorf("Insufficient funds %v for %v and the fee %v", total, amount, fee)
+	}
+	tx.AddTxOut(wire.NewTxOut(int64(amount), pkScript))
+	if rest := total - amount - fee; rest >= dustLimit {
+		tx.AddTxOut(wire.NewTxOut(int64(rest), changeScript))
+	}
+	var buf bytes.Buffer
+	if err = tx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SignTransactionBTC signs the inputs of the unsigned tx with the children
+// of the account key k, one SignInput per input. P2TR isn't supported.
+func (k *Key) SignTransactionBTC(tx []byte, inputs []SignInput) ([]byte, error) {
+	msg := wire.NewMsgTx(wire.TxVersion)
+	if err := msg.Deserialize(bytes.NewReader(tx)); err != nil {
+		return nil, err
+	}
+	if len(inputs) != len(msg.TxIn) {
+		return nil, fmt.Errorf("%v inputs to sign, the transaction has %v", len(inputs), len(msg.TxIn))
+	}
+	hashes := txscript.NewTxSigHashes(msg)
+	for i, in := range inputs {
+		child, err := k.Derive(in.Path)
+		if err != nil {
+			return nil, err
+		}
+		priv, err := (*hdkeychain.ExtendedKey)(child).ECPrivKey()
+		if err != nil {
+			return nil, err
+		}
+		s := Spend{Unspent: Unspent{Amount: in.Amount}, KeyAddress: KeyAddress{Type: in.Type, Compressed: true}}
+		if err = signSweep(msg, hashes, i, s, priv); err != nil {
+			return nil, fmt.Errorf("%s: %v", in.Path, err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := msg.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SignedSizeBTC estimates the virtual size of the unsigned tx once its
+// inputs are signed, with 72 bytes signatures.
+func SignedSizeBTC(tx []byte, inputs []SignInput) (int, error) {
+	if len(inputs) == 0 {
+		return 0, errors.New("Invalid inputs/empty")
+	}
+	const sigPub = 1 + 72 + 1 + 33
+	weight := len(tx) * 4
+	witness := 0
+	for _, in := range inputs {
+		switch in.Type {
+		case P2PKH:
+			weight += sigPub * 4
+		case P2SH:
+			// the push of the P2WPKH program.
+			weight += 23 * 4
+			witness += 1 + sigPub
+		case P2WPKH:
+			witness += 1 + sigPub
+		default:
+			return 0, fmt.Errorf("Can't sign %s outputs", in.Type)
+		}
+	}
+	if witness > 0 {
+		// the marker, flag and the empty witnesses of the legacy inputs.
+		weight += 2 + witness
+		for _, in := range inputs {
+			if in.Type == P2PKH {
+				weight++
+			}
+		}
+	}
+	return (weight + 3) / 4, nil
+}
@@ -0,0 +1,155 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/golang/glog"
+	"github.com/winteraz/cryptopay"
+	"github.com/winteraz/cryptopay/wallet"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type btcRequest struct {
+	Tx     string                `json:"tx"` // hex
+	Inputs []cryptopay.SignInput `json:"inputs"`
+}
+
+type ethRequest struct {
+	Path cryptopay.Path         `json:"path"`
+	Tx   *wallet.ETHTransaction `json:"tx"`
+}
+
+type response struct {
+	Tx string `json:"tx"` // hex
+}
+
+// ServeHTTP signs the JSON requests POSTed to /btc and /eth. The refused
+// ones are 403.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.policy.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.policy.Token {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+	var b []byte
+	var err error
+	switch r.URL.Path {
+	case "/btc":
+		var req btcRequest
+		if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var tx []byte
+		if tx, err = hex.DecodeString(req.Tx); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, err = s.SignBTC(r.Context(), tx, req.Inputs)
+	case "/eth":
+		var req ethRequest
+		if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, err = s.SignETH(r.Context(), req.Path, req.Tx)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case err == ErrPolicy:
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(&response{Tx: hex.EncodeToString(b)}); err != nil {
+		log.Error(err)
+	}
+}
+
+// Client is the wallet.Signer of a remote Server.
+type Client struct {
+	endpoint string
+	token    string
+	cl       *http.Client
+}
+
+// NewClient returns the signer of the Server at endpoint, like
+// http://10.0.0.2:8335. The requests aren't retried, a lost answer would
+// count twice in the daily limit.
+func NewClient(endpoint, token string, cl *http.Client) *Client {
+	if cl == nil {
+		cl = http.DefaultClient
+	}
+	return &Client{endpoint: strings.TrimSuffix(endpoint, "/"), token: token, cl: cl}
+}
+
+const timeout = 30 * time.Second
+
+func (c *Client) SignBTC(cx context.Context, tx []byte, inputs []cryptopay.SignInput) ([]byte, error) {
+	return c.do(cx, "/btc", &btcRequest{Tx: hex.EncodeToString(tx), Inputs: inputs})
+}
+
+func (c *Client) SignETH(cx context.Context, path cryptopay.Path, tx *wallet.ETHTransaction) ([]byte, error) {
+	return c.do(cx, "/eth", &ethRequest{Path: path, Tx: tx})
+}
+
+func (c *Client) do(cx context.Context, method string, v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	URL := c.endpoint + method
+	req, err := http.NewRequest("POST", URL, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	ctx, cancel := context.WithTimeout(cx, timeout)
+	defer cancel()
+	rsp, err := c.cl.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if b, err = ioutil.ReadAll(rsp.Body); err != nil {
+		return nil, err
+	}
+	switch rsp.StatusCode {
+	case http.StatusOK:
+	case http.StatusForbidden:
+		return nil, ErrPolicy
+	default:
+		err = fmt.Errorf("Invalid response: \n URL %s\n Status  %v, body %s",
+			URL, rsp.StatusCode, b)
+		log.Error(err)
+		return nil, err
+	}
+	var r response
+	if err = json.Unmarshal(b, &r); err != nil {
+		log.Errorf("%v, %s", err, b)
+		return nil, err
+	}
+	if r.Tx == "" {
+		return nil, errors.New("Invalid response/empty")
+	}
+	return hex.DecodeString(r.Tx)
+}
@@ -0,0 +1,195 @@
+// Package signer keeps the private keys of an account out of the wallets
+// talking to the network. A Server signs the transactions of the account,
+// over HTTP or in process, after checking them against its own Policy, and
+// a Client is the wallet.Signer of a remote Server, see wallet.FromSigner.
+package signer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	log "github.com/golang/glog"
+	"github.com/winteraz/cryptopay"
+	"github.com/winteraz/cryptopay/wallet"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrPolicy is returned for the transactions the policy refuses.
+var ErrPolicy = errors.New("Refused by the signer policy")
+
+// Policy limits what a Server signs. The amounts are in satoshi or wei,
+// the fee included, except for bitcoin transactions with legacy inputs, and
+// the change back to the inputs addresses excluded.
+type Policy struct {
+	// MaxAmount is the most a transaction spends, 0 is unlimited.
+	MaxAmount uint64
+	// DailyLimit is the most the transactions of the last 24 hours spend,
+	// 0 is unlimited.
+	DailyLimit uint64
+	// Allowed are the only addresses paid, any if empty.
+	Allowed []string
+	// Token is the bearer token the HTTP requests need, none if empty.
+	Token string
+}
+
+func (p *Policy) allowed(addr string) bool {
+	if len(p.Allowed) == 0 {
+		return true
+	}
+	for _, a := range p.Allowed {
+		if strings.EqualFold(a, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+type spending struct {
+	at     time.Time
+	amount uint64
+}
+
+// Server is the wallet.Signer of an account key of coin enforcing a policy.
+type Server struct {
+	coin    cryptopay.CoinType
+	account *cryptopay.Key
+	signer  wallet.Signer
+	policy  Policy
+	mu      sync.Mutex
+	spent   []spending
+	now     func() time.Time
+}
+
+// NewServer signs the transactions of the private account key of coin, like
+// m/44'/0'/0', allowed by policy.
+func NewServer(account *cryptopay.Key, coin cryptopay.CoinType, policy Policy) *Server {
+	return &Server{coin: coin, account: account, signer: wallet.KeySigner(account),
+		policy: policy, now: time.Now}
+}
+
+func (s *Server) SignBTC(cx context.Context, tx []byte, inputs []cryptopay.SignInput) ([]byte, error) {
+	if s.coin != cryptopay.BTC {
+		return nil, fmt.Errorf("The signer signs %s only", s.coin)
+	}
+	amount, err := s.spendingBTC(tx, inputs)
+	if err != nil {
+		return nil, err
+	}
+	return s.sign(amount, func() ([]byte, error) {
+		return s.signer.SignBTC(cx, tx, inputs)
+	})
+}
+
+func (s *Server) SignETH(cx context.Context, path cryptopay.Path, tx *wallet.ETHTransaction) ([]byte, error) {
+	if s.coin != cryptopay.ETH {
+		return nil, fmt.Errorf("The signer signs %s only", s.coin)
+	}
+	if tx == nil {
+		return nil, errors.New("Invalid transaction/nil")
+	}
+	if !s.policy.allowed(tx.To) {
+		log.Errorf("%s isn't allowed", tx.To)
+		return nil, ErrPolicy
+	}
+	// a crafted gas price mustn't wrap the amount below the limits.
+	if tx.GasPrice != 0 && tx.GasLimit > math.MaxUint64/tx.GasPrice ||
+		tx.Value > math.MaxUint64-tx.GasLimit*tx.GasPrice {
+		log.Errorf("The amount of %+v overflows", *tx)
+		return nil, ErrPolicy
+	}
+	return s.sign(tx.Value+tx.GasLimit*tx.GasPrice, func() ([]byte, error) {
+		return s.signer.SignETH(cx, path, tx)
+	})
+}
+
+// spendingBTC returns what tx spends, checking its destinations. The
+// outputs paying the addresses of the inputs are change. The amounts of the
+// inputs come from the client and legacy sighashes don't commit to them, so
+// the spending is the outputs paid, and the fee only if every input is
+// segwit, where a wrong amount makes the signature invalid.
+func (s *Server) spendingBTC(tx []byte, inputs []cryptopay.SignInput) (uint64, error) {
+	msg := wire.NewMsgTx(wire.TxVersion)
+	if err := msg.Deserialize(bytes.NewReader(tx)); err != nil {
+		return 0, err
+	}
+	own := make(map[string]bool)
+	var in uint64
+	segwit := true
+	for _, i := range inputs {
+		k, err := s.account.Derive(i.Path)
+		if err != nil {
+			return 0, err
+		}
+		addr, err := k.ScriptAddress(i.Type, cryptopay.MainNet)
+		if err != nil {
+			return 0, err
+		}
+		own[addr] = true
+		in += i.Amount
+		if i.Type == cryptopay.P2PKH {
+			segwit = false
+		}
+	}
+	var paid, out uint64
+	for _, txOut := range msg.TxOut {
+		_, addrs, _, err := txscript.ExtractPkScriptAddrs(txOut.PkScript, &chaincfg.MainNetParams)
+		if err != nil || len(addrs) != 1 {
+			log.Errorf("Unknown output script %x", txOut.PkScript)
+			return 0, ErrPolicy
+		}
+		addr := addrs[0].EncodeAddress()
+		out += uint64(txOut.Value)
+		switch {
+		case own[addr]:
+		case !s.policy.allowed(addr):
+			log.Errorf("%s isn't allowed", addr)
+			return 0, ErrPolicy
+		default:
+			paid += uint64(txOut.Value)
+		}
+	}
+	if !segwit {
+		return paid, nil
+	}
+	if out > in {
+		return 0, fmt.Errorf("The outputs %v are more than the inputs %v", out, in)
+	}
+	return paid + in - out, nil
+}
+
+// sign calls sign if the policy allows spending amount, counting it.
+func (s *Server) sign(amount uint64, sign func() ([]byte, error)) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.policy.MaxAmount > 0 && amount > s.policy.MaxAmount {
+		log.Errorf("Amount %v is more than %v", amount, s.policy.MaxAmount)
+		return nil, ErrPolicy
+	}
+	now := s.now()
+	var day uint64
+	var recent []spending
+	for _, sp := range s.spent {
+		if now.Sub(sp.at) < 24*time.Hour {
+			recent = append(recent, sp)
+			day += sp.amount
+		}
+	}
+	s.spent = recent
+	if s.policy.DailyLimit > 0 && day+amount > s.policy.DailyLimit {
+		log.Errorf("Amount %v is over the daily limit %v, %v spent", amount, s.policy.DailyLimit, day)
+		return nil, ErrPolicy
+	}
+	b, err := sign()
+	if err != nil {
+		return nil, err
+	}
+	s.spent = append(s.spent, spending{at: now, amount: amount})
+	return b, nil
+}
@@ -0,0 +1,143 @@
+package signer
+
+import (
+	"context"
+	"github.com/winteraz/cryptopay"
+	"github.com/winteraz/cryptopay/chaintest"
+	"github.com/winteraz/cryptopay/wallet"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func account(t *testing.T, pass string) (*cryptopay.Key, string) {
+	master, _, err := cryptopay.NewFromMnemonic(testMnemonic, pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := master.DeriveExtendedAccountKey(true, cryptopay.BTC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := master.DeriveExtendedAccountKey(false, cryptopay.BTC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, pub.Base58()
+}
+
+func TestRemoteSigner(t *testing.T) {
+	cx := context.Background()
+	chain, err := chaintest.New(cryptopay.BTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, pub := account(t, "")
+	srv := httptest.NewServer(NewServer(priv, cryptopay.BTC, Policy{MaxAmount: 200000, DailyLimit: 250000, Token: "secret"}))
+	defer srv.Close()
+	// the wallet has the xpub only.
+	w, err := wallet.FromSigner(pub, cryptopay.BTC, NewClient(srv.URL, "secret", nil), chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext, err := w.Addresses(cx, false, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, toPub := account(t, "destination")
+	if _, err = chain.Fund(ext[0], 150000); err != nil {
+		t.Fatal(err)
+	}
+	chain.Mine(1)
+	txa, err := w.Move(cx, toPub, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txa) != 1 {
+		t.Fatalf("got %v transactions", len(txa))
+	}
+	errs, err := chain.Broadcast(cx, txa...)
+	if err != nil || errs[txa[0]] != nil {
+		t.Fatalf("broadcast %v, %v", errs[txa[0]], err)
+	}
+	chain.Mine(1)
+	// 150000 and 150000 are over the daily limit.
+	if _, err = chain.Fund(ext[1], 150000); err != nil {
+		t.Fatal(err)
+	}
+	chain.Mine(1)
+	if _, err = w.Move(cx, toPub, 5); err != ErrPolicy {
+		t.Fatalf("moved over the daily limit, %v", err)
+	}
+	w, err = wallet.FromSigner(pub, cryptopay.BTC, NewClient(srv.URL, "guess", nil), chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Move(cx, toPub, 5); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("signed without the token, %v", err)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	cx := context.Background()
+	priv, _ := account(t, "")
+	from, err := priv.DeriveExtendedAddr(cryptopay.BTC, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const allowed = "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"
+	s := NewServer(priv, cryptopay.BTC, Policy{MaxAmount: 100000, Allowed: []string{allowed}})
+	unspent := []cryptopay.Unspent{{Tx: strings.Repeat("11", 32), Amount: 300000}}
+	inputs := []cryptopay.SignInput{{Path: cryptopay.Path{0, 0}, Type: cryptopay.P2PKH, Amount: 300000}}
+	for _, tc := range []struct {
+		to     string
+		amount uint64
+		err    error
+	}{
+		// the change isn't spent.
+		{allowed, 90000, nil},
+		{allowed, 110000, ErrPolicy},
+		{"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", 1000, ErrPolicy},
+	} {
+		tx, err := cryptopay.NewTransactionBTC(tc.to, from, tc.amount, 5000, unspent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = s.SignBTC(cx, tx, inputs); err != tc.err {
+			t.Errorf("%s %v: %v, want %v", tc.to, tc.amount, err, tc.err)
+		}
+	}
+	// legacy sighashes don't commit to the amounts, understating them
+	// doesn't hide what's paid.
+	tx, err := cryptopay.NewTransactionBTC(allowed, from, 290000, 10000, unspent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	understated := []cryptopay.SignInput{{Path: cryptopay.Path{0, 0}, Type: cryptopay.P2PKH, Amount: 1}}
+	if _, err = s.SignBTC(cx, tx, understated); err != ErrPolicy {
+		t.Errorf("signed the understated inputs, %v", err)
+	}
+	if _, err = s.SignETH(cx, cryptopay.Path{0, 0}, &wallet.ETHTransaction{To: allowed}); err == nil {
+		t.Error("signed ethereum with a bitcoin account")
+	}
+}
+
+func TestPolicyETH(t *testing.T) {
+	cx := context.Background()
+	priv, _ := account(t, "")
+	s := NewServer(priv, cryptopay.ETH, Policy{MaxAmount: 1000000})
+	const to = "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+	for _, tx := range []*wallet.ETHTransaction{
+		{To: to, Value: 2000000, GasLimit: 21000, GasPrice: 1},
+		// 2^64 / 21000 + 1 wraps the fee to 8384 wei.
+		{To: to, Value: 1, GasLimit: 21000, GasPrice: math.MaxUint64/21000 + 1},
+		{To: to, Value: math.MaxUint64, GasLimit: 1, GasPrice: 1},
+	} {
+		if _, err := s.SignETH(cx, cryptopay.Path{0, 0}, tx); err != ErrPolicy {
+			t.Errorf("%+v: %v", *tx, err)
+		}
+	}
+}
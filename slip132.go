@@ -0,0 +1,215 @@
+package cryptopay
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"math/big"
+	"strings"
+)
+
+// AccountKey is the extended public key of an account and the addresses it
+// pays to, as told by its SLIP-132 version or its output descriptor.
+type AccountKey struct {
+	// Key has the xpub version whatever the input was.
+	Key  *Key
+	Type AddressType
+	// Multisig keys (Ypub, Zpub) are one of the cosigners of a script.
+	Multisig bool
+	Network  Network
+	// Origin is the key origin of a descriptor, like d34db33f/84'/0'/0'.
+	Origin string
+}
+
+// https://github.com/satoshilabs/slips/blob/master/slip-0132.md
+var slip132Versions = []struct {
+	pub, priv uint32
+	typ       AddressType
+	multisig  bool
+	network   Network
+}{
+	{0x0488b21e, 0x0488ade4, P2PKH, false, MainNet},  // xpub
+	{0x049d7cb2, 0x049d7878, P2SH, false, MainNet},   // ypub, P2WPKH in P2SH
+	{0x0295b43f, 0x0295b005, P2SH, true, MainNet},    // Ypub, P2WSH in P2SH
+	{0x04b24746, 0x04b2430c, P2WPKH, false, MainNet}, // zpub
+	{0x02aa7ed3, 0x02aa7a99, P2WSH, true, MainNet},   // Zpub
+	{0x043587cf, 0x04358394, P2PKH, false, TestNet},  // tpub
+	{0x044a5262, 0x044a4e28, P2SH, false, TestNet},   // upub
+	{0x024289ef, 0x024285b5, P2SH, true, TestNet},    // Upub
+	{0x045f1cf6, 0x045f18bc, P2WPKH, false, TestNet}, // vpub
+	{0x02575483, 0x02575048, P2WSH, true, TestNet},   // Vpub
+}
+
+// ParseAccountKey parses an xpub, a SLIP-132 ypub/Ypub/zpub/Zpub (or their
+// testnet and private versions) or an output descriptor, see ParseDescriptor.
+func ParseAccountKey(s string) (*AccountKey, error) {
+	if strings.Contains(s, "(") {
+		return ParseDescriptor(s)
+	}
+	if _, err := hdkeychain.NewKeyFromString(s); err != nil {
+		return nil, err
+	}
+	version := binary.BigEndian.Uint32(base58.Decode(s)[:4])
+	for _, v := range slip132Versions {
+		if version != v.pub && version != v.priv {
+			continue
+		}
+		// back to xpub/xprv so the keys neuter and print as usual.
+		x := slip132Versions[0]
+		if v.network == TestNet {
+			x = slip132Versions[5]
+		}
+		normal := x.pub
+		if version == v.priv {
+			normal = x.priv
+		}
+		k, err := ParseKey(withVersion(s, normal))
+		if err != nil {
+			return nil, err
+		}
+		return &AccountKey{Key: k, Type: v.typ, Multisig: v.multisig, Network: v.network}, nil
+	}
+	return nil, fmt.Errorf("Unknown extended key version %08x", version)
+}
+
+// SLIP132 encodes the account key k with the version of the addresses it
+// pays to, like a zpub for P2WPKH. P2SH is P2WPKH in P2SH, or P2WSH in P2SH
+// if it's multisig.
+func (k *Key) SLIP132(typ AddressType, multisig bool, network Network) (string, error) {
+	for _, v := range slip132Versions {
+		if v.typ != typ || v.multisig != multisig || v.network != network {
+			continue
+		}
+		version := v.pub
+		if (*hdkeychain.ExtendedKey)(k).IsPrivate() {
+			version = v.priv
+		}
+		return withVersion(k.Base58(), version), nil
+	}
+	return "", fmt.Errorf("No SLIP-132 version for %s", typ)
+}
+
+// withVersion replaces the version of a base58 extended key.
+func withVersion(s string, version uint32) string {
+	b := base58.Decode(s)
+	payload := b[:len(b)-4]
+	binary.BigEndian.PutUint32(payload, version)
+	first := sha256.Sum256(payload)
+	sum := sha256.Sum256(first[:])
+	return base58.Encode(append(payload, sum[:4]...))
+}
+
+// Purpose returns the purpose of the accounts paying to typ, BIP 44, 49, 84
+// and 86.
+func Purpose(typ AddressType) (uint32, error) {
+	switch typ {
+	case P2PKH:
+		return 44, nil
+	case P2SH:
+		return 49, nil
+	case P2WPKH:
+		return 84, nil
+	case P2TR:
+		return 86, nil
+	}
+	return 0, fmt.Errorf("No purpose for %s accounts", typ)
+}
+
+// DeriveAccountKey derives m/purpose'/coin'/account' where the purpose is the
+// one of typ, see Purpose.
+func (k *Key) DeriveAccountKey(private bool, typ AddressType, coinTyp CoinType, account uint32) (*Key, error) {
+	purpose, err := Purpose(typ)
+	if err != nil {
+		return nil, err
+	}
+	acctX, err := k.Derive(AccountPath(purpose, coinTyp, account))
+	if err != nil {
+		return nil, err
+	}
+	if private {
+		return acctX, nil
+	}
+	return acctX.Public()
+}
+
+// AccountPath returns m/purpose'/coin'/account'.
+func AccountPath(purpose uint32, coinTyp CoinType, account uint32) Path {
+	return Path{Hardened(purpose), Hardened(uint32(coinTyp)), Hardened(account)}
+}
+
+// Fingerprint is the first 4 bytes of the hash160 of the public key, the
+// parent fingerprint of its children and the key origin of descriptors.
+func (k *Key) Fingerprint() (uint32, error) {
+	pub, err := (*hdkeychain.ExtendedKey)(k).ECPubKey()
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(btcutil.Hash160(pub.SerializeCompressed())[:4]), nil
+}
+
+// ScriptAddress returns the bitcoin address of type typ of the key. P2SH is
+// P2WPKH in P2SH and P2TR is the BIP 86 key path spend.
+func (k *Key) ScriptAddress(typ AddressType, network Network) (string, error) {
+	pub, err := (*hdkeychain.ExtendedKey)(k).ECPubKey()
+	if err != nil {
+		return "", err
+	}
+	hash := btcutil.Hash160(pub.SerializeCompressed())
+	p := network.Params()
+	switch typ {
+	case P2PKH:
+		return base58.CheckEncode(hash, p.PubKeyHashAddrID), nil
+	case P2SH:
+		redeem := append([]byte{0x00, 0x14}, hash...)
+		return base58.CheckEncode(btcutil.Hash160(redeem), p.ScriptHashAddrID), nil
+	case P2WPKH:
+		return segwitEncode(network, 0, hash), nil
+	case P2TR:
+		x, err := taprootOutputKey(pub)
+		if err != nil {
+			return "", err
+		}
+		return segwitEncode(network, 1, x), nil
+	}
+	return "", fmt.Errorf("Unsupported %s address", typ)
+}
+
+// taprootOutputKey tweaks the internal key without a script path.
+// https://github.com/bitcoin/bips/blob/master/bip-0086.mediawiki
+func taprootOutputKey(pub *btcec.PublicKey) ([]byte, error) {
+	curve := btcec.S256()
+	px, py := pub.X, pub.Y
+	if py.Bit(0) == 1 {
+		// x only keys have an even y.
+		py = new(big.Int).Sub(curve.P, py)
+	}
+	xb := pad32(px)
+	t := new(big.Int).SetBytes(taggedHash("TapTweak", xb))
+	if t.Cmp(curve.N) >= 0 {
+		return nil, errors.New("Invalid taproot tweak")
+	}
+	tx, ty := curve.ScalarBaseMult(t.Bytes())
+	qx, _ := curve.Add(px, py, tx, ty)
+	return pad32(qx), nil
+}
+
+func pad32(n *big.Int) []byte {
+	b := n.Bytes()
+	return append(make([]byte, 32-len(b)), b...)
+}
+
+func taggedHash(tag string, msg ...[]byte) []byte {
+	th := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(th[:])
+	h.Write(th[:])
+	for _, m := range msg {
+		h.Write(m)
+	}
+	return h.Sum(nil)
+}
@@ -0,0 +1,114 @@
+package cryptopay
+
+import "testing"
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+// BIP 49, 84 and 86 test vectors.
+func TestAccountAddresses(t *testing.T) {
+	master, _, err := NewFromMnemonic(testMnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp, err := master.Fingerprint(); err != nil || fp != 0x73c5da0a {
+		t.Fatalf("master fingerprint %08x, %v", fp, err)
+	}
+	tests := []struct {
+		typ     AddressType
+		receive string
+	}{
+		{P2PKH, "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"},
+		{P2SH, "37VucYSaXLCAsxYyAPfbSi9eh4iEcbShgf"},
+		{P2WPKH, "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"},
+		{P2TR, "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"},
+	}
+	for _, tt := range tests {
+		a, err := master.AccountKey(tt.typ, BTC, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k, err := a.Key.DeriveExtendedKey(false, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr, err := k.ScriptAddress(tt.typ, MainNet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr != tt.receive {
+			t.Errorf("%s: got %s, want %s", tt.typ, addr, tt.receive)
+		}
+		if got, err := ValidateAddress(BTC, MainNet, addr); err != nil || got != tt.typ {
+			t.Errorf("%s: %s validates as %v, %v", tt.typ, addr, got, err)
+		}
+		// the descriptor brings the same account back.
+		desc, err := a.Descriptor()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ParseAccountKey(desc)
+		if err != nil {
+			t.Fatalf("%s: %v", desc, err)
+		}
+		if b.Type != tt.typ || b.Origin != a.Origin || b.Key.Base58() != a.Key.Base58() {
+			t.Errorf("%s: got %+v, want %+v", desc, b, a)
+		}
+	}
+}
+
+func TestSLIP132(t *testing.T) {
+	const zpub = "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+	master, _, err := NewFromMnemonic(testMnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := master.DeriveAccountKey(false, P2WPKH, BTC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := pub.SLIP132(P2WPKH, false, MainNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != zpub {
+		t.Fatalf("got %s, want %s", got, zpub)
+	}
+	a, err := ParseAccountKey(zpub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Type != P2WPKH || a.Multisig || a.Key.Base58() != pub.Base58() {
+		t.Fatalf("got %+v", a)
+	}
+	Zpub, err := pub.SLIP132(P2WSH, true, MainNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, err = ParseAccountKey(Zpub); err != nil || !a.Multisig || a.Type != P2WSH {
+		t.Fatalf("%s parsed as %+v, %v", Zpub, a, err)
+	}
+}
+
+func TestDescriptorChecksum(t *testing.T) {
+	// BIP 380
+	if sum, err := descriptorChecksum("raw(deadbeef)"); err != nil || sum != "89f8spxm" {
+		t.Fatalf("got %q, %v", sum, err)
+	}
+	const xpub = "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ"
+	for _, s := range []string{
+		"tr(" + xpub + "/0/*)#aaaaaaaa",
+		"tr(" + xpub + "/0/0)",
+		"wsh(multi(1," + xpub + "/0/*))",
+	} {
+		if _, err := ParseDescriptor(s); err == nil {
+			t.Errorf("%s: parsed", s)
+		}
+	}
+	a, err := ParseDescriptor("tr([73c5da0a/86'/0'/0']" + xpub + "/0/*)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Type != P2TR || a.Origin != "73c5da0a/86'/0'/0'" {
+		t.Fatalf("got %+v", a)
+	}
+}
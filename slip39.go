@@ -0,0 +1,455 @@
+package cryptopay
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"golang.org/x/crypto/pbkdf2"
+	"math/big"
+	"strings"
+)
+
+// https://github.com/satoshilabs/slips/blob/master/slip-0039.md
+
+// SLIP39Group is a group of Count shares, Threshold of them recover the
+// group share.
+type SLIP39Group struct {
+	Threshold, Count int
+}
+
+const (
+	slip39MetadataWords  = 7
+	slip39MinWords       = 20 // 128 bit secrets
+	slip39BaseIterations = 10000
+	slip39DigestIndex    = 254
+	slip39SecretIndex    = 255
+)
+
+var slip39WordIndex = func() map[string]int {
+	m := make(map[string]int)
+	for i, w := range slip39Words {
+		m[w] = i
+	}
+	return m
+}()
+
+// slip39Share is a decoded mnemonic.
+type slip39Share struct {
+	id              uint16
+	extendable      bool
+	exponent        int
+	groupIndex      int
+	groupThreshold  int
+	groupCount      int
+	memberIndex     int
+	memberThreshold int
+	value           []byte
+}
+
+func slip39Customization(extendable bool) []int {
+	s := "shamir"
+	if extendable {
+		s = "shamir_extendable"
+	}
+	var out []int
+	for i := 0; i < len(s); i++ {
+		out = append(out, int(s[i]))
+	}
+	return out
+}
+
+func slip39Polymod(values []int) int {
+	gen := [10]int{0xe0e040, 0x1c1c080, 0x3838100, 0x7070200, 0xe0e0009,
+		0x1c0c2412, 0x38086c24, 0x3090fc48, 0x21b1f890, 0x3f3f120}
+	chk := 1
+	for _, v := range values {
+		b := chk >> 20
+		chk = (chk&0xfffff)<<10 ^ v
+		for i := uint(0); i < 10; i++ {
+			if (b>>i)&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func (s *slip39Share) mnemonic() string {
+	var ext int
+	if s.extendable {
+		ext = 1
+	}
+	words := []int{
+		int(s.id) >> 5,
+		int(s.id)&31<<5 | ext<<4 | s.exponent,
+	}
+	x := s.groupIndex<<16 | (s.groupThreshold-1)<<12 | (s.groupCount-1)<<8 | s.memberIndex<<4 | (s.memberThreshold - 1)
+	words = append(words, x>>10, x&1023)
+	// the value is padded with zero bits in front to a multiple of 10.
+	v := new(big.Int).SetBytes(s.value)
+	n := (len(s.value)*8 + 9) / 10
+	for i := n - 1; i >= 0; i-- {
+		words = append(words, int(new(big.Int).Rsh(v, uint(10*i)).Int64()&1023))
+	}
+	chk := slip39Polymod(append(append(slip39Customization(s.extendable), words...), 0, 0, 0)) ^ 1
+	for i := 2; i >= 0; i-- {
+		words = append(words, chk>>uint(10*i)&1023)
+	}
+	out := make([]string, len(words))
+	for i, w := range words {
+		out[i] = slip39Words[w]
+	}
+	return strings.Join(out, " ")
+}
+
+func parseSLIP39(mnemonic string) (*slip39Share, error) {
+	fields := strings.Fields(strings.ToLower(mnemonic))
+	if len(fields) < slip39MinWords {
+		return nil, fmt.Errorf("Invalid SLIP-39 mnemonic, %v words", len(fields))
+	}
+	words := make([]int, len(fields))
+	for i, f := range fields {
+		w, ok := slip39WordIndex[f]
+		if !ok {
+			return nil, fmt.Errorf("Invalid SLIP-39 word %q", f)
+		}
+		words[i] = w
+	}
+	s := &slip39Share{
+		id:         uint16(words[0]<<5 | words[1]>>5),
+		extendable: words[1]>>4&1 == 1,
+		exponent:   words[1] & 15,
+	}
+	if slip39Polymod(append(slip39Customization(s.extendable), words...)) != 1 {
+		return nil, errors.New("Invalid SLIP-39 checksum")
+	}
+	x := words[2]<<10 | words[3]
+	s.groupIndex = x >> 16
+	s.groupThreshold = x>>12&15 + 1
+	s.groupCount = x>>8&15 + 1
+	s.memberIndex = x >> 4 & 15
+	s.memberThreshold = x&15 + 1
+	if s.groupThreshold > s.groupCount {
+		return nil, errors.New("Invalid SLIP-39 group threshold")
+	}
+	valueWords := words[4 : len(words)-3]
+	padding := 10 * len(valueWords) % 16
+	if padding > 8 {
+		return nil, errors.New("Invalid SLIP-39 mnemonic length")
+	}
+	v := new(big.Int)
+	for _, w := range valueWords {
+		v.Lsh(v, 10).Or(v, big.NewInt(int64(w)))
+	}
+	size := (10*len(valueWords) - padding) / 8
+	if v.BitLen() > size*8 {
+		return nil, errors.New("Invalid SLIP-39 padding")
+	}
+	b := v.Bytes()
+	s.value = append(make([]byte, size-len(b)), b...)
+	return s, nil
+}
+
+// GF(256) with the polynomial of AES, x^8 + x^4 + x^3 + x + 1.
+var gfExp, gfLog = func() (exp [255]int, log [256]int) {
+	poly := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = poly
+		log[poly] = i
+		poly = poly<<1 ^ poly
+		if poly&0x100 != 0 {
+			poly ^= 0x11b
+		}
+	}
+	return
+}()
+
+type shamirPoint struct {
+	x     int
+	value []byte
+}
+
+// interpolate returns the value at x of the polynomial through the points.
+func interpolate(points []shamirPoint, x int) []byte {
+	for _, p := range points {
+		if p.x == x {
+			return p.value
+		}
+	}
+	var logProd int
+	for _, p := range points {
+		logProd += gfLog[p.x^x]
+	}
+	out := make([]byte, len(points[0].value))
+	for _, p := range points {
+		basis := logProd - gfLog[p.x^x]
+		for _, o := range points {
+			basis -= gfLog[o.x^p.x]
+		}
+		basis = (basis%255 + 255) % 255
+		for i, v := range p.value {
+			if v != 0 {
+				out[i] ^= byte(gfExp[(gfLog[v]+basis)%255])
+			}
+		}
+	}
+	return out
+}
+
+func shamirDigest(random, secret []byte) []byte {
+	h := hmac.New(sha256.New, random)
+	h.Write(secret)
+	return h.Sum(nil)[:4]
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	return b, err
+}
+
+func splitSecret(threshold, count int, secret []byte) ([]shamirPoint, error) {
+	if threshold < 1 || threshold > count || count > 16 {
+		return nil, fmt.Errorf("Invalid SLIP-39 threshold %v of %v", threshold, count)
+	}
+	var out []shamirPoint
+	if threshold == 1 {
+		for i := 0; i < count; i++ {
+			out = append(out, shamirPoint{i, secret})
+		}
+		return out, nil
+	}
+	for i := 0; i < threshold-2; i++ {
+		r, err := randomBytes(len(secret))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, shamirPoint{i, r})
+	}
+	r, err := randomBytes(len(secret) - 4)
+	if err != nil {
+		return nil, err
+	}
+	base := append(append([]shamirPoint{}, out...),
+		shamirPoint{slip39DigestIndex, append(shamirDigest(r, secret), r...)},
+		shamirPoint{slip39SecretIndex, secret})
+	for i := threshold - 2; i < count; i++ {
+		out = append(out, shamirPoint{i, interpolate(base, i)})
+	}
+	return out, nil
+}
+
+func recoverSecret(threshold int, points []shamirPoint) ([]byte, error) {
+	if threshold == 1 {
+		return points[0].value, nil
+	}
+	secret := interpolate(points, slip39SecretIndex)
+	digest := interpolate(points, slip39DigestIndex)
+	if !hmac.Equal(digest[:4], shamirDigest(digest[4:], secret)) {
+		return nil, errors.New("Invalid SLIP-39 digest, the shares don't match")
+	}
+	return secret, nil
+}
+
+// slip39Feistel encrypts, or decrypts, the master secret with the
+// passphrase.
+func slip39Feistel(secret []byte, passphrase string, exponent int, id uint16, extendable, decrypt bool) []byte {
+	var salt []byte
+	if !extendable {
+		salt = []byte("shamir")
+		salt = append(salt, byte(id>>8), byte(id))
+	}
+	half := len(secret) / 2
+	l, r := secret[:half], secret[half:]
+	for round := 0; round < 4; round++ {
+		i := round
+		if decrypt {
+			i = 3 - round
+		}
+		f := pbkdf2.Key(append([]byte{byte(i)}, passphrase...), append(append([]byte{}, salt...), r...),
+			slip39BaseIterations<<uint(exponent)/4, len(r), sha256.New)
+		next := make([]byte, len(l))
+		for j := range l {
+			next[j] = l[j] ^ f[j]
+		}
+		l, r = r, next
+	}
+	return append(append([]byte{}, r...), l...)
+}
+
+func checkSLIP39Passphrase(passphrase string) error {
+	for i := 0; i < len(passphrase); i++ {
+		if passphrase[i] < 32 || passphrase[i] > 126 {
+			return errors.New("SLIP-39 passphrases are printable ASCII")
+		}
+	}
+	return nil
+}
+
+// SplitSLIP39 splits the master secret in groups of mnemonics, any
+// groupThreshold groups with the threshold of their mnemonics recover it.
+// The passphrase encrypts the secret with 10000 << exponent PBKDF2
+// iterations. Extendable shares can be added to with the same secret and
+// passphrase later.
+func SplitSLIP39(secret []byte, passphrase string, groupThreshold int, groups []SLIP39Group, exponent int, extendable bool) ([][]string, error) {
+	if len(secret) < 16 || len(secret)%2 != 0 {
+		return nil, errors.New("SLIP-39 secrets are at least 128 bits and a multiple of 16 bits")
+	}
+	if err := checkSLIP39Passphrase(passphrase); err != nil {
+		return nil, err
+	}
+	if exponent < 0 || exponent > 15 {
+		return nil, errors.New("Invalid SLIP-39 iteration exponent")
+	}
+	for _, g := range groups {
+		if g.Threshold == 1 && g.Count > 1 {
+			return nil, errors.New("Use 1-of-1 groups instead of 1-of-n")
+		}
+	}
+	idb, err := randomBytes(2)
+	if err != nil {
+		return nil, err
+	}
+	id := binary.BigEndian.Uint16(idb) & 0x7fff
+	encrypted := slip39Feistel(secret, passphrase, exponent, id, extendable, false)
+	groupShares, err := splitSecret(groupThreshold, len(groups), encrypted)
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]string, len(groups))
+	for i, g := range groups {
+		members, err := splitSecret(g.Threshold, g.Count, groupShares[i].value)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			s := &slip39Share{
+				id:              id,
+				extendable:      extendable,
+				exponent:        exponent,
+				groupIndex:      i,
+				groupThreshold:  groupThreshold,
+				groupCount:      len(groups),
+				memberIndex:     m.x,
+				memberThreshold: g.Threshold,
+				value:           m.value,
+			}
+			out[i] = append(out[i], s.mnemonic())
+		}
+	}
+	return out, nil
+}
+
+// CombineSLIP39 recovers the master secret of the mnemonics of a quorum of
+// groups.
+func CombineSLIP39(mnemonics []string, passphrase string) ([]byte, error) {
+	if len(mnemonics) == 0 {
+		return nil, errors.New("No SLIP-39 mnemonics")
+	}
+	if err := checkSLIP39Passphrase(passphrase); err != nil {
+		return nil, err
+	}
+	var first *slip39Share
+	groups := make(map[int][]*slip39Share)
+	for _, m := range mnemonics {
+		s, err := parseSLIP39(m)
+		if err != nil {
+			return nil, err
+		}
+		if first == nil {
+			first = s
+		}
+		if s.id != first.id || s.extendable != first.extendable || s.exponent != first.exponent ||
+			s.groupThreshold != first.groupThreshold || s.groupCount != first.groupCount ||
+			len(s.value) != len(first.value) {
+			return nil, errors.New("The SLIP-39 mnemonics aren't of the same secret")
+		}
+		for _, o := range groups[s.groupIndex] {
+			if o.memberThreshold != s.memberThreshold {
+				return nil, errors.New("Invalid SLIP-39 member thresholds")
+			}
+			if o.memberIndex == s.memberIndex {
+				if !bytes.Equal(o.value, s.value) {
+					return nil, errors.New("Invalid SLIP-39 mnemonics, two shares with the same index")
+				}
+				s = nil
+				break
+			}
+		}
+		if s != nil {
+			groups[s.groupIndex] = append(groups[s.groupIndex], s)
+		}
+	}
+	var groupPoints []shamirPoint
+	for index, shares := range groups {
+		threshold := shares[0].memberThreshold
+		if len(shares) < threshold {
+			continue
+		}
+		var points []shamirPoint
+		for _, s := range shares[:threshold] {
+			points = append(points, shamirPoint{s.memberIndex, s.value})
+		}
+		v, err := recoverSecret(threshold, points)
+		if err != nil {
+			return nil, err
+		}
+		groupPoints = append(groupPoints, shamirPoint{index, v})
+		if len(groupPoints) == first.groupThreshold {
+			break
+		}
+	}
+	if len(groupPoints) < first.groupThreshold {
+		return nil, fmt.Errorf("%v of %v SLIP-39 groups are complete", len(groupPoints), first.groupThreshold)
+	}
+	encrypted, err := recoverSecret(first.groupThreshold, groupPoints)
+	if err != nil {
+		return nil, err
+	}
+	return slip39Feistel(encrypted, passphrase, first.exponent, first.id, first.extendable, true), nil
+}
+
+// NewMasterSLIP39 returns a new master key of bits of entropy and its
+// extendable SLIP-39 mnemonics, see SplitSLIP39.
+func NewMasterSLIP39(passphrase string, bits, groupThreshold int, groups []SLIP39Group) (private, public *Key, mnemonics [][]string, err error) {
+	if bits != 128 && bits != 256 {
+		return nil, nil, nil, errors.New("SLIP-39 master secrets are 128 or 256 bits")
+	}
+	secret, err := randomBytes(bits / 8)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if mnemonics, err = SplitSLIP39(secret, passphrase, groupThreshold, groups, 1, true); err != nil {
+		return nil, nil, nil, err
+	}
+	private, public, err = newFromSeed(secret)
+	return
+}
+
+// NewFromSLIP39 returns the master key of the secret of the mnemonics, the
+// SLIP-39 secret is the BIP 32 seed.
+func NewFromSLIP39(mnemonics []string, passphrase string) (private, public *Key, err error) {
+	secret, err := CombineSLIP39(mnemonics, passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newFromSeed(secret)
+}
+
+func newFromSeed(seed []byte) (private, public *Key, err error) {
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, nil, err
+	}
+	neut, err := master.Neuter()
+	if err != nil {
+		return nil, nil, err
+	}
+	return (*Key)(master), (*Key)(neut), nil
+}
@@ -0,0 +1,73 @@
+package cryptopay
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// SLIP-39 test vectors, the passphrase is TREZOR.
+func TestSLIP39Vectors(t *testing.T) {
+	tests := []struct {
+		mnemonics []string
+		secret    string
+	}{
+		{[]string{"duckling enlarge academic academic agency result length solution fridge kidney coal piece deal husband erode duke ajar critical decision keyboard"},
+			"bb54aac4b89dc868ba37d9cc21b2cece"},
+		{[]string{
+			"shadow pistol academic always adequate wildlife fancy gross oasis cylinder mustang wrist rescue view short owner flip making coding armed",
+			"shadow pistol academic acid actress prayer class unknown daughter sweater depict flip twice unkind craft early superior advocate guest smoking"},
+			"b43ceb7e57a0ea8766221624d01b0864"},
+		{[]string{"theory painting academic academic armed sweater year military elder discuss acne wildlife boring employer fused large satoshi bundle carbon diagnose anatomy hamster leaves tracks paces beyond phantom capital marvel lips brave detect luck"},
+			"989baf9dcaad5b10ca33dfd8cc75e42477025dce88ae83e75a230086a0e00e92"},
+	}
+	for _, tt := range tests {
+		secret, err := CombineSLIP39(tt.mnemonics, "TREZOR")
+		if err != nil {
+			t.Fatalf("%q: %v", tt.mnemonics, err)
+		}
+		if got := hex.EncodeToString(secret); got != tt.secret {
+			t.Errorf("%q: got %s, want %s", tt.mnemonics, got, tt.secret)
+		}
+	}
+	bad := []string{
+		// invalid checksum
+		"duckling enlarge academic academic agency result length solution fridge kidney coal piece deal husband erode duke ajar critical decision kidney",
+		// one of a 2-of-3
+		"shadow pistol academic always adequate wildlife fancy gross oasis cylinder mustang wrist rescue view short owner flip making coding armed",
+	}
+	for _, m := range bad {
+		if _, err := CombineSLIP39([]string{m}, "TREZOR"); err == nil {
+			t.Errorf("%s: no error", m)
+		}
+	}
+}
+
+func TestSLIP39Groups(t *testing.T) {
+	secret, err := hex.DecodeString("bb54aac4b89dc868ba37d9cc21b2cece")
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := []SLIP39Group{{1, 1}, {2, 3}, {3, 5}}
+	for _, extendable := range []bool{false, true} {
+		shares, err := SplitSLIP39(secret, "TREZOR", 2, groups, 0, extendable)
+		if err != nil {
+			t.Fatal(err)
+		}
+		quorum := []string{shares[1][2], shares[2][4], shares[1][0], shares[2][0], shares[2][1]}
+		got, err := CombineSLIP39(quorum, "TREZOR")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(got) != hex.EncodeToString(secret) {
+			t.Fatalf("extendable %v: got %x", extendable, got)
+		}
+		// another passphrase is another secret.
+		if got, err = CombineSLIP39(quorum, ""); err != nil || hex.EncodeToString(got) == hex.EncodeToString(secret) {
+			t.Fatalf("got %x, %v", got, err)
+		}
+		// the second group misses a share.
+		if _, err = CombineSLIP39(quorum[1:], "TREZOR"); err == nil {
+			t.Fatal("recovered without a quorum")
+		}
+	}
+}
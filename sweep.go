@@ -0,0 +1,156 @@
+package cryptopay
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"strings"
+)
+
+// NewKeyFromPrivate wraps a loose private key, like the ones of paper
+// wallets, in a Key without a chain code so it signs and pays like the
+// derived ones. Its children are meaningless.
+func NewKeyFromPrivate(priv []byte) (*Key, error) {
+	if len(priv) != 32 {
+		return nil, errors.New("Invalid private key length")
+	}
+	k := hdkeychain.NewExtendedKey(chaincfg.MainNetParams.HDPrivateKeyID[:], priv,
+		make([]byte, 32), make([]byte, 4), 0, 0, true)
+	if _, err := k.ECPrivKey(); err != nil {
+		return nil, err
+	}
+	return (*Key)(k), nil
+}
+
+// ParseHexKey parses a hex ethereum private key, with or without 0x.
+func ParseHexKey(s string) (*Key, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(s), "0x"))
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyFromPrivate(b)
+}
+
+// KeyAddress is an address a loose key pays to.
+type KeyAddress struct {
+	Address string
+	Type    AddressType
+	// Compressed tells the public key of P2PKH addresses, the others are
+	// always compressed.
+	Compressed bool
+}
+
+// KeyAddresses returns the bitcoin addresses of every type the key of wif
+// controls, whatever the compression of the WIF: P2PKH of both public keys,
+// P2SH-P2WPKH, P2WPKH and P2TR.
+func KeyAddresses(wif string) ([]KeyAddress, error) {
+	w, err := btcutil.DecodeWIF(wif)
+	if err != nil {
+		return nil, err
+	}
+	k, err := NewKeyFromPrivate(pad32(w.PrivKey.D))
+	if err != nil {
+		return nil, err
+	}
+	uncompressed := btcutil.Hash160(w.PrivKey.PubKey().SerializeUncompressed())
+	out := []KeyAddress{{
+		Address: base58.CheckEncode(uncompressed, chaincfg.MainNetParams.PubKeyHashAddrID),
+		Type:    P2PKH,
+	}}
+	for _, typ := range []AddressType{P2PKH, P2SH, P2WPKH, P2TR} {
+		addr, err := k.ScriptAddress(typ, MainNet)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, KeyAddress{Address: addr, Type: typ, Compressed: true})
+	}
+	return out, nil
+}
+
+// Spend is an output paid to an address of a loose key, see KeyAddresses.
+type Spend struct {
+	Unspent
+	KeyAddress
+}
+
+// MakeSweepBTC spends every output with the key of wif, paying amount to
+// the address to and the rest, fee, to the miners. Unlike
+// MakeTransactionBTC it signs the segwit outputs too, P2TR isn't supported.
+func MakeSweepBTC(wif, to string, amount, fee uint64, spends []Spend) ([]byte, error) {
+	w, err := btcutil.DecodeWIF(wif)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = ValidateAddress(BTC, MainNet, to); err != nil {
+		return nil, err
+	}
+	dest, err := btcutil.DecodeAddress(to, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, err
+	}
+	pkScript, err := txscript.PayToAddrScript(dest)
+	if err != nil {
+		return nil, err
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	var total uint64
+	for _, s := range spends {
+		hash, err := chainhash.NewHashFromStr(s.Tx)
+		if err != nil {
+			return nil, err
+		}
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(hash, s.N), nil, nil))
+		total += s.Amount
+	}
+	if len(spends) == 0 || total != amount+fee {
+		return nil, fmt.Errorf("A sweep spends all of %v, not %v and the fee %v", total, amount, fee)
+	}
+	tx.AddTxOut(wire.NewTxOut(int64(amount), pkScript))
+	hashes := txscript.NewTxSigHashes(tx)
+	for i, s := range spends {
+		if err = signSweep(tx, hashes, i, s, w.PrivKey); err != nil {
+			return nil, fmt.Errorf("%s: %v", s.Address, err)
+		}
+	}
+	var buf bytes.Buffer
+	if err = tx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func signSweep(tx *wire.MsgTx, hashes *txscript.TxSigHashes, i int, s Spend, priv *btcec.PrivateKey) error {
+	pub := serializePub(priv.PubKey(), s.Type != P2PKH || s.Compressed)
+	program := append([]byte{0x00, 0x14}, btcutil.Hash160(pub)...)
+	switch s.Type {
+	case P2PKH:
+		prev, err := txscript.NewScriptBuilder().AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).
+			AddData(btcutil.Hash160(pub)).AddOp(txscript.OP_EQUALVERIFY).AddOp(txscript.OP_CHECKSIG).Script()
+		if err != nil {
+			return err
+		}
+		tx.TxIn[i].SignatureScript, err = txscript.SignatureScript(tx, i, prev, txscript.SigHashAll, priv, s.Compressed)
+		return err
+	case P2SH, P2WPKH:
+		// BIP 143 makes the P2PKH script code of the program.
+		witness, err := txscript.WitnessSignature(tx, hashes, i, int64(s.Amount), program, txscript.SigHashAll, priv, true)
+		if err != nil {
+			return err
+		}
+		tx.TxIn[i].Witness = witness
+		if s.Type == P2SH {
+			tx.TxIn[i].SignatureScript, err = txscript.NewScriptBuilder().AddData(program).Script()
+		}
+		return err
+	}
+	return fmt.Errorf("Can't sign %s outputs", s.Type)
+}
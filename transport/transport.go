@@ -0,0 +1,209 @@
+// Package transport is the http.RoundTripper shared by the backend clients.
+// It retries transient failures with exponential backoff and jitter, limits
+// the request rate per host and caps the number of requests in flight.
+package transport
+
+import (
+	"context"
+	"errors"
+	log "github.com/golang/glog"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type Config struct {
+	// Number of retries after the first attempt.
+	MaxRetries int
+	// Backoff before the first retry. It doubles on every retry up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Minimum time between two requests to the same host, 0 is unlimited.
+	HostInterval time.Duration
+	// Maximum number of requests in flight over all hosts, 0 is unlimited.
+	MaxInFlight int
+}
+
+var DefaultConfig = Config{
+	MaxRetries:   4,
+	MinBackoff:   500 * time.Millisecond,
+	MaxBackoff:   15 * time.Second,
+	HostInterval: 100 * time.Millisecond,
+	MaxInFlight:  32,
+}
+
+// Default wraps http.DefaultTransport. Clients built by Client over the
+// default transport share its limits.
+var Default = New(http.DefaultTransport, DefaultConfig)
+
+type Transport struct {
+	base  http.RoundTripper
+	cfg   Config
+	sem   chan struct{}
+	mu    sync.Mutex
+	hosts map[string]time.Time // next free slot per host
+}
+
+func New(base http.RoundTripper, cfg Config) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t := &Transport{base: base, cfg: cfg, hosts: make(map[string]time.Time)}
+	if cfg.MaxInFlight > 0 {
+		t.sem = make(chan struct{}, cfg.MaxInFlight)
+	}
+	return t
+}
+
+// Client returns a copy of cl whose transport retries and rate limits. A
+// client already using a Transport is returned as is.
+func Client(cl *http.Client) *http.Client {
+	if cl == nil {
+		cl = http.DefaultClient
+	}
+	switch cl.Transport.(type) {
+	case *Transport:
+		return cl
+	}
+	c := *cl
+	if cl.Transport == nil || cl.Transport == http.DefaultTransport {
+		c.Transport = Default
+	} else {
+		c.Transport = New(cl.Transport, DefaultConfig)
+	}
+	return &c
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cx := req.Context()
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, errors.New("transport: request body can't be replayed")
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			// a RoundTripper must not modify the caller's request.
+			r = new(http.Request)
+			*r = *req
+			r.Body = body
+		}
+		rsp, err := t.roundTrip(cx, r)
+		if !Retryable(rsp, err) || attempt >= t.cfg.MaxRetries || cx.Err() != nil {
+			return rsp, err
+		}
+		d := t.backoff(attempt, rsp)
+		if rsp != nil {
+			log.Errorf("%s %s: status %v, retry in %s", req.Method, req.URL.Host, rsp.StatusCode, d)
+			rsp.Body.Close()
+		} else {
+			log.Errorf("%s %s: %v, retry in %s", req.Method, req.URL.Host, err, d)
+		}
+		if err := sleep(cx, d); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (t *Transport) roundTrip(cx context.Context, req *http.Request) (*http.Response, error) {
+	if t.sem != nil {
+		select {
+		case t.sem <- struct{}{}:
+			defer func() { <-t.sem }()
+		case <-cx.Done():
+			return nil, cx.Err()
+		}
+	}
+	if err := sleep(cx, t.reserve(req.URL.Host)); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// reserve returns how long to wait for the next slot of host.
+func (t *Transport) reserve(host string) time.Duration {
+	if t.cfg.HostInterval <= 0 {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	at := t.hosts[host]
+	if at.Before(now) {
+		at = now
+	}
+	t.hosts[host] = at.Add(t.cfg.HostInterval)
+	return at.Sub(now)
+}
+
+// backoff honours Retry-After, up to MaxBackoff so a server can't stall the
+// request, and otherwise picks a random duration between half and the whole
+// of the exponential backoff.
+func (t *Transport) backoff(attempt int, rsp *http.Response) time.Duration {
+	if rsp != nil {
+		if sec, err := strconv.Atoi(rsp.Header.Get("Retry-After")); err == nil && sec >= 0 {
+			d := time.Duration(sec) * time.Second
+			if d > t.cfg.MaxBackoff || d < 0 {
+				d = t.cfg.MaxBackoff
+			}
+			return d
+		}
+	}
+	d := t.cfg.MinBackoff << uint(attempt)
+	if d > t.cfg.MaxBackoff || d <= 0 {
+		d = t.cfg.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Retryable reports whether a request that ended with rsp or err may succeed
+// if sent again. Only timeouts, temporary network errors, connection resets
+// and connections closed early are retried, TLS, DNS and URL errors and
+// cancelled requests are fatal. So are 4xx answers other than 408 and 429
+// and 500, blockchain.info answers 500 for an address without outputs.
+func Retryable(rsp *http.Response, err error) bool {
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+			return true
+		}
+		var ne net.Error
+		return errors.As(err, &ne) && (ne.Timeout() || ne.Temporary())
+	}
+	switch rsp.StatusCode {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func sleep(cx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return cx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-cx.Done():
+		return cx.Err()
+	}
+}
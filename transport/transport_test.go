@@ -0,0 +1,130 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+var testConfig = Config{MaxRetries: 3, MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+func TestRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		err    error
+		want   bool
+	}{
+		{http.StatusOK, nil, false},
+		{http.StatusNotFound, nil, false},
+		{http.StatusRequestTimeout, nil, true},
+		{http.StatusTooManyRequests, nil, true},
+		// blockchain.info answers 500 for an address without outputs.
+		{http.StatusInternalServerError, nil, false},
+		{http.StatusBadGateway, nil, true},
+		{http.StatusServiceUnavailable, nil, true},
+		{http.StatusGatewayTimeout, nil, true},
+		{0, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{0, &net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}, true},
+		{0, io.EOF, true},
+		{0, fmt.Errorf("reading the answer: %w", io.ErrUnexpectedEOF), true},
+		{0, &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}, false},
+		{0, x509.UnknownAuthorityError{}, false},
+		{0, errors.New("unsupported protocol scheme"), false},
+		{0, context.Canceled, false},
+		{0, &url.Error{Op: "Get", URL: "https://example.com", Err: context.DeadlineExceeded}, false},
+	} {
+		var rsp *http.Response
+		if tc.err == nil {
+			rsp = &http.Response{StatusCode: tc.status}
+		}
+		if got := Retryable(rsp, tc.err); got != tc.want {
+			t.Errorf("%v %v: retryable %v", tc.status, tc.err, got)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tr := New(nil, Config{MinBackoff: time.Second, MaxBackoff: 4 * time.Second})
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		if d := tr.backoff(attempt, nil); d < max/2 || d > max {
+			t.Errorf("attempt %v: backoff %v, want %v to %v", attempt, d, max/2, max)
+		}
+	}
+	for _, tc := range []struct {
+		header string
+		want   time.Duration
+	}{
+		{"2", 2 * time.Second},
+		{"0", 0},
+		// capped, the server can't stall the request for hours.
+		{"36000", 4 * time.Second},
+	} {
+		rsp := &http.Response{Header: http.Header{"Retry-After": {tc.header}}}
+		if d := tr.backoff(0, rsp); d != tc.want {
+			t.Errorf("Retry-After %s: backoff %v, want %v", tc.header, d, tc.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if len(bodies) < 3 {
+			w.Header().Set("Retry-After", "36000")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	cl := &http.Client{Transport: New(nil, testConfig)}
+	rsp, err := cl.Post(srv.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK || len(bodies) != 3 {
+		t.Fatalf("status %v after %v attempts", rsp.StatusCode, len(bodies))
+	}
+	for i, b := range bodies {
+		if b != "payload" {
+			t.Errorf("attempt %v: body %q", i, b)
+		}
+	}
+
+	// out of retries, the last answer is returned.
+	bodies = nil
+	cl = &http.Client{Transport: New(nil, Config{MaxRetries: 1, MaxBackoff: time.Millisecond})}
+	if rsp, err = cl.Get(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusServiceUnavailable || len(bodies) != 2 {
+		t.Fatalf("status %v after %v attempts", rsp.StatusCode, len(bodies))
+	}
+
+	// a body without GetBody can't be sent twice.
+	bodies = nil
+	req, err := http.NewRequest("POST", srv.URL, ioutil.NopCloser(bytes.NewBufferString("payload")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = New(nil, testConfig).RoundTrip(req); err == nil || len(bodies) != 1 {
+		t.Fatalf("replayed the body, %v attempts, %v", len(bodies), err)
+	}
+}
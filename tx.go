@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/btcsuite/btcutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/rlp"
 	log "github.com/golang/glog"
 	"math/big"
@@ -21,10 +22,16 @@ const GasPrice uint64 = 51 // 51 GWEI
 const GweiToWei = 1000000000
 
 func EstimateFee(c CoinType, tx []byte) (uint64, error) {
+	return EstimateFeeSize(c, len(tx))
+}
+
+// EstimateFeeSize is EstimateFee of a transaction of size bytes, like the
+// estimated size of a transaction the cosigners of a multisig will sign.
+func EstimateFeeSize(c CoinType, size int) (uint64, error) {
 	switch c {
 	case BTC:
 		const fee = 130 // 1000 // satoshi per byte
-		return uint64(fee * len(tx)), nil
+		return uint64(fee * size), nil
 	case ETH:
 		return GasLimit * (GasPrice * GweiToWei), nil // Fee should be returned in Wei ?
 	}
@@ -41,6 +48,25 @@ func EncodeRawTX(coin CoinType, raw []byte) string {
 	return "invalid coin"
 }
 
+// TXID returns the transaction hash of a raw transaction encoded by EncodeRawTX.
+func TXID(coin CoinType, raw string) (string, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(raw, "0x"))
+	if err != nil {
+		return "", err
+	}
+	switch coin {
+	case BTC, BCH:
+		tx, err := btcutil.NewTxFromBytes(b)
+		if err != nil {
+			return "", err
+		}
+		return tx.Hash().String(), nil
+	case ETH:
+		return fmt.Sprintf("0x%x", crypto.Keccak256(b)), nil
+	}
+	return "", errors.New("invalid coin")
+}
+
 type Transaction struct {
 	Amount uint64
 	To     string
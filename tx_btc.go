@@ -2,6 +2,7 @@ package cryptopay
 
 import (
 	"encoding/hex"
+	"fmt"
 	"github.com/bitgoin/address"
 	"github.com/bitgoin/tx"
 	log "github.com/golang/glog"
@@ -13,10 +14,22 @@ type Unspent struct {
 	Amount        uint64
 	Confirmations int
 	Script        string
+	Coinbase      bool // spendable after CoinbaseMaturity confirmations
 }
 
+// The confirmations a coinbase output needs to be spent.
+const CoinbaseMaturity = 100
+
 // receives 'from' wiff encoded private key. and the BTC address to send.
 func MakeTransactionBTC(from, to string, amount, fee uint64, unspent []Unspent) ([]byte, error) {
+	typ, err := ValidateAddress(BTC, MainNet, to)
+	if err != nil {
+		return nil, err
+	}
+	// bitgoin only builds pay to pubkey hash outputs.
+	if typ != P2PKH {
+		return nil, fmt.Errorf("Unsupported %s address %s", typ, to)
+	}
 	coins, err := ToUTXO(unspent, from)
 	if err != nil {
 		log.Error(err)
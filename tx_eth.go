@@ -11,6 +11,10 @@ import (
 
 func MakeTransactionETH(fromKey *Key, to string, nonce uint64, value uint64, gasLimit, gasPrice uint64) ([]byte, error) {
 	t := time.Now()
+	// HexToAddress takes anything.
+	if _, err := ValidateAddress(ETH, MainNet, to); err != nil {
+		return nil, err
+	}
 	ecdsaKey, err := fromKey.ToECDSAPrivate()
 	if err != nil {
 		return nil, err
@@ -0,0 +1,276 @@
+package cryptopay
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PaymentURI is a BIP21 bitcoin: or an EIP-681 ethereum: payment request.
+// https://github.com/bitcoin/bips/blob/master/bip-0021.mediawiki
+// https://eips.ethereum.org/EIPS/eip-681
+type PaymentURI struct {
+	Coin    CoinType
+	Network Network
+	// Address is the recipient, also of ERC-20 transfers.
+	Address string
+	// Amount in satoshi or wei, or in the units of the token. 0 is any.
+	Amount uint64
+	// Label and Message are bitcoin only.
+	Label   string
+	Message string
+	// Token is the ERC-20 contract of a transfer.
+	Token string
+	// Params are the other parameters, like the lightning invoice of
+	// bitcoin or the gas of ethereum, passed as they are.
+	Params url.Values
+}
+
+var uriSchemes = map[CoinType]string{BTC: "bitcoin", BCH: "bitcoincash", ETH: "ethereum"}
+
+// PaymentURI returns the payment request of amount to the address of k.
+func (k *Key) PaymentURI(coinTyp CoinType, amount uint64) (*PaymentURI, error) {
+	addr, err := k.PayAddress(coinTyp)
+	if err != nil {
+		return nil, err
+	}
+	return &PaymentURI{Coin: coinTyp, Address: addr, Amount: amount}, nil
+}
+
+func (u *PaymentURI) String() string {
+	scheme, ok := uriSchemes[u.Coin]
+	if !ok {
+		return "invalid coin"
+	}
+	var q []string
+	add := func(k, v string) {
+		if v != "" {
+			q = append(q, k+"="+strings.Replace(url.QueryEscape(v), "+", "%20", -1))
+		}
+	}
+	s := scheme + ":"
+	if u.Coin == ETH {
+		target := u.Address
+		if u.Token != "" {
+			target = u.Token
+		}
+		s += target
+		if id := u.Network.ChainID(); id != 1 {
+			s += "@" + strconv.FormatUint(id, 10)
+		}
+		if u.Token != "" {
+			s += "/transfer"
+			add("address", u.Address)
+			if u.Amount > 0 {
+				add("uint256", strconv.FormatUint(u.Amount, 10))
+			}
+		} else if u.Amount > 0 {
+			add("value", strconv.FormatUint(u.Amount, 10))
+		}
+	} else {
+		s += u.Address
+		if u.Amount > 0 {
+			add("amount", formatUnits(u.Amount, 8))
+		}
+		add("label", u.Label)
+		add("message", u.Message)
+	}
+	var keys []string
+	for k := range u.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range u.Params[k] {
+			add(k, v)
+		}
+	}
+	if len(q) > 0 {
+		s += "?" + strings.Join(q, "&")
+	}
+	return s
+}
+
+// ParsePaymentURI parses a payment request of coin on network. The address
+// must be valid on the network and the amounts are returned in satoshi or
+// wei.
+func ParsePaymentURI(s string, coinTyp CoinType, network Network) (*PaymentURI, error) {
+	scheme, ok := uriSchemes[coinTyp]
+	if !ok {
+		return nil, errors.New("Invalid coin type")
+	}
+	i := strings.Index(s, ":")
+	if i < 0 || !strings.EqualFold(s[:i], scheme) {
+		return nil, fmt.Errorf("Invalid URI, want a %s: URI", scheme)
+	}
+	rest := s[i+1:]
+	var query string
+	if i := strings.Index(rest, "?"); i >= 0 {
+		rest, query = rest[:i], rest[i+1:]
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	u := &PaymentURI{Coin: coinTyp, Network: network, Params: make(url.Values)}
+	if coinTyp == ETH {
+		err = u.parseETH(rest, params)
+	} else {
+		err = u.parseBTC(rest, params)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range []string{u.Address, u.Token} {
+		if addr == "" {
+			continue
+		}
+		if _, err = ValidateAddress(coinTyp, network, addr); err != nil {
+			return nil, err
+		}
+	}
+	if len(u.Params) == 0 {
+		u.Params = nil
+	}
+	return u, nil
+}
+
+func (u *PaymentURI) parseBTC(addr string, params url.Values) error {
+	if addr == "" {
+		return errors.New("Invalid URI, no address")
+	}
+	u.Address = addr
+	for k, v := range params {
+		switch k {
+		case "amount":
+			amount, err := parseUnits(v[0], 8)
+			if err != nil {
+				return err
+			}
+			u.Amount = amount
+		case "label":
+			u.Label = v[0]
+		case "message":
+			u.Message = v[0]
+		default:
+			// BIP21: the required parameters we don't know make the URI
+			// invalid.
+			if strings.HasPrefix(k, "req-") {
+				return fmt.Errorf("Unsupported required parameter %q", k)
+			}
+			u.Params[k] = v
+		}
+	}
+	return nil
+}
+
+func (u *PaymentURI) parseETH(path string, params url.Values) error {
+	path = strings.TrimPrefix(path, "pay-")
+	var function string
+	if i := strings.Index(path, "/"); i >= 0 {
+		path, function = path[:i], path[i+1:]
+	}
+	if i := strings.Index(path, "@"); i >= 0 {
+		id, err := strconv.ParseUint(path[i+1:], 10, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid chain id %q", path[i+1:])
+		}
+		if id != u.Network.ChainID() {
+			return fmt.Errorf("Chain id %v is not %s", id, u.Network)
+		}
+		path = path[:i]
+	}
+	if path == "" {
+		return errors.New("Invalid URI, no address")
+	}
+	switch function {
+	case "":
+		u.Address = path
+		for k, v := range params {
+			if k != "value" {
+				u.Params[k] = v
+				continue
+			}
+			amount, err := parseNumber(v[0])
+			if err != nil {
+				return err
+			}
+			u.Amount = amount
+		}
+	case "transfer":
+		// ERC-20
+		u.Token = path
+		for k, v := range params {
+			switch k {
+			case "address":
+				u.Address = v[0]
+			case "uint256":
+				amount, err := parseNumber(v[0])
+				if err != nil {
+					return err
+				}
+				u.Amount = amount
+			default:
+				u.Params[k] = v
+			}
+		}
+		if u.Address == "" {
+			return errors.New("Invalid transfer, no address")
+		}
+	default:
+		return fmt.Errorf("Unsupported function %q", function)
+	}
+	return nil
+}
+
+// formatUnits formats amount as a decimal number of units of 10^decimals.
+func formatUnits(amount uint64, decimals int) string {
+	s := strconv.FormatUint(amount, 10)
+	if len(s) <= decimals {
+		s = strings.Repeat("0", decimals-len(s)+1) + s
+	}
+	s = s[:len(s)-decimals] + "." + s[len(s)-decimals:]
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+// parseUnits parses a decimal number of units of 10^decimals.
+func parseUnits(s string, decimals int) (uint64, error) {
+	if s == "" || strings.ContainsAny(s, "eE+-/") {
+		return 0, fmt.Errorf("Invalid amount %q", s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("Invalid amount %q", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)))
+	if !r.IsInt() {
+		return 0, fmt.Errorf("Amount %q has more than %v decimals", s, decimals)
+	}
+	if !r.Num().IsUint64() {
+		return 0, fmt.Errorf("Amount %q is too large", s)
+	}
+	return r.Num().Uint64(), nil
+}
+
+// parseNumber parses an EIP-681 number, like 2.014e18, which must be a whole
+// number of base units.
+func parseNumber(s string) (uint64, error) {
+	if s == "" || strings.ContainsAny(s, "-/") {
+		return 0, fmt.Errorf("Invalid number %q", s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("Invalid number %q", s)
+	}
+	if !r.IsInt() {
+		return 0, fmt.Errorf("Number %q is not whole", s)
+	}
+	if !r.Num().IsUint64() {
+		return 0, fmt.Errorf("Number %q is too large", s)
+	}
+	return r.Num().Uint64(), nil
+}
@@ -0,0 +1,87 @@
+package cryptopay
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParsePaymentURI(t *testing.T) {
+	tests := []struct {
+		uri     string
+		coin    CoinType
+		network Network
+		want    *PaymentURI
+	}{
+		{
+			uri:  "bitcoin:1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2?amount=50&label=Luke-Jr&message=Donation%20for%20project%20xyz",
+			coin: BTC,
+			want: &PaymentURI{Coin: BTC, Address: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+				Amount: 5000000000, Label: "Luke-Jr", Message: "Donation for project xyz"},
+		},
+		{
+			uri:  "bitcoin:1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA?amount=0.0001&lightning=lnbc10u1p3",
+			coin: BTC,
+			want: &PaymentURI{Coin: BTC, Address: "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA",
+				Amount: 10000, Params: url.Values{"lightning": {"lnbc10u1p3"}}},
+		},
+		{
+			uri:     "bitcoin:mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn?amount=1.5",
+			coin:    BTC,
+			network: TestNet,
+			want: &PaymentURI{Coin: BTC, Network: TestNet,
+				Address: "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", Amount: 150000000},
+		},
+		{
+			uri:  "ethereum:0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359?value=2.014e18",
+			coin: ETH,
+			want: &PaymentURI{Coin: ETH, Address: "0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359",
+				Amount: 2014000000000000000},
+		},
+		{
+			uri:     "ethereum:0x89205a3a3b2a69de6dbf7f01ed13b2108b2c43e7@3/transfer?address=0x8e23ee67d1332ad560396262c48ffbb01f93d052&uint256=1",
+			coin:    ETH,
+			network: TestNet,
+			want: &PaymentURI{Coin: ETH, Network: TestNet, Amount: 1,
+				Address: "0x8e23ee67d1332ad560396262c48ffbb01f93d052",
+				Token:   "0x89205a3a3b2a69de6dbf7f01ed13b2108b2c43e7"},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParsePaymentURI(tt.uri, tt.coin, tt.network)
+		if err != nil {
+			t.Errorf("%s: %v", tt.uri, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.uri, got, tt.want)
+		}
+		// what we generate parses back.
+		again, err := ParsePaymentURI(got.String(), tt.coin, tt.network)
+		if err != nil || !reflect.DeepEqual(again, got) {
+			t.Errorf("%s: round trip %s got %+v, %v", tt.uri, got, again, err)
+		}
+	}
+}
+
+func TestParsePaymentURIInvalid(t *testing.T) {
+	tests := []struct {
+		uri     string
+		coin    CoinType
+		network Network
+	}{
+		{"bitcoin:1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA?req-somethingyoudontunderstand=50", BTC, MainNet},
+		{"bitcoin:1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA?amount=0.000000001", BTC, MainNet},
+		{"bitcoin:1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA?amount=1e3", BTC, MainNet},
+		{"bitcoin:mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", BTC, MainNet},
+		{"bitcoin:1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA", ETH, MainNet},
+		{"ethereum:0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359@3?value=1", ETH, MainNet},
+		{"ethereum:0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359?value=1.5", ETH, MainNet},
+		{"ethereum:0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359/approve?address=0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359", ETH, MainNet},
+	}
+	for _, tt := range tests {
+		if u, err := ParsePaymentURI(tt.uri, tt.coin, tt.network); err == nil {
+			t.Errorf("%s: got %+v, want an error", tt.uri, u)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	log "github.com/golang/glog"
+	"github.com/winteraz/cryptopay"
+	"sync"
+	"time"
+)
+
+// Heighter is implemented by the unspenders which know the chain tip.
+type Heighter interface {
+	BlockHeight(cx context.Context) (uint64, error)
+}
+
+// Cache is an Unspender decorator. An address seen with transactions stays
+// used forever while an unused address is asked again after the ttl. Unspent
+// outputs are kept until the next block when the unspender is a Heighter,
+// whose height is asked at most every ttl, and for the ttl otherwise.
+// CountTransactions is never cached as it's the nonce.
+type Cache struct {
+	unspender Unspender
+	ttl       time.Duration
+	now       func() time.Time
+
+	mu      sync.Mutex
+	used    map[string]bool
+	unused  map[string]time.Time // address -> expiry
+	unspent map[string]unspentEntry
+	height  uint64
+	checked time.Time // when the height was asked
+}
+
+type unspentEntry struct {
+	height  uint64
+	expires time.Time
+	una     []cryptopay.Unspent
+}
+
+// NewCache returns the Cache of unspender. It's also a Heighter or a
+// TxGetter, forwarding to unspender, only if unspender is.
+func NewCache(unspender Unspender, ttl time.Duration) Requester {
+	c := newCache(unspender, ttl)
+	h, isHeighter := unspender.(Heighter)
+	g, isTxGetter := unspender.(TxGetter)
+	switch {
+	case isHeighter && isTxGetter:
+		return struct {
+			*Cache
+			Heighter
+			TxGetter
+		}{c, h, g}
+	case isHeighter:
+		return struct {
+			*Cache
+			Heighter
+		}{c, h}
+	case isTxGetter:
+		return struct {
+			*Cache
+			TxGetter
+		}{c, g}
+	}
+	return c
+}
+
+func newCache(unspender Unspender, ttl time.Duration) *Cache {
+	return &Cache{
+		unspender: unspender,
+		ttl:       ttl,
+		now:       time.Now,
+		used:      make(map[string]bool),
+		unused:    make(map[string]time.Time),
+		unspent:   make(map[string]unspentEntry),
+	}
+}
+
+func (c *Cache) HasTransactions(cx context.Context, addr ...string) (map[string]bool, error) {
+	m := make(map[string]bool)
+	var miss []string
+	now := c.now()
+	c.mu.Lock()
+	for _, a := range addr {
+		if c.used[a] {
+			m[a] = true
+			continue
+		}
+		if exp, ok := c.unused[a]; ok && now.Before(exp) {
+			m[a] = false
+			continue
+		}
+		miss = append(miss, a)
+	}
+	c.mu.Unlock()
+	if len(miss) == 0 {
+		return m, nil
+	}
+	rm, err := c.unspender.HasTransactions(cx, miss...)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, a := range miss {
+		ok := rm[a]
+		m[a] = ok
+		if ok {
+			c.used[a] = true
+			delete(c.unused, a)
+			continue
+		}
+		c.unused[a] = now.Add(c.ttl)
+	}
+	return m, nil
+}
+
+func (c *Cache) Unspent(cx context.Context, addr ...string) (map[string][]cryptopay.Unspent, error) {
+	var height uint64
+	h, byHeight := c.unspender.(Heighter)
+	if byHeight {
+		var err error
+		height, err = c.tip(cx, h)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+	}
+	m := make(map[string][]cryptopay.Unspent)
+	var miss []string
+	now := c.now()
+	c.mu.Lock()
+	for _, a := range addr {
+		e, ok := c.unspent[a]
+		if ok && ((byHeight && e.height == height) || (!byHeight && now.Before(e.expires))) {
+			if len(e.una) > 0 {
+				m[a] = e.una
+			}
+			continue
+		}
+		miss = append(miss, a)
+	}
+	c.mu.Unlock()
+	if len(miss) == 0 {
+		return m, nil
+	}
+	rm, err := c.unspender.Unspent(cx, miss...)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, a := range miss {
+		una := rm[a]
+		c.unspent[a] = unspentEntry{height: height, expires: now.Add(c.ttl), una: una}
+		if len(una) > 0 {
+			m[a] = una
+		}
+	}
+	return m, nil
+}
+
+func (c *Cache) CountTransactions(cx context.Context, addr ...string) (map[string]uint64, error) {
+	return c.unspender.CountTransactions(cx, addr...)
+}
+
+// tip returns the height of h, asked again after the ttl.
+func (c *Cache) tip(cx context.Context, h Heighter) (uint64, error) {
+	now := c.now()
+	c.mu.Lock()
+	height, fresh := c.height, now.Before(c.checked.Add(c.ttl))
+	c.mu.Unlock()
+	if fresh {
+		return height, nil
+	}
+	height, err := h.BlockHeight(cx)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	c.height, c.checked = height, now
+	c.mu.Unlock()
+	return height, nil
+}
+
+// Invalidate drops the unspent outputs and the unused state of the addresses
+// or of every address, and the height, when none is given. Call it after a
+// broadcast.
+func (c *Cache) Invalidate(addr ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(addr) == 0 {
+		c.unused = make(map[string]time.Time)
+		c.unspent = make(map[string]unspentEntry)
+		c.checked = time.Time{}
+		return
+	}
+	for _, a := range addr {
+		delete(c.unused, a)
+		delete(c.unspent, a)
+	}
+}
+
+// Broadcast is forwarded to the unspender if it's a Broadcaster. Since the
+// spent addresses aren't known from the raw transactions the whole cache is
+// invalidated.
+func (c *Cache) Broadcast(cx context.Context, txa ...string) (map[string]error, error) {
+	b, ok := c.unspender.(Broadcaster)
+	if !ok {
+		return nil, errors.New("unspender can't broadcast")
+	}
+	defer c.Invalidate()
+	return b.Broadcast(cx, txa...)
+}
@@ -0,0 +1,159 @@
+package wallet
+
+import (
+	"context"
+	"github.com/winteraz/cryptopay"
+	"github.com/winteraz/cryptopay/chaintest"
+	"testing"
+	"time"
+)
+
+// counter counts the requests reaching the chain.
+type counter struct {
+	*chaintest.Chain
+	calls map[string]int
+}
+
+func (c *counter) HasTransactions(cx context.Context, addr ...string) (map[string]bool, error) {
+	c.calls["HasTransactions"]++
+	return c.Chain.HasTransactions(cx, addr...)
+}
+
+func (c *counter) Unspent(cx context.Context, addr ...string) (map[string][]cryptopay.Unspent, error) {
+	c.calls["Unspent"]++
+	return c.Chain.Unspent(cx, addr...)
+}
+
+func (c *counter) BlockHeight(cx context.Context) (uint64, error) {
+	c.calls["BlockHeight"]++
+	return c.Chain.BlockHeight(cx)
+}
+
+// noHeight hides the height of the chain.
+type noHeight struct {
+	Unspender
+}
+
+func newCounter(t *testing.T) *counter {
+	chain, err := chaintest.New(cryptopay.BTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &counter{Chain: chain, calls: make(map[string]int)}
+}
+
+func TestCacheUnused(t *testing.T) {
+	cx := context.Background()
+	const addr = "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"
+	chain := newCounter(t)
+	c := newCache(chain, time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	for i := 0; i < 2; i++ {
+		if m, err := c.HasTransactions(cx, addr); err != nil || m[addr] {
+			t.Fatalf("used %v, %v", m[addr], err)
+		}
+	}
+	if chain.calls["HasTransactions"] != 1 {
+		t.Fatalf("%v requests for an unused address", chain.calls["HasTransactions"])
+	}
+	if _, err := chain.Fund(addr, 1000); err != nil {
+		t.Fatal(err)
+	}
+	// still unused until the ttl.
+	if m, _ := c.HasTransactions(cx, addr); m[addr] {
+		t.Fatal("the unused address expired early")
+	}
+	now = now.Add(2 * time.Minute)
+	for i := 0; i < 2; i++ {
+		if m, err := c.HasTransactions(cx, addr); err != nil || !m[addr] {
+			t.Fatalf("used %v, %v", m[addr], err)
+		}
+	}
+	if chain.calls["HasTransactions"] != 2 {
+		t.Fatalf("%v requests, the used address isn't kept", chain.calls["HasTransactions"])
+	}
+}
+
+func TestCacheHeight(t *testing.T) {
+	cx := context.Background()
+	const addr = "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"
+	chain := newCounter(t)
+	c := newCache(chain, time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	unspent := func(want int) {
+		t.Helper()
+		m, err := c.Unspent(cx, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(m[addr]) != want {
+			t.Fatalf("%v outputs, want %v", len(m[addr]), want)
+		}
+	}
+	unspent(0)
+	unspent(0)
+	if chain.calls["Unspent"] != 1 || chain.calls["BlockHeight"] != 1 {
+		t.Fatalf("requests %v, the hits asked the chain", chain.calls)
+	}
+	if _, err := chain.Fund(addr, 1000); err != nil {
+		t.Fatal(err)
+	}
+	chain.Mine(1)
+	// the height is asked again after the ttl, the block drops the outputs.
+	unspent(0)
+	now = now.Add(2 * time.Minute)
+	unspent(1)
+	unspent(1)
+	if chain.calls["Unspent"] != 2 || chain.calls["BlockHeight"] != 2 {
+		t.Fatalf("requests %v", chain.calls)
+	}
+	// a broadcast drops everything.
+	if _, err := chain.Fund(addr, 2000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Broadcast(cx, "00"); err != nil {
+		t.Fatal(err)
+	}
+	unspent(2)
+	if chain.calls["Unspent"] != 3 || chain.calls["BlockHeight"] != 3 {
+		t.Fatalf("requests %v after the broadcast", chain.calls)
+	}
+	if _, err := chain.Fund(addr, 3000); err != nil {
+		t.Fatal(err)
+	}
+	c.Invalidate(addr)
+	unspent(3)
+}
+
+func TestCacheTTL(t *testing.T) {
+	cx := context.Background()
+	const addr = "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"
+	chain := newCounter(t)
+	c := NewCache(noHeight{chain}, time.Minute)
+	if _, ok := c.(Heighter); ok {
+		t.Fatal("the cache of an unspender without height is a Heighter")
+	}
+	if _, ok := NewCache(chain, time.Minute).(Heighter); !ok {
+		t.Fatal("the cache of a Heighter isn't one")
+	}
+	cache := c.(*Cache)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	if _, err := chain.Fund(addr, 1000); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Unspent(cx, addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := c.Unspent(cx, addr); err != nil {
+		t.Fatal(err)
+	}
+	if chain.calls["Unspent"] != 2 || chain.calls["BlockHeight"] != 0 {
+		t.Fatalf("requests %v", chain.calls)
+	}
+}
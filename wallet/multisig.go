@@ -0,0 +1,87 @@
+package wallet
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	log "github.com/golang/glog"
+	"github.com/winteraz/cryptopay"
+)
+
+// FromMultisig is a bitcoin wallet of the M of N multisig ms. It can't sign
+// transactions alone: Move returns base64 PSBTs the cosigners sign with
+// Key.SignPSBT, signed already by cosigner if it isn't nil (its master key,
+// or its account key if ms has no key origins).
+func FromMultisig(ms *cryptopay.Multisig, cosigner *cryptopay.Key, unspender Unspender) (Wallet, error) {
+	if ms == nil || len(ms.Cosigners) == 0 {
+		return nil, errors.New("Invalid multisig")
+	}
+	return &wallet{coin: cryptopay.BTC, unspender: unspender,
+		multisig: ms, cosigner: cosigner, network: ms.Network,
+		confirmations: DefaultPolicy.Confirmations(cryptopay.BTC)}, nil
+}
+
+// withdrawMultisig makes the PSBT paying amount of the address from, less
+// the fee, to toAddr.
+func (w *wallet) withdrawMultisig(cx context.Context, from, toAddr string, kind bool, index uint32, amount uint64) (string, error) {
+	confirmations := w.confirmations
+	if kind && w.unconfirmedChange {
+		confirmations = 0
+	}
+	una, err := w.spendable(cx, from, confirmations)
+	if err != nil {
+		return "", err
+	}
+	p, err := withFee(w.coin, amount, func(amount, fee uint64) (*payment, error) {
+		psbt, err := w.multisig.NewPSBT(kind, index, toAddr, amount, fee, una)
+		if err != nil {
+			return nil, err
+		}
+		return &payment{psbt: psbt, inputs: una, size: w.multisig.SignedSize(psbt)}, nil
+	})
+	if err != nil {
+		log.Errorf("err %v, addr %v", err, from)
+		return "", err
+	}
+	if p == nil {
+		return "", nil
+	}
+	if g, ok := w.unspender.(TxGetter); ok {
+		addPrevTxs(cx, g, p.psbt, p.inputs)
+	}
+	if w.cosigner != nil {
+		n, err := w.cosigner.SignPSBT(p.psbt)
+		if err != nil {
+			return "", err
+		}
+		if n == 0 {
+			log.Errorf("The cosigner key signed no input of %s", from)
+		}
+	}
+	// the cosigners may never complete it, its inputs aren't outgoing.
+	return p.psbt.String(), nil
+}
+
+// addPrevTxs adds the transactions the PSBT spends, which other wallets need
+// to sign it. Without them only cryptopay signs it.
+func addPrevTxs(cx context.Context, g TxGetter, p *cryptopay.PSBT, inputs []cryptopay.Unspent) {
+	done := make(map[string]bool)
+	for _, un := range inputs {
+		if done[un.Tx] {
+			continue
+		}
+		done[un.Tx] = true
+		raw, err := g.RawTransaction(cx, un.Tx)
+		if err != nil {
+			log.Errorf("The PSBT misses the transaction %s: %v", un.Tx, err)
+			continue
+		}
+		b, err := hex.DecodeString(raw)
+		if err == nil {
+			err = p.AddPrevTx(b)
+		}
+		if err != nil {
+			log.Errorf("The PSBT misses the transaction %s: %v", un.Tx, err)
+		}
+	}
+}
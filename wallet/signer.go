@@ -0,0 +1,65 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"github.com/winteraz/cryptopay"
+)
+
+// Signer holds the private keys of an account, so the wallet talking to the
+// network needs only its public key. It gets the whole transactions, not
+// their hashes, to check what it signs.
+type Signer interface {
+	// SignBTC signs the inputs of the unsigned transaction tx, one
+	// SignInput per input.
+	SignBTC(cx context.Context, tx []byte, inputs []cryptopay.SignInput) ([]byte, error)
+	// SignETH signs tx with the key at path, relative to the account key.
+	SignETH(cx context.Context, path cryptopay.Path, tx *ETHTransaction) ([]byte, error)
+}
+
+// ETHTransaction is an unsigned ethereum transfer, the amounts in wei.
+type ETHTransaction struct {
+	To       string
+	Nonce    uint64
+	Value    uint64
+	GasLimit uint64
+	GasPrice uint64
+}
+
+// KeySigner is the in process Signer of the account key.
+func KeySigner(account *cryptopay.Key) Signer {
+	return keySigner{account}
+}
+
+type keySigner struct {
+	key *cryptopay.Key
+}
+
+func (s keySigner) SignBTC(cx context.Context, tx []byte, inputs []cryptopay.SignInput) ([]byte, error) {
+	return s.key.SignTransactionBTC(tx, inputs)
+}
+
+func (s keySigner) SignETH(cx context.Context, path cryptopay.Path, tx *ETHTransaction) ([]byte, error) {
+	if tx == nil {
+		return nil, errors.New("Invalid transaction/nil")
+	}
+	k, err := s.key.Derive(path)
+	if err != nil {
+		return nil, err
+	}
+	return cryptopay.MakeTransactionETH(k, tx.To, tx.Nonce, tx.Value, tx.GasLimit, tx.GasPrice)
+}
+
+// FromSigner is the wallet of the account key pub, see FromPublic, whose
+// transactions signer signs.
+func FromSigner(pub string, coin cryptopay.CoinType, signer Signer, unspender Unspender) (Wallet, error) {
+	if signer == nil {
+		return nil, errors.New("Invalid signer/nil")
+	}
+	w, err := FromPublic(pub, coin, unspender)
+	if err != nil {
+		return nil, err
+	}
+	w.(*wallet).signer = signer
+	return w, nil
+}
@@ -0,0 +1,141 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	log "github.com/golang/glog"
+	"github.com/winteraz/cryptopay"
+)
+
+// Sweep moves the funds of a loose private key, of a paper wallet or
+// another tool, with confirmations to a fresh address of to, which must be a
+// FreshAddresser, 0 uses the
+// DefaultPolicy. It returns the raw transaction, empty if there's nothing to
+// move. Bitcoin keys are WIF and the funds of every address type they
+// control are moved, ethereum keys are hex.
+func Sweep(cx context.Context, coin cryptopay.CoinType, key string, to Wallet, unspender Unspender, confirmations int) (string, error) {
+	confirmations = Policy{coin: confirmations}.Confirmations(coin)
+	switch coin {
+	case cryptopay.BTC:
+		return sweepBTC(cx, key, to, unspender, confirmations)
+	case cryptopay.ETH:
+		return sweepETH(cx, key, to, unspender, confirmations)
+	}
+	return "", errors.New("unsupported coin " + coin.String())
+}
+
+// SweepBIP38 decrypts a BIP38 key and sweeps it, see Sweep.
+func SweepBIP38(cx context.Context, encrypted, passphrase string, to Wallet, unspender Unspender, confirmations int) (string, error) {
+	wif, err := cryptopay.DecryptBIP38(encrypted, passphrase)
+	if err != nil {
+		return "", err
+	}
+	return sweepBTC(cx, wif, to, unspender, Policy{cryptopay.BTC: confirmations}.Confirmations(cryptopay.BTC))
+}
+
+// sweepAddress returns the fresh address of w the funds are swept to.
+func sweepAddress(cx context.Context, w Wallet) (string, error) {
+	f, ok := w.(FreshAddresser)
+	if !ok {
+		return "", errors.New("Wallet has no fresh address")
+	}
+	return f.FreshAddress(cx)
+}
+
+func sweepBTC(cx context.Context, wif string, to Wallet, unspender Unspender, confirmations int) (string, error) {
+	ka, err := cryptopay.KeyAddresses(wif)
+	if err != nil {
+		return "", err
+	}
+	var addrs []string
+	for _, a := range ka {
+		addrs = append(addrs, a.Address)
+	}
+	unspent, err := unspender.Unspent(cx, addrs...)
+	if err != nil {
+		return "", err
+	}
+	var spends []cryptopay.Spend
+	var amount uint64
+	for _, a := range ka {
+		for _, un := range unspent[a.Address] {
+			if un.Confirmations < confirmations || un.Coinbase && un.Confirmations < cryptopay.CoinbaseMaturity {
+				continue
+			}
+			if a.Type == cryptopay.P2TR {
+				log.Errorf("Can't sweep %v from the taproot address %s", un.Amount, a.Address)
+				continue
+			}
+			spends = append(spends, cryptopay.Spend{Unspent: un, KeyAddress: a})
+			amount += un.Amount
+		}
+	}
+	if amount == 0 {
+		log.Infof("Nothing to sweep from %q", addrs)
+		return "", nil
+	}
+	toAddr, err := sweepAddress(cx, to)
+	if err != nil {
+		return "", err
+	}
+	p, err := withFee(cryptopay.BTC, amount, func(amount, fee uint64) (*payment, error) {
+		b, err := cryptopay.MakeSweepBTC(wif, toAddr, amount, fee, spends)
+		if err != nil {
+			return nil, err
+		}
+		return &payment{tx: b}, nil
+	})
+	if err != nil || p == nil {
+		return "", err
+	}
+	return cryptopay.EncodeRawTX(cryptopay.BTC, p.tx), nil
+}
+
+func sweepETH(cx context.Context, hexKey string, to Wallet, unspender Unspender, confirmations int) (string, error) {
+	k, err := cryptopay.ParseHexKey(hexKey)
+	if err != nil {
+		return "", err
+	}
+	from, err := k.PayAddress(cryptopay.ETH)
+	if err != nil {
+		return "", err
+	}
+	unspent, err := unspender.Unspent(cx, from)
+	if err != nil {
+		return "", err
+	}
+	var amount uint64
+	for _, un := range unspent[from] {
+		if un.Confirmations >= confirmations {
+			amount += un.Amount
+		}
+	}
+	if amount == 0 {
+		log.Infof("Nothing to sweep from %s", from)
+		return "", nil
+	}
+	nonceMap, err := unspender.CountTransactions(cx, from)
+	if err != nil {
+		return "", err
+	}
+	nonce, ok := nonceMap[from]
+	if !ok {
+		return "", errors.New("Unspender failed to return a nonce")
+	}
+	toAddr, err := sweepAddress(cx, to)
+	if err != nil {
+		return "", err
+	}
+	p, err := withFee(cryptopay.ETH, amount, func(amount, fee uint64) (*payment, error) {
+		b, err := cryptopay.MakeTransactionETH(k, toAddr, nonce, amount,
+			cryptopay.GasLimit, cryptopay.GasPrice*cryptopay.GweiToWei)
+		if err != nil {
+			return nil, err
+		}
+		return &payment{tx: b, nonce: nonce}, nil
+	})
+	if err != nil || p == nil {
+		return "", err
+	}
+	return cryptopay.EncodeRawTX(cryptopay.ETH, p.tx), nil
+}
@@ -0,0 +1,287 @@
+package wallet
+
+import (
+	"context"
+	"fmt"
+	"github.com/winteraz/cryptopay"
+	"sync"
+)
+
+// Policy is the number of confirmations the funds of a coin need to be part
+// of the balance and to be moved.
+type Policy map[cryptopay.CoinType]int
+
+// DefaultPolicy only skips unconfirmed funds, as the wallet always did.
+var DefaultPolicy = Policy{cryptopay.BTC: 1, cryptopay.BCH: 1, cryptopay.ETH: 1}
+
+// Confirmations of coin, at least 1.
+func (p Policy) Confirmations(coin cryptopay.CoinType) int {
+	if n := p[coin]; n > 0 {
+		return n
+	}
+	if n := DefaultPolicy[coin]; n > 0 {
+		return n
+	}
+	return 1
+}
+
+// Reverted is a payment which was part of the balance and then lost its
+// confirmations or its transaction in a reorg. Only a TxGetter unspender
+// tells a gone transaction from a spent output, with the others a missing
+// output is spent.
+type Reverted struct {
+	Address       string
+	Tx            string
+	N             uint32
+	Amount        uint64
+	Confirmations int // now, 0 if it's gone
+}
+
+// tracker remembers the outputs counted in the balance, the outputs spent by
+// the transactions of the wallet and the frozen ones. Ethereum balances have
+// no outputs so only what the wallet sends is tracked, by nonce.
+type tracker struct {
+	mu       sync.Mutex
+	counted  map[string]map[string]cryptopay.Unspent // address -> tx:n
+	outgoing map[string]bool                         // tx:n
+	frozen   map[string]bool                         // tx:n
+	sent     map[string]sent                         // ETH address
+	// what the transactions of the wallet, until released, spend.
+	pending  map[string]pending // raw transaction
+	reverted []Reverted
+}
+
+type pending struct {
+	outpoints []string
+	addr      string // ETH
+	amount    uint64
+}
+
+type sent struct {
+	amount uint64 // value and gas
+	nonce  uint64 // of the transaction
+}
+
+func outpoint(tx string, n uint32) string {
+	return fmt.Sprintf("%s:%d", tx, n)
+}
+
+func (t *tracker) init() {
+	if t.counted == nil {
+		t.counted = make(map[string]map[string]cryptopay.Unspent)
+		t.outgoing = make(map[string]bool)
+		t.frozen = make(map[string]bool)
+		t.sent = make(map[string]sent)
+		t.pending = make(map[string]pending)
+	}
+}
+
+// current returns the outputs of m[addr] by outpoint.
+func current(m map[string][]cryptopay.Unspent, addr string) map[string]cryptopay.Unspent {
+	cur := make(map[string]cryptopay.Unspent)
+	for _, un := range m[addr] {
+		if un.Tx == "" {
+			continue
+		}
+		cur[outpoint(un.Tx, un.N)] = un
+	}
+	return cur
+}
+
+// missing returns the transactions funding the counted outputs of the
+// requested addresses which m doesn't have and the wallet didn't spend.
+func (t *tracker) missing(addr []string, m map[string][]cryptopay.Unspent) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var txa []string
+	for _, a := range addr {
+		cur := current(m, a)
+		for key, old := range t.counted[a] {
+			if _, ok := cur[key]; !ok && !t.outgoing[key] {
+				txa = append(txa, old.Tx)
+			}
+		}
+	}
+	return txa
+}
+
+// gone returns the transactions of txa which the unspender no longer has,
+// they left the chain. It can only tell if it's a TxGetter, otherwise
+// nothing is gone.
+func gone(cx context.Context, unspender Unspender, txa []string) map[string]bool {
+	m := make(map[string]bool)
+	g, ok := unspender.(TxGetter)
+	if !ok {
+		return m
+	}
+	for _, tx := range txa {
+		if m[tx] {
+			continue
+		}
+		// it just answered Unspent, an error is a transaction it doesn't
+		// know rather than a failure.
+		if _, err := g.RawTransaction(cx, tx); err != nil && cx.Err() == nil {
+			m[tx] = true
+		}
+	}
+	return m
+}
+
+// update compares the counted outputs of the requested addresses with their
+// unspent outputs. An output which fell below confirmations, or which is
+// missing and whose transaction is gone, was reverted. Any other missing
+// output was spent, by the wallet or by someone else with its keys.
+func (t *tracker) update(addr []string, m map[string][]cryptopay.Unspent, confirmations int, gone map[string]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init()
+	for _, a := range addr {
+		cur := current(m, a)
+		for key, old := range t.counted[a] {
+			un, ok := cur[key]
+			switch {
+			case !ok && !t.outgoing[key] && gone[old.Tx]:
+				t.revert(a, old, 0)
+			case !ok:
+				// spent.
+			case un.Confirmations < confirmations:
+				t.revert(a, old, un.Confirmations)
+			}
+		}
+		counted := make(map[string]cryptopay.Unspent)
+		for key, un := range cur {
+			if un.Confirmations >= confirmations {
+				counted[key] = un
+			}
+		}
+		for key := range t.counted[a] {
+			if _, ok := cur[key]; !ok {
+				delete(t.outgoing, key)
+				delete(t.frozen, key)
+			}
+		}
+		t.counted[a] = counted
+	}
+}
+
+func (t *tracker) revert(addr string, un cryptopay.Unspent, confirmations int) {
+	t.reverted = append(t.reverted, Reverted{
+		Address:       addr,
+		Tx:            un.Tx,
+		N:             un.N,
+		Amount:        un.Amount,
+		Confirmations: confirmations,
+	})
+}
+
+// spend marks the outputs spent by tx, a transaction of the wallet.
+func (t *tracker) spend(tx string, una ...cryptopay.Unspent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init()
+	var p pending
+	for _, un := range una {
+		key := outpoint(un.Tx, un.N)
+		t.outgoing[key] = true
+		p.outpoints = append(p.outpoints, key)
+	}
+	t.pending[tx] = p
+}
+
+// send records tx, an ethereum transaction of the wallet from addr.
+func (t *tracker) send(tx, addr string, amount, nonce uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init()
+	s := t.sent[addr]
+	t.sent[addr] = sent{amount: s.amount + amount, nonce: nonce}
+	t.pending[tx] = pending{addr: addr, amount: amount}
+}
+
+// release forgets what the transactions of the wallet which weren't
+// broadcast spend.
+func (t *tracker) release(txa ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init()
+	for _, tx := range txa {
+		p, ok := t.pending[tx]
+		if !ok {
+			continue
+		}
+		delete(t.pending, tx)
+		for _, key := range p.outpoints {
+			delete(t.outgoing, key)
+		}
+		if s, ok := t.sent[p.addr]; ok && p.addr != "" {
+			if s.amount <= p.amount {
+				delete(t.sent, p.addr)
+				continue
+			}
+			s.amount -= p.amount
+			t.sent[p.addr] = s
+		}
+	}
+}
+
+// sending returns the ethereum addresses with transactions of the wallet
+// which may not be mined, and their newest nonce.
+func (t *tracker) sending(addr ...string) map[string]uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m := make(map[string]uint64)
+	for _, a := range addr {
+		if s, ok := t.sent[a]; ok {
+			m[a] = s.nonce
+		}
+	}
+	return m
+}
+
+// mined forgets the transactions of addr whose nonce is below count, the
+// number of transactions of the address in the latest block, and returns
+// what's left in flight.
+func (t *tracker) mined(addr string, count uint64) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.sent[addr]
+	if !ok {
+		return 0
+	}
+	if count > s.nonce {
+		delete(t.sent, addr)
+		return 0
+	}
+	return s.amount
+}
+
+func (t *tracker) freeze(key string, frozen bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.init()
+	if frozen {
+		t.frozen[key] = true
+		return
+	}
+	delete(t.frozen, key)
+}
+
+func (t *tracker) isOutgoing(un cryptopay.Unspent) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.outgoing[outpoint(un.Tx, un.N)]
+}
+
+func (t *tracker) isFrozen(un cryptopay.Unspent) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.frozen[outpoint(un.Tx, un.N)]
+}
+
+func (t *tracker) takeReverted() []Reverted {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := t.reverted
+	t.reverted = nil
+	return r
+}
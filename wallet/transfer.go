@@ -16,7 +16,7 @@ func (w *wallet) DiscoverUsedIndex(cx context.Context, kind bool, addressGap uin
 		var puba []string
 		pubm := make(map[string]uint32)
 		for addrDepth := uint32(0); addrDepth <= addressGap; addrDepth++ {
-			pub, err := w.pub.DeriveExtendedAddr(w.coin, kind, depth)
+			pub, err := w.address(kind, depth)
 			if err != nil {
 				return nil, err
 			}
@@ -51,15 +51,24 @@ func (w *wallet) DiscoverUsedIndex(cx context.Context, kind bool, addressGap uin
 	return mp, nil
 }
 
-// returns a fresh external address
+// returns a fresh external address, of the type of the account if it's a
+// ypub, zpub or a descriptor.
 func freshAddress(cx context.Context, exPub string, coin cryptopay.CoinType, unspender Unspender) (string, error) {
-	k, err := cryptopay.ParseKey(exPub)
+	a, err := cryptopay.ParseAccountKey(exPub)
 	if err != nil {
 		return "", err
 	}
 	const kind = false
 	for i := uint32(0); i < 9999999; i++ {
-		addr, err := k.DeriveExtendedAddr(coin, kind, i)
+		var addr string
+		if coin == cryptopay.BTC {
+			var k *cryptopay.Key
+			if k, err = a.Key.DeriveExtendedKey(kind, i); err == nil {
+				addr, err = k.ScriptAddress(a.Type, a.Network)
+			}
+		} else {
+			addr, err = a.Key.DeriveExtendedAddr(coin, kind, i)
+		}
 		if err != nil {
 			return "", err
 		}
@@ -76,9 +85,9 @@ func freshAddress(cx context.Context, exPub string, coin cryptopay.CoinType, uns
 }
 
 type indexAmount struct {
-	index  uint32
-	kind   bool
-	amount uint64
+	index   uint32
+	kind    bool
+	balance Balance
 }
 
 // returns map[index]amount
@@ -104,7 +113,7 @@ func (w *wallet) balanceByIndexes(cx context.Context, kind bool, addressGap uint
 		if depth > highIndex {
 			highIndex = depth
 		}
-		pub, err := w.pub.DeriveExtendedAddr(w.coin, kind, depth)
+		pub, err := w.address(kind, depth)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -116,16 +125,16 @@ func (w *wallet) balanceByIndexes(cx context.Context, kind bool, addressGap uint
 		return nil, 0, err
 	}
 	var out []indexAmount
-	for address, amount := range addressAmountMap {
-		if amount < 1 {
+	for address, balance := range addressAmountMap {
+		if balance == (Balance{}) {
 			continue
 		}
-		log.Errorf("Address %s amount %v", address, amount)
+		log.Errorf("Address %s balance %+v", address, balance)
 		index, ok := mapByIndex[address]
 		if !ok {
 			return nil, 0, errors.New("Unexpected: balanceByIndexes - address index not found in address map")
 		}
-		out = append(out, indexAmount{index: index, kind: kind, amount: amount})
+		out = append(out, indexAmount{index: index, kind: kind, balance: balance})
 	}
 	return out, highIndex, nil
 
@@ -162,6 +171,13 @@ func (w *wallet) Move(cx context.Context, toPub string, addressGap uint32) ([]st
 	var mp []string
 	var unusedAddr string
 	for _, record := range unspent {
+		amount := record.balance.Confirmed
+		if record.kind && w.unconfirmedChange {
+			amount += record.balance.Incoming
+		}
+		if amount == 0 {
+			continue
+		}
 		var toAddr string
 		if unusedAddr != "" {
 			toAddr = unusedAddr
@@ -172,7 +188,7 @@ func (w *wallet) Move(cx context.Context, toPub string, addressGap uint32) ([]st
 				return nil, err
 			}
 		}
-		b, err := w.withdrawAddress(cx, toAddr, record.kind, record.index, record.amount)
+		b, err := w.withdrawAddress(cx, toAddr, record.kind, record.index, amount)
 		if err != nil {
 			log.Error(err)
 			return nil, err
@@ -187,61 +203,131 @@ func (w *wallet) Move(cx context.Context, toPub string, addressGap uint32) ([]st
 }
 
 func (w *wallet) withdrawAddress(cx context.Context, toAddr string, kind bool, index uint32, amount uint64) (string, error) {
-	pub, err := w.pub.DeriveExtendedAddr(w.coin, kind, index)
+	if _, err := cryptopay.ValidateAddress(w.coin, cryptopay.MainNet, toAddr); err != nil {
+		log.Error(err)
+		return "", err
+	}
+	pub, err := w.address(kind, index)
 	if err != nil {
 		log.Error(err)
 		return "", err
 	}
 	log.Infof("pub is %s", pub)
-	priv, err := w.priv.DeriveExtendedKey(kind, index)
+	if w.multisig != nil {
+		return w.withdrawMultisig(cx, pub, toAddr, kind, index, amount)
+	}
+	if w.signer == nil {
+		return "", errors.New("The wallet can't sign transactions")
+	}
+	confirmations := w.confirmations
+	if kind && w.unconfirmedChange {
+		confirmations = 0
+	}
+	p, err := withFee(w.coin, amount, func(amount, fee uint64) (*payment, error) {
+		return w.makeTransaction(cx, pub, toAddr, kind, index, amount, fee, confirmations)
+	})
 	if err != nil {
-		log.Error(err)
+		log.Errorf("err %v, addr %v", err, pub)
+		return "", err
+	}
+	if p == nil {
+		return "", nil
+	}
+	// signed once the fee is known, a remote signer sees every
+	// transaction once.
+	if w.coin == cryptopay.ETH {
+		p.tx, err = w.signer.SignETH(cx, p.path, p.eth)
+	} else {
+		p.tx, err = w.signer.SignBTC(cx, p.tx, p.sign)
+	}
+	if err != nil {
+		log.Errorf("err %v, addr %v", err, pub)
 		return "", err
 	}
+	raw := cryptopay.EncodeRawTX(w.coin, p.tx)
+	if w.coin == cryptopay.ETH {
+		w.tracker.send(raw, pub, amount, p.nonce)
+	} else {
+		w.tracker.spend(raw, p.inputs...)
+	}
+	return raw, nil
+}
+
+// withFee builds the payment of amount less the fee, estimated on a first
+// build with an arbitrary fee. The payment is nil if amount doesn't pay the
+// fee.
+func withFee(coin cryptopay.CoinType, amount uint64, build func(amount, fee uint64) (*payment, error)) (*payment, error) {
 	// Set an abritrary
 	fee := uint64(1000)
 	if amount < (fee + 1) {
 		log.Infof("Amount %v smaller than the fee %v", amount, fee+1)
-		return "", nil
+		return nil, nil
 	}
-	b, err := makeTransaction(cx, w.unspender, priv, pub, toAddr, w.coin, amount-fee, fee)
+	p, err := build(amount-fee, fee)
 	if err != nil {
-		log.Errorf("err %v, addr %v", err, pub)
-		return "", err
+		return nil, err
+	}
+	if p.size > 0 {
+		fee, err = cryptopay.EstimateFeeSize(coin, p.size)
+	} else {
+		fee, err = cryptopay.EstimateFee(coin, p.tx)
 	}
-	fee, err = cryptopay.EstimateFee(w.coin, b)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if amount < (fee + 1) {
 		log.Errorf("Amount %v is less than the fee %v", amount, fee+1)
-		return "", nil
+		return nil, nil
 	}
 	log.Infof("amount %v, fee %v, amount - fee %v", amount, fee, amount-fee)
-	b, err = makeTransaction(cx, w.unspender, priv, pub, toAddr, w.coin, amount-fee, fee)
-	if err != nil {
-		return "", err
-	}
-	return cryptopay.EncodeRawTX(w.coin, b), nil
+	return build(amount-fee, fee)
 }
 
-func makeTransaction(cx context.Context, unspender Unspender, priv *cryptopay.Key, from, to string, coin cryptopay.CoinType, amount, fee uint64) ([]byte, error) {
-	privEnc, err := priv.PrivateRoot(coin)
-	if err != nil {
-		log.Error(err)
-		return nil, err
+// payment is a transaction and what it spends.
+type payment struct {
+	tx     []byte
+	inputs []cryptopay.Unspent // BTC
+	nonce  uint64              // ETH
+	// size is the estimated size of the transaction once signed, psbt the
+	// transaction of multisig wallets.
+	size int
+	psbt *cryptopay.PSBT
+	// what the signer signs, the inputs of tx or the ethereum transaction
+	// of the key of path.
+	sign []cryptopay.SignInput
+	path cryptopay.Path
+	eth  *ETHTransaction
+}
+
+// makeTransaction spends the outputs of from, the address of index on the
+// external or internal chain, with at least confirmations, leaving out the
+// frozen, immature and already spent ones. The payment isn't signed yet.
+func (w *wallet) makeTransaction(cx context.Context, from, to string, kind bool, index uint32, amount, fee uint64, confirmations int) (*payment, error) {
+	path := cryptopay.Path{0, index}
+	if kind {
+		path[0] = 1
 	}
-	switch coin {
+	switch w.coin {
 	case cryptopay.BTC:
-		unspentTX, err := unspender.Unspent(cx, from)
+		una, err := w.spendable(cx, from, confirmations)
 		if err != nil {
-			log.Error(err)
 			return nil, err
 		}
-
-		return cryptopay.MakeTransactionBTC(privEnc, to, amount, fee, unspentTX[from])
+		b, err := cryptopay.NewTransactionBTC(to, from, amount, fee, una)
+		if err != nil {
+			return nil, err
+		}
+		sign := make([]cryptopay.SignInput, len(una))
+		for i, un := range una {
+			sign[i] = cryptopay.SignInput{Path: path, Type: w.addrType, Amount: un.Amount}
+		}
+		size, err := cryptopay.SignedSizeBTC(b, sign)
+		if err != nil {
+			return nil, err
+		}
+		return &payment{tx: b, inputs: una, size: size, sign: sign}, nil
 	case cryptopay.ETH:
-		nonceMap, err := unspender.CountTransactions(cx, from)
+		nonceMap, err := w.unspender.CountTransactions(cx, from)
 		if err != nil {
 			log.Error(err)
 			return nil, err
@@ -251,10 +337,32 @@ func makeTransaction(cx context.Context, unspender Unspender, priv *cryptopay.Ke
 			log.Errorf("nonceMap %q", nonceMap)
 			return nil, errors.New("Unspender failed to return a nonce")
 		}
+		if _, err = cryptopay.ValidateAddress(cryptopay.ETH, cryptopay.MainNet, to); err != nil {
+			return nil, err
+		}
+		tx := &ETHTransaction{To: to, Nonce: nonce, Value: amount,
+			GasLimit: cryptopay.GasLimit,
+			GasPrice: cryptopay.GasPrice * cryptopay.GweiToWei}
+		return &payment{nonce: nonce, path: path, eth: tx}, nil
+	}
+	return nil, errors.New("unsupported coin " + w.coin.String())
+}
 
-		return cryptopay.MakeTransactionETH(priv, to, nonce, amount,
-			cryptopay.GasLimit,
-			cryptopay.GasPrice*cryptopay.GweiToWei)
+// spendable returns the outputs of from with at least confirmations which
+// aren't frozen, immature or already spent.
+func (w *wallet) spendable(cx context.Context, from string, confirmations int) ([]cryptopay.Unspent, error) {
+	unspentTX, err := w.unspender.Unspent(cx, from)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	var una []cryptopay.Unspent
+	for _, un := range unspentTX[from] {
+		if un.Confirmations < confirmations || w.tracker.isOutgoing(un) || w.tracker.isFrozen(un) ||
+			un.Coinbase && un.Confirmations < cryptopay.CoinbaseMaturity {
+			continue
+		}
+		una = append(una, un)
 	}
-	return nil, errors.New("unsupported coin " + coin.String())
+	return una, nil
 }
@@ -23,17 +23,33 @@ type Broadcaster interface {
 	Broadcast(cx context.Context, rawTransaction ...string) (map[string]error, error)
 }
 
+// TxGetter is implemented by the unspenders which return the hex raw
+// transactions, the multisig wallets add them to their PSBTs.
+type TxGetter interface {
+	RawTransaction(cx context.Context, txid string) (string, error)
+}
+
 // from hardened public key(m/44/coin/account). This wallet is unable to sign transactions.
 // receives a map[coin]map[account]Extended public key
+// Bitcoin accounts may be a ypub/zpub or an output descriptor too, see
+// cryptopay.ParseAccountKey, and the addresses have their type.
 func FromPublic(pub string, coin cryptopay.CoinType, unspender Unspender) (Wallet, error) {
 	if len(pub) == 0 {
 		return nil, errors.New("Invalid pub/empty")
 	}
-	k, err := cryptopay.ParseKey(pub)
+	a, err := cryptopay.ParseAccountKey(pub)
 	if err != nil {
 		return nil, err
 	}
-	return &wallet{pub: k, coin: coin, unspender: unspender}, nil
+	if a.Multisig {
+		return nil, errors.New("Multisig keys need the other cosigners")
+	}
+	if coin != cryptopay.BTC && (a.Type != cryptopay.P2PKH || a.Network != cryptopay.MainNet) {
+		return nil, errors.New("Only bitcoin accounts have address types")
+	}
+	return &wallet{pub: a.Key, coin: coin, unspender: unspender,
+		addrType: a.Type, network: a.Network,
+		confirmations: DefaultPolicy.Confirmations(coin)}, nil
 }
 
 func FromMnemonic(mnemonic, passwd string, unspender Unspender, coin cryptopay.CoinType, account uint32) (Wallet, error) {
@@ -53,9 +69,11 @@ func FromMnemonic(mnemonic, passwd string, unspender Unspender, coin cryptopay.C
 	}
 	//log.Infof("Extended Public is %s", accountExtededPrivatePublic.Base58())
 	return &wallet{coin: coin,
-		priv:      accountExtededPrivate,
-		pub:       accountExtededPrivatePublic,
-		unspender: unspender}, nil
+		signer:        KeySigner(accountExtededPrivate),
+		pub:           accountExtededPrivatePublic,
+		addrType:      cryptopay.P2PKH,
+		unspender:     unspender,
+		confirmations: DefaultPolicy.Confirmations(coin)}, nil
 }
 
 type Transaction struct {
@@ -65,23 +83,123 @@ type Transaction struct {
 	Fee           int64 //??
 }
 
+// Balance splits the funds of an address, or of many, by what can be done
+// with them.
+type Balance struct {
+	// Confirmed funds have the confirmations of the policy and can be moved.
+	Confirmed uint64
+	// Incoming funds are unconfirmed or below the policy.
+	Incoming uint64
+	// Outgoing funds are spent by transactions of the wallet which aren't
+	// mined yet.
+	Outgoing uint64
+	// Locked funds are frozen or immature coinbase outputs.
+	Locked uint64
+}
+
+func (b Balance) Add(o Balance) Balance {
+	return Balance{
+		Confirmed: b.Confirmed + o.Confirmed,
+		Incoming:  b.Incoming + o.Incoming,
+		Outgoing:  b.Outgoing + o.Outgoing,
+		Locked:    b.Locked + o.Locked,
+	}
+}
+
+// Total is all the funds on the addresses, including the outgoing ones.
+func (b Balance) Total() uint64 {
+	return b.Confirmed + b.Incoming + b.Outgoing + b.Locked
+}
+
 type Wallet interface {
 	Addresses(cx context.Context, kind bool, startIndex, limit uint32) ([]string, error)
 	// depth How many addresses we should generate
 	// returns map[address]balance.
-	Balance(cx context.Context, kind bool, depth uint32) (map[string]uint64, error)
-	BalanceByAddress(cx context.Context, address ...string) (map[string]uint64, error)
+	Balance(cx context.Context, kind bool, depth uint32) (map[string]Balance, error)
+	BalanceByAddress(cx context.Context, address ...string) (map[string]Balance, error)
 	//	MakeTransaction(cx context.Context, from, to string, amount, fee uint64, addrDepth uint32) ([]byte, error)
 	Move(cx context.Context, to string, addressGap uint32) ([]string, error)
 	Transactions(cx context.Context, depth uint32) ([]Transaction, error)
 }
 
+// Tracker is implemented by the wallets of this package on top of Wallet.
+type Tracker interface {
+	// SetConfirmations sets the confirmations funds need to be part of the
+	// balance and to be moved, see Policy.
+	SetConfirmations(n int)
+	// SetUnconfirmedChange makes Move spend the unconfirmed funds of the
+	// change addresses too.
+	SetUnconfirmedChange(ok bool)
+	// Freeze keeps an output out of the confirmed balance and of Move until
+	// it's unfrozen.
+	Freeze(tx string, n uint32, frozen bool)
+	// Reverted returns the payments which left the balance in a reorg
+	// since the last call.
+	Reverted() []Reverted
+	// Release puts back in the balance what the transactions returned by
+	// Move spend, if they weren't broadcast or failed to. Until then
+	// they're outgoing.
+	Release(tx ...string)
+}
+
+// FreshAddresser is a wallet which finds its first unused address, the
+// wallets of this package are.
+type FreshAddresser interface {
+	// FreshAddress returns the first external address without
+	// transactions.
+	FreshAddress(cx context.Context) (string, error)
+}
+
 type wallet struct {
 	coin      cryptopay.CoinType
 	unspender Unspender
-	priv      *cryptopay.Key
+	// signer signs the transactions, nil for watch only wallets.
+	signer Signer
 	// hardened public key of bip 44/coin/accountIndex path.
 	pub *cryptopay.Key
+	// the addresses of bitcoin accounts.
+	addrType          cryptopay.AddressType
+	network           cryptopay.Network
+	confirmations     int
+	unconfirmedChange bool
+	tracker           tracker
+	// multisig wallets derive the addresses of the cosigners, cosigner is
+	// the key of one of them, if any.
+	multisig *cryptopay.Multisig
+	cosigner *cryptopay.Key
+}
+
+// address derives the address of index on the external or internal chain.
+func (w *wallet) address(kind bool, index uint32) (string, error) {
+	if w.multisig != nil {
+		return w.multisig.Address(kind, index)
+	}
+	if w.coin != cryptopay.BTC {
+		return w.pub.DeriveExtendedAddr(w.coin, kind, index)
+	}
+	k, err := w.pub.DeriveExtendedKey(kind, index)
+	if err != nil {
+		return "", err
+	}
+	return k.ScriptAddress(w.addrType, w.network)
+}
+
+func (w *wallet) FreshAddress(cx context.Context) (string, error) {
+	const kind = false
+	for index := uint32(0); index < 9999999; index++ {
+		addr, err := w.address(kind, index)
+		if err != nil {
+			return "", err
+		}
+		ok, err := w.unspender.HasTransactions(cx, addr)
+		if err != nil {
+			return "", err
+		}
+		if !ok[addr] {
+			return addr, nil
+		}
+	}
+	return "", errors.New("no address was found....impossible???")
 }
 
 func (w *wallet) Addresses(cx context.Context, kind bool, startIndex, limit uint32) ([]string, error) {
@@ -89,8 +207,8 @@ func (w *wallet) Addresses(cx context.Context, kind bool, startIndex, limit uint
 	for index := startIndex; index <= limit; index++ {
 		// generate addresses
 		// if we have a private key we can generate them directly for any coin
-		if w.priv != nil {
-			childPublic, err := w.pub.DeriveExtendedAddr(w.coin, kind, index)
+		if w.signer != nil || w.multisig != nil {
+			childPublic, err := w.address(kind, index)
 			if err != nil {
 				return nil, err
 			}
@@ -104,7 +222,7 @@ func (w *wallet) Addresses(cx context.Context, kind bool, startIndex, limit uint
 			return nil, errors.New("we have no public key for the given coin and account index")
 		}
 
-		childPublic, err := w.pub.DeriveExtendedAddr(w.coin, kind, index)
+		childPublic, err := w.address(kind, index)
 		if err != nil {
 			return nil, err
 		}
@@ -113,49 +231,108 @@ func (w *wallet) Addresses(cx context.Context, kind bool, startIndex, limit uint
 	return sa, nil
 }
 
-func (w *wallet) Balance(cx context.Context, kind bool, depth uint32) (map[string]uint64, error) {
+func (w *wallet) Balance(cx context.Context, kind bool, depth uint32) (map[string]Balance, error) {
 	const onlyOnce = false // we should modify Balance call
 	indexAmounta, _, err := w.balanceByIndexes(cx, kind, depth, onlyOnce)
 	if err != nil {
 		log.Error(err)
 		return nil, err
 	}
-	out := make(map[string]uint64)
+	out := make(map[string]Balance)
 	for _, v := range indexAmounta {
-		addr, err := w.pub.DeriveExtendedAddr(w.coin, kind, v.index)
+		addr, err := w.address(kind, v.index)
 		if err != nil {
 			return nil, err
 		}
-		out[addr] = v.amount
+		out[addr] = v.balance
 	}
 	return out, nil
 }
 
-func (w *wallet) BalanceByAddress(cx context.Context, address ...string) (map[string]uint64, error) {
+func (w *wallet) BalanceByAddress(cx context.Context, address ...string) (map[string]Balance, error) {
 	log.Infof("Address %q", address)
 	if len(address) == 0 {
 		return nil, errors.New("Invalid invalid addressList")
 	}
 	defer log.Flush()
-	amount := make(map[string]uint64)
+	out := make(map[string]Balance)
 
 	// Get the balance
 	unspent, err := w.unspender.Unspent(cx, address...)
 	if err != nil {
 		return nil, err
 	}
+	// ethereum transactions of the wallet are in the balance until mined.
+	var inFlight map[string]uint64
+	if sending := w.tracker.sending(address...); len(sending) > 0 {
+		var addrs []string
+		for a := range sending {
+			addrs = append(addrs, a)
+		}
+		counts, err := w.unspender.CountTransactions(cx, addrs...)
+		if err != nil {
+			return nil, err
+		}
+		inFlight = make(map[string]uint64)
+		for _, a := range addrs {
+			inFlight[a] = w.tracker.mined(a, counts[a])
+		}
+	}
 
 	for address, una := range unspent {
+		var b Balance
 		for _, un := range una {
 			log.Infof("address %v, amount %v, confirmations %v",
 				address, un.Amount, un.Confirmations)
-			if un.Confirmations == 0 {
-				continue
+			switch {
+			case un.Tx != "" && w.tracker.isOutgoing(un):
+				b.Outgoing += un.Amount
+			case un.Tx != "" && w.tracker.isFrozen(un),
+				un.Coinbase && un.Confirmations < cryptopay.CoinbaseMaturity:
+				b.Locked += un.Amount
+			case un.Confirmations < w.confirmations:
+				b.Incoming += un.Amount
+			default:
+				b.Confirmed += un.Amount
 			}
-			amount[address] += un.Amount
+		}
+		if sending := inFlight[address]; sending > 0 {
+			if sending > b.Confirmed {
+				sending = b.Confirmed
+			}
+			b.Confirmed -= sending
+			b.Outgoing += sending
+		}
+		if b != (Balance{}) {
+			out[address] = b
 		}
 	}
-	return amount, nil
+	missing := w.tracker.missing(address, unspent)
+	w.tracker.update(address, unspent, w.confirmations, gone(cx, w.unspender, missing))
+	return out, nil
+}
+
+func (w *wallet) SetConfirmations(n int) {
+	if n < 1 {
+		n = 1
+	}
+	w.confirmations = n
+}
+
+func (w *wallet) SetUnconfirmedChange(ok bool) {
+	w.unconfirmedChange = ok
+}
+
+func (w *wallet) Freeze(tx string, n uint32, frozen bool) {
+	w.tracker.freeze(outpoint(tx, n), frozen)
+}
+
+func (w *wallet) Release(tx ...string) {
+	w.tracker.release(tx...)
+}
+
+func (w *wallet) Reverted() []Reverted {
+	return w.tracker.takeReverted()
 }
 
 // Bug: currently it only includes unspent transaction
@@ -1,12 +1,570 @@
 package wallet
 
-/*
-import(
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"github.com/winteraz/cryptopay"
+	"github.com/winteraz/cryptopay/chaintest"
 	"testing"
 )
 
-func TestMove(t *testing.T){
-	// create a new wallet.
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
 
+// destination returns the account xpub Move sends to and its first address.
+func destination(t *testing.T, coin cryptopay.CoinType) (string, string) {
+	private, _, err := cryptopay.NewFromMnemonic(testMnemonic, "destination")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := private.DeriveExtendedAccountKey(false, coin, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := pub.DeriveExtendedAddr(coin, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub.Base58(), addr
+}
+
+func TestMove(t *testing.T) {
+	cx := context.Background()
+	chain, err := chaintest.New(cryptopay.BTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := FromMnemonic(testMnemonic, "", chain, cryptopay.BTC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext, err := w.Addresses(cx, false, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change, err := w.Addresses(cx, true, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funds := map[string]uint64{ext[0]: 100000, ext[2]: 50000, change[1]: 70000}
+	for addr, amount := range funds {
+		if _, err = chain.Fund(addr, amount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// unconfirmed funds are incoming.
+	bal, err := w.Balance(cx, false, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, b := range bal {
+		if b.Confirmed != 0 || b.Incoming != funds[addr] {
+			t.Fatalf("unconfirmed balance %v", bal)
+		}
+	}
+	chain.Mine(1)
+	bal, err = w.Balance(cx, false, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bal) != 2 || bal[ext[0]].Confirmed != funds[ext[0]] || bal[ext[2]].Confirmed != funds[ext[2]] {
+		t.Fatalf("balance %v, funds %v", bal, funds)
+	}
+
+	toPub, toAddr := destination(t, cryptopay.BTC)
+	txa, err := w.Move(cx, toPub, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txa) != len(funds) {
+		t.Fatalf("got %v transactions, want %v", len(txa), len(funds))
+	}
+	rsp, err := chain.Broadcast(cx, txa...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for tx, err := range rsp {
+		if err != nil {
+			t.Fatalf("tx %s: %v", tx, err)
+		}
+	}
+	// the same transactions spend outputs which are gone.
+	rsp, err = chain.Broadcast(cx, txa...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for tx, err := range rsp {
+		if err == nil {
+			t.Fatalf("double spend %s accepted", tx)
+		}
+	}
+	chain.Mine(1)
+	var total uint64
+	for addr, amount := range funds {
+		total += amount
+		if b := chain.Balance(addr); b != 0 {
+			t.Errorf("%s still has %v", addr, b)
+		}
+	}
+	if got := chain.Balance(toAddr); got == 0 || got >= total {
+		t.Errorf("destination has %v, moved %v", got, total)
+	}
+}
+
+func TestMoveETH(t *testing.T) {
+	cx := context.Background()
+	chain, err := chaintest.New(cryptopay.ETH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := FromMnemonic(testMnemonic, "", chain, cryptopay.ETH, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext, err := w.Addresses(cx, false, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const amount = 1000000000000000000 // 1 ETH
+	if _, err = chain.Fund(ext[0], amount); err != nil {
+		t.Fatal(err)
+	}
+	chain.Mine(1)
+	toPub, toAddr := destination(t, cryptopay.ETH)
+	txa, err := w.Move(cx, toPub, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txa) != 1 {
+		t.Fatalf("got %v transactions, want 1", len(txa))
+	}
+	rsp, err := chain.Broadcast(cx, txa...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rsp[txa[0]]; err != nil {
+		t.Fatal(err)
+	}
+	chain.Mine(1)
+	fee := cryptopay.GasLimit * cryptopay.GasPrice * cryptopay.GweiToWei
+	if got := chain.Balance(toAddr); got != amount-fee {
+		t.Errorf("destination has %v, want %v", got, amount-fee)
+	}
+	if got := chain.Balance(ext[0]); got != 0 {
+		t.Errorf("source has %v", got)
+	}
+}
+
+func TestMoveUnspentFailure(t *testing.T) {
+	cx := context.Background()
+	chain, err := chaintest.New(cryptopay.BTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := FromMnemonic(testMnemonic, "", chain, cryptopay.BTC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext, err := w.Addresses(cx, false, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = chain.Fund(ext[0], 100000); err != nil {
+		t.Fatal(err)
+	}
+	chain.Mine(1)
+	down := errors.New("backend down")
+	chain.Fail("Unspent", down)
+	toPub, _ := destination(t, cryptopay.BTC)
+	if _, err = w.Move(cx, toPub, 5); err != down {
+		t.Fatalf("err %v, want %v", err, down)
+	}
+	used, err := w.(*wallet).DiscoverUsedIndex(cx, false, 5, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(used) != 1 || used[0] != 0 {
+		t.Fatalf("used indexes %v", used)
+	}
+}
+
+func TestReverted(t *testing.T) {
+	cx := context.Background()
+	chain, err := chaintest.New(cryptopay.BTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := FromMnemonic(testMnemonic, "", chain, cryptopay.BTC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.(Tracker).SetConfirmations(2)
+	ext, err := w.Addresses(cx, false, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := chain.Fund(ext[0], 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.Mine(1)
+	bal, err := w.BalanceByAddress(cx, ext[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bal[ext[0]].Confirmed != 0 {
+		t.Fatalf("balance %v with 1 of 2 confirmations", bal)
+	}
+	chain.Mine(1)
+	if bal, err = w.BalanceByAddress(cx, ext[0]); err != nil {
+		t.Fatal(err)
+	}
+	if bal[ext[0]].Confirmed != 100000 {
+		t.Fatalf("balance %v, want 100000", bal)
+	}
+	if r := w.(Tracker).Reverted(); len(r) != 0 {
+		t.Fatalf("reverted %v", r)
+	}
+	if err = chain.Reorg(2, tx); err != nil {
+		t.Fatal(err)
+	}
+	if bal, err = w.BalanceByAddress(cx, ext[0]); err != nil {
+		t.Fatal(err)
+	}
+	if bal[ext[0]].Confirmed != 0 {
+		t.Fatalf("balance %v after the reorg", bal)
+	}
+	r := w.(Tracker).Reverted()
+	if len(r) != 1 || r[0].Tx != tx || r[0].Amount != 100000 || r[0].Address != ext[0] {
+		t.Fatalf("reverted %+v, want %s", r, tx)
+	}
+
+	// spent by another wallet with the same keys isn't a reorg.
+	if _, err = chain.Fund(ext[0], 50000); err != nil {
+		t.Fatal(err)
+	}
+	chain.Mine(2)
+	if bal, err = w.BalanceByAddress(cx, ext[0]); err != nil {
+		t.Fatal(err)
+	}
+	if bal[ext[0]].Confirmed != 50000 {
+		t.Fatalf("balance %v, want 50000", bal)
+	}
+	other, err := FromMnemonic(testMnemonic, "", chain, cryptopay.BTC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	toPub, _ := destination(t, cryptopay.BTC)
+	txa, err := other.Move(cx, toPub, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = chain.Broadcast(cx, txa...); err != nil {
+		t.Fatal(err)
+	}
+	if bal, err = w.BalanceByAddress(cx, ext[0]); err != nil {
+		t.Fatal(err)
+	}
+	if r = w.(Tracker).Reverted(); len(bal) != 0 || len(r) != 0 {
+		t.Fatalf("balance %v, reverted %+v after a spend", bal, r)
+	}
+}
+
+func TestBalance(t *testing.T) {
+	cx := context.Background()
+	chain, err := chaintest.New(cryptopay.BTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := FromMnemonic(testMnemonic, "", chain, cryptopay.BTC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext, err := w.Addresses(cx, false, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change, err := w.Addresses(cx, true, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frozen, err := chain.Fund(ext[0], 30000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = chain.Fund(ext[0], 100000); err != nil {
+		t.Fatal(err)
+	}
+	chain.Mine(1)
+	if _, err = chain.Fund(change[0], 40000); err != nil {
+		t.Fatal(err)
+	}
+	w.(Tracker).Freeze(frozen, 0, true)
+	bal, err := w.BalanceByAddress(cx, ext[0], change[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Balance{
+		ext[0]:    {Confirmed: 100000, Locked: 30000},
+		change[0]: {Incoming: 40000},
+	}
+	if bal[ext[0]] != want[ext[0]] || bal[change[0]] != want[change[0]] {
+		t.Fatalf("balance %+v, want %+v", bal, want)
+	}
+
+	toPub, _ := destination(t, cryptopay.BTC)
+	txa, err := w.Move(cx, toPub, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txa) != 1 {
+		t.Fatalf("got %v transactions, want only the confirmed funds", len(txa))
+	}
+	// not broadcast yet, the spent output is outgoing.
+	if bal, err = w.BalanceByAddress(cx, ext[0]); err != nil {
+		t.Fatal(err)
+	}
+	if b := bal[ext[0]]; b.Outgoing != 100000 || b.Confirmed != 0 || b.Locked != 30000 {
+		t.Fatalf("balance %+v after Move", b)
+	}
+	// a failed broadcast puts the funds back.
+	chain.Fail("Broadcast", errors.New("backend down"))
+	if _, err = chain.Broadcast(cx, txa...); err == nil {
+		t.Fatal("broadcast didn't fail")
+	}
+	w.(Tracker).Release(txa...)
+	if bal, err = w.BalanceByAddress(cx, ext[0]); err != nil {
+		t.Fatal(err)
+	}
+	if b := bal[ext[0]]; b.Outgoing != 0 || b.Confirmed != 100000 {
+		t.Fatalf("balance %+v after Release", b)
+	}
+	if txa, err = w.Move(cx, toPub, 5); err != nil {
+		t.Fatal(err)
+	}
+	if len(txa) != 1 {
+		t.Fatalf("got %v transactions after Release", len(txa))
+	}
+
+	w.(Tracker).SetUnconfirmedChange(true)
+	if txa, err = w.Move(cx, toPub, 5); err != nil {
+		t.Fatal(err)
+	}
+	if len(txa) != 1 {
+		t.Fatalf("got %v transactions, want the unconfirmed change", len(txa))
+	}
+}
+
+func TestFromPublicZpub(t *testing.T) {
+	const zpub = "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+	cx := context.Background()
+	chain, err := chaintest.New(cryptopay.BTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := FromPublic(zpub, cryptopay.BTC, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext, err := w.Addresses(cx, false, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// BIP 84
+	if ext[0] != "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu" {
+		t.Fatalf("first address %s", ext[0])
+	}
+	if _, err = chain.Fund(ext[0], 5000); err != nil {
+		t.Fatal(err)
+	}
+	chain.Mine(1)
+	bal, err := w.Balance(cx, false, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bal[ext[0]].Confirmed != 5000 {
+		t.Fatalf("balance %+v", bal)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	cx := context.Background()
+	chain, err := chaintest.New(cryptopay.BTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const wif = "L44B5gGEpqEDRS9vVPz7QT35jcBG2r3CZwSwQ4fCewXAhAhqGVpP"
+	ka, err := cryptopay.KeyAddresses(wif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total uint64
+	for i, a := range ka {
+		if a.Type == cryptopay.P2TR {
+			// not swept, and chaintest can't pay it.
+			continue
+		}
+		amount := uint64(1000000 * (i + 1))
+		if _, err = chain.Fund(a.Address, amount); err != nil {
+			t.Fatal(err)
+		}
+		total += amount
+	}
+	xpub, first := destination(t, cryptopay.BTC)
+	to, err := FromPublic(xpub, cryptopay.BTC, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// unconfirmed funds stay.
+	if tx, err := Sweep(cx, cryptopay.BTC, wif, to, chain, 0); err != nil || tx != "" {
+		t.Fatalf("swept unconfirmed funds %q, %v", tx, err)
+	}
+	chain.Mine(1)
+	tx, err := Sweep(cx, cryptopay.BTC, wif, to, chain, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs, err := chain.Broadcast(cx, tx)
+	if err != nil || errs[tx] != nil {
+		t.Fatalf("broadcast %v, %v", errs[tx], err)
+	}
+	got := chain.Balance(first)
+	// the fee of less than a kB.
+	if got >= total || total-got > 130*1000 {
+		t.Fatalf("swept %v of %v", got, total)
+	}
+}
+
+func TestSweepETH(t *testing.T) {
+	cx := context.Background()
+	chain, err := chaintest.New(cryptopay.ETH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const key = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+	k, err := cryptopay.ParseHexKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, err := k.PayAddress(cryptopay.ETH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const amount = 1000000000000000000 // 1 ETH
+	if _, err = chain.Fund(from, amount); err != nil {
+		t.Fatal(err)
+	}
+	chain.Mine(1)
+	xpub, first := destination(t, cryptopay.ETH)
+	to, err := FromPublic(xpub, cryptopay.ETH, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the caller wants more confirmations than the DefaultPolicy.
+	if tx, err := Sweep(cx, cryptopay.ETH, key, to, chain, 2); err != nil || tx != "" {
+		t.Fatalf("swept funds with one confirmation %q, %v", tx, err)
+	}
+	chain.Mine(1)
+	tx, err := Sweep(cx, cryptopay.ETH, "0x"+key, to, chain, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs, err := chain.Broadcast(cx, tx)
+	if err != nil || errs[tx] != nil {
+		t.Fatalf("broadcast %v, %v", errs[tx], err)
+	}
+	chain.Mine(1)
+	fee := cryptopay.GasLimit * cryptopay.GasPrice * cryptopay.GweiToWei
+	if got := chain.Balance(first); got != amount-fee {
+		t.Errorf("destination has %v, want %v", got, amount-fee)
+	}
+	if got := chain.Balance(from); got != 0 {
+		t.Errorf("source has %v", got)
+	}
+}
+
+func TestMoveMultisig(t *testing.T) {
+	cx := context.Background()
+	chain, err := chaintest.New(cryptopay.BTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []*cryptopay.Key
+	var pubs []string
+	for _, pass := range []string{"alice", "bob", "carol"} {
+		k, _, err := cryptopay.NewFromMnemonic(testMnemonic, pass)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err := k.MultisigAccountKey(cryptopay.MultisigP2WSH, cryptopay.BTC, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, k)
+		pubs = append(pubs, pub)
+	}
+	ms, err := cryptopay.NewMultisig(2, cryptopay.MultisigP2WSH, pubs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := FromMultisig(ms, keys[0], chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext, err := w.Addresses(cx, false, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr, _ := ms.Address(false, 1); ext[1] != addr {
+		t.Fatalf("address %s, want %s", ext[1], addr)
+	}
+	if _, err = chain.Fund(ext[1], 80000); err != nil {
+		t.Fatal(err)
+	}
+	chain.Mine(1)
+	toPub, toAddr := destination(t, cryptopay.BTC)
+	psbts, err := w.Move(cx, toPub, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(psbts) != 1 {
+		t.Fatalf("got %v PSBTs", len(psbts))
+	}
+	// until it's signed and broadcast the funds stay.
+	bal, err := w.BalanceByAddress(cx, ext[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := bal[ext[1]]; b.Confirmed != 80000 || b.Outgoing != 0 {
+		t.Fatalf("balance %+v after Move", b)
+	}
+	p, err := cryptopay.ParsePSBT([]byte(psbts[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Inputs[0].NonWitnessUTXO == nil {
+		t.Error("the PSBT has no previous transaction")
+	}
+	// alice signed already, it needs bob or carol.
+	if err = p.Finalize(); err == nil {
+		t.Fatal("finalized with one signature")
+	}
+	if n, err := keys[2].SignPSBT(p); err != nil || n != 1 {
+		t.Fatalf("signed %v, %v", n, err)
+	}
+	if err = p.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := p.Extract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := hex.EncodeToString(raw)
+	errs, err := chain.Broadcast(cx, tx)
+	if err != nil || errs[tx] != nil {
+		t.Fatalf("broadcast %v, %v", errs[tx], err)
+	}
+	if got := chain.Balance(toAddr); got == 0 || got >= 80000 {
+		t.Errorf("destination has %v", got)
+	}
 }
-*/
@@ -0,0 +1,434 @@
+// Package watch reports payments to a set of addresses as they happen.
+//
+// A Watcher keeps the unspent outputs of the watched addresses and diffs them
+// whenever a Notifier says something changed, and every Interval in case the
+// notifiers are down or there are none. Ethereum has no outputs so the
+// balance of every address is diffed instead.
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/golang/glog"
+	"github.com/winteraz/cryptopay"
+	"github.com/winteraz/cryptopay/wallet"
+	"sync"
+	"time"
+)
+
+type Kind int
+
+const (
+	// Seen is a new payment, usually still in the mempool.
+	Seen Kind = iota
+	// Confirmed is a payment which reached the confirmations of the watcher.
+	Confirmed
+	// Reorged is a payment which lost confirmations or disappeared before
+	// it was confirmed.
+	Reorged
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Seen:
+		return "seen"
+	case Confirmed:
+		return "confirmed"
+	case Reorged:
+		return "reorged"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Event is a change of a payment to a watched address. Tx and N are empty for
+// ethereum where the Amount is the balance increase.
+type Event struct {
+	Kind          Kind
+	Address       string
+	Tx            string
+	N             uint32
+	Amount        uint64
+	Confirmations int
+}
+
+// Notifier tells the watcher when it's worth to look at the addresses.
+// Subscribe calls changed with the addresses which may have new transactions,
+// or with none on a new block, and blocks until cx is done or the
+// subscription fails.
+type Notifier interface {
+	Subscribe(cx context.Context, addr []string, changed func(addr ...string)) error
+}
+
+// The polling interval of a new Watcher.
+const DefaultInterval = 30 * time.Second
+
+// Watcher emits the events of the watched addresses, see New.
+type Watcher struct {
+	// Interval between polls of all the addresses, it's the only source of
+	// updates when the notifiers are down. It's also the wait before a
+	// failed subscription is retried. DefaultInterval if it isn't positive.
+	Interval time.Duration
+
+	coin          cryptopay.CoinType
+	unspender     wallet.Unspender
+	confirmations int
+	notifiers     []Notifier
+	events        chan Event
+	wake          chan struct{}
+	resubscribe   chan struct{}
+
+	mu       sync.Mutex
+	addrs    map[string]bool
+	all      bool                          // a block, every address must be refreshed
+	pending  map[string]bool               // addresses notified since the last refresh
+	outputs  map[string]map[string]*output // address -> tx:n
+	balances map[string]*balance
+}
+
+type output struct {
+	cryptopay.Unspent
+	confirmed bool
+}
+
+type balance struct {
+	amount   uint64
+	nonce    uint64     // the transactions sent, a decrease with more is a spend
+	deposits []*deposit // unconfirmed, oldest first
+}
+
+type deposit struct {
+	amount uint64
+	height uint64 // the tip when it was seen
+}
+
+// New returns a watcher of payments which reports them as Confirmed once they
+// have confirmations. Without notifiers it only polls.
+func New(coin cryptopay.CoinType, unspender wallet.Unspender, confirmations int, notifiers ...Notifier) (*Watcher, error) {
+	if unspender == nil {
+		return nil, errors.New("Invalid unspender")
+	}
+	if confirmations < 1 {
+		return nil, fmt.Errorf("Invalid confirmations %v", confirmations)
+	}
+	return &Watcher{
+		Interval:      DefaultInterval,
+		coin:          coin,
+		unspender:     unspender,
+		confirmations: confirmations,
+		notifiers:     notifiers,
+		events:        make(chan Event, 64),
+		wake:          make(chan struct{}, 1),
+		resubscribe:   make(chan struct{}, 1),
+		addrs:         make(map[string]bool),
+		pending:       make(map[string]bool),
+		outputs:       make(map[string]map[string]*output),
+		balances:      make(map[string]*balance),
+	}, nil
+}
+
+// Events returns the channel of the events, it's closed when Run returns.
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// Watch adds addresses to the watch list. The payments already there are
+// reported as Seen on the next refresh.
+func (w *Watcher) Watch(addr ...string) {
+	w.mu.Lock()
+	for _, a := range addr {
+		w.addrs[a] = true
+		w.pending[a] = true
+	}
+	w.mu.Unlock()
+	signal(w.resubscribe)
+}
+
+// Unwatch removes addresses from the watch list and forgets their payments.
+func (w *Watcher) Unwatch(addr ...string) {
+	w.mu.Lock()
+	for _, a := range addr {
+		delete(w.addrs, a)
+		delete(w.pending, a)
+		delete(w.outputs, a)
+		delete(w.balances, a)
+	}
+	w.mu.Unlock()
+	signal(w.resubscribe)
+}
+
+// Run watches until cx is done. It must be called once.
+func (w *Watcher) Run(cx context.Context) error {
+	defer close(w.events)
+	tick := time.NewTicker(w.interval())
+	defer tick.Stop()
+	cancel := func() {}
+	defer func() { cancel() }()
+	for {
+		select {
+		case <-cx.Done():
+			return cx.Err()
+		case <-w.resubscribe:
+			cancel()
+			cancel = w.subscribeAll(cx)
+			w.refresh(cx, false)
+		case <-w.wake:
+			w.refresh(cx, false)
+		case <-tick.C:
+			w.refresh(cx, true)
+		}
+	}
+}
+
+// subscribeAll subscribes every notifier to the watched addresses until the
+// returned function is called.
+func (w *Watcher) subscribeAll(cx context.Context) context.CancelFunc {
+	sub, cancel := context.WithCancel(cx)
+	addr := w.watched()
+	for _, n := range w.notifiers {
+		go w.subscribe(sub, n, addr)
+	}
+	return cancel
+}
+
+func (w *Watcher) subscribe(cx context.Context, n Notifier, addr []string) {
+	if len(addr) == 0 {
+		return
+	}
+	for {
+		err := n.Subscribe(cx, addr, w.notify)
+		if cx.Err() != nil {
+			return
+		}
+		log.Errorf("subscription: %v, polling every %v", err, w.interval())
+		select {
+		case <-cx.Done():
+			return
+		case <-time.After(w.interval()):
+		}
+		// payments may have been missed while the subscription was down.
+		w.notify()
+	}
+}
+
+func (w *Watcher) interval() time.Duration {
+	if w.Interval <= 0 {
+		return DefaultInterval
+	}
+	return w.Interval
+}
+
+func (w *Watcher) notify(addr ...string) {
+	w.mu.Lock()
+	if len(addr) == 0 {
+		w.all = true
+	}
+	for _, a := range addr {
+		if w.addrs[a] {
+			w.pending[a] = true
+		}
+	}
+	w.mu.Unlock()
+	signal(w.wake)
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func (w *Watcher) watched() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var addr []string
+	for a := range w.addrs {
+		addr = append(addr, a)
+	}
+	return addr
+}
+
+// invalidator is implemented by the caches of the unspenders (wallet.Cache).
+type invalidator interface {
+	Invalidate(addr ...string)
+}
+
+// refresh diffs the pending addresses or all of them. Errors are logged, the
+// next poll tries again.
+func (w *Watcher) refresh(cx context.Context, all bool) {
+	w.mu.Lock()
+	var addr []string
+	if all || w.all {
+		for a := range w.addrs {
+			addr = append(addr, a)
+		}
+	} else {
+		for a := range w.pending {
+			addr = append(addr, a)
+		}
+	}
+	w.all = false
+	w.pending = make(map[string]bool)
+	w.mu.Unlock()
+	if len(addr) == 0 {
+		return
+	}
+	if c, ok := w.unspender.(invalidator); ok {
+		c.Invalidate(addr...)
+	}
+	m, err := w.unspender.Unspent(cx, addr...)
+	var nonces map[string]uint64
+	if err == nil && w.coin == cryptopay.ETH {
+		nonces, err = w.unspender.CountTransactions(cx, addr...)
+	}
+	if err != nil {
+		log.Error(err)
+		// don't lose the notified addresses.
+		w.mu.Lock()
+		for _, a := range addr {
+			if w.addrs[a] {
+				w.pending[a] = true
+			}
+		}
+		w.mu.Unlock()
+		return
+	}
+	var events []Event
+	if w.coin == cryptopay.ETH {
+		events = w.diffBalances(cx, addr, m, nonces)
+	} else {
+		events = w.diffOutputs(addr, m)
+	}
+	for _, e := range events {
+		select {
+		case w.events <- e:
+		case <-cx.Done():
+			return
+		}
+	}
+}
+
+func (w *Watcher) diffOutputs(addr []string, m map[string][]cryptopay.Unspent) []Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var events []Event
+	for _, a := range addr {
+		if !w.addrs[a] {
+			continue // unwatched meanwhile
+		}
+		old := w.outputs[a]
+		cur := make(map[string]*output)
+		for _, un := range m[a] {
+			key := fmt.Sprintf("%s:%d", un.Tx, un.N)
+			o, ok := old[key]
+			if !ok {
+				o = &output{Unspent: un}
+				events = append(events, o.event(Seen, a))
+			} else if un.Confirmations < o.Confirmations {
+				o.Confirmations = un.Confirmations
+				o.confirmed = o.confirmed && un.Confirmations >= w.confirmations
+				events = append(events, o.event(Reorged, a))
+			}
+			o.Confirmations = un.Confirmations
+			if !o.confirmed && o.Confirmations >= w.confirmations {
+				o.confirmed = true
+				events = append(events, o.event(Confirmed, a))
+			}
+			cur[key] = o
+		}
+		for key, o := range old {
+			if _, ok := cur[key]; ok || o.confirmed {
+				// a confirmed output which is gone was spent.
+				continue
+			}
+			o.Confirmations = 0
+			events = append(events, o.event(Reorged, a))
+		}
+		w.outputs[a] = cur
+	}
+	return events
+}
+
+func (o *output) event(k Kind, addr string) Event {
+	return Event{
+		Kind:          k,
+		Address:       addr,
+		Tx:            o.Tx,
+		N:             o.N,
+		Amount:        o.Amount,
+		Confirmations: o.Confirmations,
+	}
+}
+
+// diffBalances turns balance increases into deposits. A deposit is confirmed
+// once the chain grew by the confirmations since it was seen. A decrease
+// while deposits are unconfirmed reverts the newest of them, unless the
+// address sent transactions (its nonce grew), then it's a spend. Without a
+// wallet.Heighter the confirmations of the unspender are used.
+func (w *Watcher) diffBalances(cx context.Context, addr []string, m map[string][]cryptopay.Unspent, nonces map[string]uint64) []Event {
+	var tip uint64
+	if h, ok := w.unspender.(wallet.Heighter); ok {
+		var err error
+		if tip, err = h.BlockHeight(cx); err != nil {
+			log.Error(err)
+		}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var events []Event
+	for _, a := range addr {
+		if !w.addrs[a] {
+			continue
+		}
+		var amount uint64
+		confirmations := 0
+		for _, un := range m[a] {
+			amount += un.Amount
+			confirmations = un.Confirmations
+		}
+		b, ok := w.balances[a]
+		if !ok {
+			b = &balance{nonce: nonces[a]}
+			w.balances[a] = b
+		}
+		spent := nonces[a] > b.nonce
+		b.nonce = nonces[a]
+		switch {
+		case amount > b.amount:
+			d := &deposit{amount: amount - b.amount, height: tip}
+			b.deposits = append(b.deposits, d)
+			events = append(events, Event{Kind: Seen, Address: a, Amount: d.amount, Confirmations: confirmations})
+		case amount < b.amount && !spent:
+			gone := b.amount - amount
+			for len(b.deposits) > 0 && gone > 0 {
+				d := b.deposits[len(b.deposits)-1]
+				if d.amount > gone {
+					// a spend of funds which were there before.
+					break
+				}
+				gone -= d.amount
+				b.deposits = b.deposits[:len(b.deposits)-1]
+				events = append(events, Event{Kind: Reorged, Address: a, Amount: d.amount})
+			}
+		}
+		b.amount = amount
+		var left []*deposit
+		for _, d := range b.deposits {
+			c := confirmations
+			if tip != 0 && d.height != 0 {
+				c = 0 // the chain got shorter
+				if tip >= d.height {
+					c = int(tip-d.height) + 1
+				}
+			}
+			if c >= w.confirmations {
+				events = append(events, Event{Kind: Confirmed, Address: a, Amount: d.amount, Confirmations: c})
+				continue
+			}
+			left = append(left, d)
+		}
+		b.deposits = left
+	}
+	return events
+}
@@ -0,0 +1,169 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"github.com/winteraz/cryptopay"
+	"github.com/winteraz/cryptopay/chaintest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// notifier is a Notifier the test triggers by hand.
+type notifier chan []string
+
+func (n notifier) Subscribe(cx context.Context, addr []string, changed func(addr ...string)) error {
+	for {
+		select {
+		case <-cx.Done():
+			return cx.Err()
+		case a := <-n:
+			changed(a...)
+		}
+	}
+}
+
+func next(t *testing.T, w *Watcher) Event {
+	select {
+	case e := <-w.Events():
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+	return Event{}
+}
+
+func TestWatch(t *testing.T) {
+	const addr = "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"
+	chain, err := chaintest.New(cryptopay.BTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := make(notifier)
+	w, err := New(cryptopay.BTC, chain, 2, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Interval = time.Hour // only the notifier
+	cx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w.Watch(addr)
+	go w.Run(cx)
+
+	tx, err := chain.Fund(addr, 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n <- []string{addr}
+	if e := next(t, w); e.Kind != Seen || e.Tx != tx || e.Amount != 100000 || e.Confirmations != 0 {
+		t.Fatalf("got %+v, want seen in mempool", e)
+	}
+	chain.Mine(1)
+	n <- nil
+	chain.Mine(1)
+	n <- nil
+	if e := next(t, w); e.Kind != Confirmed || e.Tx != tx || e.Confirmations != 2 {
+		t.Fatalf("got %+v, want confirmed", e)
+	}
+}
+
+func TestWatchPolling(t *testing.T) {
+	const addr = "0x9858EfFD232B4033E47d90003D41EC34EcaEda94"
+	chain, err := chaintest.New(cryptopay.ETH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := New(cryptopay.ETH, chain, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Interval = 10 * time.Millisecond
+	cx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w.Watch(addr)
+	go w.Run(cx)
+
+	if _, err = chain.Fund(addr, 5000); err != nil {
+		t.Fatal(err)
+	}
+	chain.Mine(1)
+	if e := next(t, w); e.Kind != Seen || e.Amount != 5000 {
+		t.Fatalf("got %+v, want seen", e)
+	}
+	if e := next(t, w); e.Kind != Confirmed || e.Amount != 5000 {
+		t.Fatalf("got %+v, want confirmed", e)
+	}
+}
+
+// account is an ethereum unspender of one address.
+type account struct {
+	balance       uint64
+	confirmations int
+	nonce         uint64
+}
+
+func (a *account) HasTransactions(cx context.Context, addr ...string) (map[string]bool, error) {
+	return nil, errors.New("Not implemented")
+}
+
+func (a *account) Unspent(cx context.Context, addr ...string) (map[string][]cryptopay.Unspent, error) {
+	return map[string][]cryptopay.Unspent{
+		addr[0]: {{Amount: a.balance, Confirmations: a.confirmations}}}, nil
+}
+
+func (a *account) CountTransactions(cx context.Context, addr ...string) (map[string]uint64, error) {
+	return map[string]uint64{addr[0]: a.nonce}, nil
+}
+
+func TestBalances(t *testing.T) {
+	const addr = "0x9858EfFD232B4033E47d90003D41EC34EcaEda94"
+	acc := &account{}
+	w, err := New(cryptopay.ETH, acc, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Watch(addr)
+	cx := context.Background()
+	for i, step := range []struct {
+		account
+		want []Event
+	}{
+		{account{}, nil},
+		// in the mempool.
+		{account{balance: 1000}, []Event{{Kind: Seen, Address: addr, Amount: 1000}}},
+		{account{balance: 1000, confirmations: 2}, []Event{{Kind: Confirmed, Address: addr, Amount: 1000, Confirmations: 2}}},
+		{account{balance: 1500, confirmations: 1}, []Event{{Kind: Seen, Address: addr, Amount: 500, Confirmations: 1}}},
+		// spent by the address, the deposit is still there.
+		{account{balance: 300, confirmations: 1, nonce: 1}, nil},
+		{account{balance: 1000, confirmations: 1, nonce: 1}, []Event{{Kind: Seen, Address: addr, Amount: 700, Confirmations: 1}}},
+		{account{balance: 300, nonce: 1}, []Event{{Kind: Reorged, Address: addr, Amount: 700}}},
+	} {
+		*acc = step.account
+		w.refresh(cx, true)
+		var got []Event
+		for len(w.events) > 0 {
+			got = append(got, <-w.events)
+		}
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%d: got %+v, want %+v", i, got, step.want)
+		}
+	}
+}
+
+func TestInterval(t *testing.T) {
+	chain, err := chaintest.New(cryptopay.BTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := New(cryptopay.BTC, chain, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Interval = 0
+	cx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err = w.Run(cx); err != context.DeadlineExceeded {
+		t.Fatalf("run: %v", err)
+	}
+}